@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+type batch struct {
+	specFile         string
+	concurrency      int
+	detailedExitCode bool
+}
+
+// batchSpec is the content of the file passed to helm diff batch.
+type batchSpec struct {
+	// Flags are passed to helm diff upgrade for every release, before the release's own flags.
+	Flags    []string     `json:"flags,omitempty"`
+	Releases []batchEntry `json:"releases"`
+}
+
+// batchEntry describes a single helm diff upgrade invocation.
+type batchEntry struct {
+	Release   string   `json:"release"`
+	Namespace string   `json:"namespace,omitempty"`
+	Chart     string   `json:"chart"`
+	Version   string   `json:"version,omitempty"`
+	Values    []string `json:"values,omitempty"`
+	Flags     []string `json:"flags,omitempty"`
+}
+
+// batchResult holds the outcome of diffing a single batchEntry.
+type batchResult struct {
+	entry   batchEntry
+	out     bytes.Buffer
+	errOut  bytes.Buffer
+	changed bool
+	err     error
+	// code is the exit code of helm diff upgrade when the release was diffed, but err reports resources
+	// that could not be diffed or deprecated APIs, or when the diff was canceled.
+	code int
+}
+
+const batchCmdLongUsage = `
+This command runs helm diff upgrade for every release listed in a spec file
+and prints one combined report.
+
+The releases are diffed concurrently. The output of every release is printed
+in its own section once all releases are done, followed by a summary.
+The command fails when any of the releases could not be diffed. Otherwise it
+exits with the highest exit code of the releases: 5 when their diff was canceled,
+e.g. by their own --timeout, 4 when they use deprecated APIs, 3 when some of
+their resources could not be diffed, then 2 for changes with --detailed-exitcode.
+
+Example spec file:
+
+	flags: [--context, "3"]
+	releases:
+	  - release: frontend
+	    namespace: web
+	    chart: bitnami/nginx
+	    version: 18.0.0
+	    values: [frontend.yaml]
+	  - release: backend
+	    namespace: api
+	    chart: ./charts/backend
+	    flags: [--set, image.tag=v2, --three-way-merge]
+
+The top-level flags are passed to every release, before the release's own flags.
+Any helm diff upgrade flag can be used, but values cannot be read from stdin with "-".
+`
+
+func batchCmd() *cobra.Command {
+	diff := batch{}
+
+	batchCmd := &cobra.Command{
+		Use:   "batch [flags] -f RELEASES_FILE",
+		Short: "Shows diff of many releases listed in a file",
+		Long:  batchCmdLongUsage,
+		Example: strings.Join([]string{
+			"  helm diff batch -f releases.yaml",
+			"  helm diff batch -f releases.yaml --concurrency 8 --detailed-exitcode",
+		}, "\n"),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			if diff.specFile == "" {
+				return errors.New("a releases file is required, specify it with -f")
+			}
+
+			if diff.concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1, but got %d", diff.concurrency)
+			}
+
+			return diff.run(cmd.Context(), cmd.OutOrStdout())
+		},
+	}
+
+	batchCmd.Flags().StringVarP(&diff.specFile, "file", "f", "", "file listing the releases to diff")
+	batchCmd.Flags().IntVar(&diff.concurrency, "concurrency", 4, "maximum number of releases diffed at the same time")
+	batchCmd.Flags().BoolVar(&diff.detailedExitCode, "detailed-exitcode", false, "return a non-zero exit code when there are changes")
+
+	batchCmd.SuggestionsMinimumDistance = 1
+
+	return batchCmd
+}
+
+func (b *batch) run(ctx context.Context, to io.Writer) error {
+	spec, err := readBatchSpec(b.specFile)
+	if err != nil {
+		return err
+	}
+
+	results := make([]*batchResult, len(spec.Releases))
+	sem := make(chan struct{}, b.concurrency)
+	var wg sync.WaitGroup
+	for i, entry := range spec.Releases {
+		results[i] = &batchResult{entry: entry}
+		wg.Add(1)
+		go func(result *batchResult) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			result.run(ctx, spec.Flags)
+		}(results[i])
+	}
+	wg.Wait()
+
+	return b.report(to, results)
+}
+
+// report prints the output of every release followed by a summary. It fails when any release could not be
+// diffed and otherwise exits with the highest exit code of the releases: canceledCode, deprecatedAPICode,
+// resourceErrorCode, then 2 for changes with --detailed-exitcode.
+func (b *batch) report(to io.Writer, results []*batchResult) error {
+	var changed, unchanged, failed int
+	codes := map[int]int{}
+	for _, result := range results {
+		_, _ = fmt.Fprintf(to, "=== %s ===\n", result.entry.name())
+		_, _ = io.Copy(to, &result.errOut)
+		_, _ = io.Copy(to, &result.out)
+		switch {
+		case result.err != nil:
+			if result.code != 0 {
+				codes[result.code]++
+			} else {
+				failed++
+			}
+			_, _ = fmt.Fprintf(to, "Error: %s\n", strings.TrimRight(result.err.Error(), "\n"))
+		case result.changed:
+			changed++
+		default:
+			unchanged++
+		}
+		_, _ = fmt.Fprintln(to)
+	}
+	summary := fmt.Sprintf("Summary: %d releases, %d with changes, %d without changes", len(results), changed, unchanged)
+	if n := codes[resourceErrorCode]; n > 0 {
+		summary += fmt.Sprintf(", %d with resources that could not be diffed", n)
+	}
+	if n := codes[deprecatedAPICode]; n > 0 {
+		summary += fmt.Sprintf(", %d using deprecated or removed APIs", n)
+	}
+	if n := codes[canceledCode]; n > 0 {
+		summary += fmt.Sprintf(", %d canceled", n)
+	}
+	_, _ = fmt.Fprintf(to, "%s, %d failed\n", summary, failed)
+
+	switch {
+	case failed > 0:
+		return fmt.Errorf("failed to diff %d of %d releases", failed, len(results))
+	case codes[canceledCode] > 0:
+		return Error{
+			error: fmt.Errorf("the diff of %d of %d releases was canceled", codes[canceledCode], len(results)),
+			Code:  canceledCode,
+		}
+	case codes[deprecatedAPICode] > 0:
+		return Error{
+			error: fmt.Errorf("%d of %d releases use deprecated or removed API versions", codes[deprecatedAPICode], len(results)),
+			Code:  deprecatedAPICode,
+		}
+	case codes[resourceErrorCode] > 0:
+		return Error{
+			error: fmt.Errorf("%d of %d releases have resources that could not be diffed", codes[resourceErrorCode], len(results)),
+			Code:  resourceErrorCode,
+		}
+	case b.detailedExitCode && changed > 0:
+		return Error{
+			error: errors.New("identified at least one change, exiting with non-zero exit code (detailed-exitcode parameter enabled)"),
+			Code:  2,
+		}
+	}
+	return nil
+}
+
+// run diffs the entry by running the upgrade command with the entry's arguments.
+func (r *batchResult) run(ctx context.Context, flags []string) {
+	d := &diffCmd{
+		namespace: os.Getenv("HELM_NAMESPACE"),
+	}
+	if r.entry.Namespace != "" {
+		d.namespace = r.entry.Namespace
+	}
+
+	cmd := newBatchEntryCommand(d)
+	cmd.SetArgs(r.entry.args(flags))
+	cmd.SetOut(&r.out)
+	cmd.SetErr(&r.errOut)
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	err := cmd.ExecuteContext(ctx)
+	var diffErr Error
+	if errors.As(err, &diffErr) {
+		switch diffErr.Code {
+		case 2:
+			// the detailed exit code is always requested to learn whether the release changed
+			r.changed = true
+			err = nil
+		case resourceErrorCode, deprecatedAPICode, canceledCode:
+			r.code = diffErr.Code
+		}
+	}
+	r.err = err
+}
+
+// newBatchEntryCommand returns the upgrade command diffing an entry. Like helm diff upgrade, it takes --timeout,
+// which bounds the diff of the entry within the deadline of the batch, and returns an Error with canceledCode
+// when it is canceled.
+func newBatchEntryCommand(d *diffCmd) *cobra.Command {
+	cmd := newUpgradeCommand(d)
+	addTimeoutFlag(cmd)
+	cancelable(cmd)
+	return cmd
+}
+
+// args returns the helm diff upgrade arguments for the entry.
+func (e batchEntry) args(flags []string) []string {
+	args := []string{e.Release, e.Chart}
+	if e.Version != "" {
+		args = append(args, "--version", e.Version)
+	}
+	for _, values := range e.Values {
+		args = append(args, "--values", values)
+	}
+	args = append(args, flags...)
+	args = append(args, e.Flags...)
+	return append(args, "--detailed-exitcode")
+}
+
+// readsStdin tells whether the entry passes "-" as a values file, to read the values from stdin.
+func (e batchEntry) readsStdin(flags []string) (bool, error) {
+	d := &diffCmd{}
+	if err := newBatchEntryCommand(d).ParseFlags(e.args(flags)); err != nil {
+		return false, err
+	}
+	for _, valueFile := range d.valueFiles {
+		if strings.TrimSpace(valueFile) == "-" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// name returns the namespace/release name of the entry.
+func (e batchEntry) name() string {
+	if e.Namespace == "" {
+		return e.Release
+	}
+	return e.Namespace + "/" + e.Release
+}
+
+func readBatchSpec(path string) (*batchSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read releases file: %w", err)
+	}
+
+	var spec batchSpec
+	if err := yaml.UnmarshalStrict(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse releases file %s: %w", path, err)
+	}
+
+	for i, entry := range spec.Releases {
+		if entry.Release == "" || entry.Chart == "" {
+			return nil, fmt.Errorf("entry %d of releases file %s needs a release and a chart", i+1, path)
+		}
+		stdin, err := entry.readsStdin(spec.Flags)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d of releases file %s: %w", i+1, path, err)
+		}
+		if stdin {
+			return nil, fmt.Errorf("entry %d of releases file %s reads values from stdin with \"-\", which the concurrently diffed releases cannot share", i+1, path)
+		}
+	}
+
+	return &spec, nil
+}
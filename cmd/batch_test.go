@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadBatchSpec(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("valid file", func(t *testing.T) {
+		path := filepath.Join(dir, "releases.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(`flags: [--context, "3"]
+releases:
+- release: frontend
+  namespace: web
+  chart: bitnami/nginx
+  version: 18.0.0
+  values: [frontend.yaml]
+  flags: [--three-way-merge]
+`), 0644))
+
+		spec, err := readBatchSpec(path)
+		require.NoError(t, err)
+		require.Len(t, spec.Releases, 1)
+		require.Equal(t, "web/frontend", spec.Releases[0].name())
+		require.Equal(t,
+			[]string{"frontend", "bitnami/nginx", "--version", "18.0.0", "--values", "frontend.yaml", "--context", "3", "--three-way-merge", "--detailed-exitcode"},
+			spec.Releases[0].args(spec.Flags),
+		)
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		path := filepath.Join(dir, "unknown.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("releases:\n- release: frontend\n  chart: nginx\n  value: [a.yaml]\n"), 0644))
+
+		_, err := readBatchSpec(path)
+		require.Error(t, err)
+	})
+
+	t.Run("missing chart", func(t *testing.T) {
+		path := filepath.Join(dir, "nochart.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("releases:\n- release: frontend\n"), 0644))
+
+		_, err := readBatchSpec(path)
+		require.EqualError(t, err, "entry 1 of releases file "+path+" needs a release and a chart")
+	})
+
+	t.Run("values from stdin", func(t *testing.T) {
+		for name, content := range map[string]string{
+			"values":      "releases:\n- release: frontend\n  chart: nginx\n  values: [\"-\"]\n",
+			"entry flags": "releases:\n- release: frontend\n  chart: nginx\n  flags: [\"--values=a.yaml,-\"]\n",
+			"top flags":   "flags: [-f, \"-\"]\nreleases:\n- release: frontend\n  chart: nginx\n",
+		} {
+			path := filepath.Join(dir, "stdin.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+			_, err := readBatchSpec(path)
+			require.ErrorContains(t, err, "reads values from stdin", name)
+		}
+	})
+}
+
+func TestBatchCmdFlagValidation(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"-f", "releases.yaml", "--concurrency", "0"},
+		{"-f", "releases.yaml", "extra"},
+	} {
+		cmd := batchCmd()
+		cmd.SetArgs(args)
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		require.Error(t, cmd.Execute(), "args %v", args)
+	}
+}
+
+func TestBatchReport(t *testing.T) {
+	result := func(release string, changed bool, err error, code int) *batchResult {
+		return &batchResult{entry: batchEntry{Release: release}, changed: changed, err: err, code: code}
+	}
+	resourceErr := Error{error: errors.New("1 resources could not be diffed, see the ERROR entries of the report"), Code: resourceErrorCode}
+	deprecatedErr := Error{error: errors.New("1 objects use API versions removed in Kubernetes 1.25"), Code: deprecatedAPICode}
+
+	t.Run("highest exit code", func(t *testing.T) {
+		var out bytes.Buffer
+		err := (&batch{detailedExitCode: true}).report(&out, []*batchResult{
+			result("changed", true, nil, 0),
+			result("broken", false, resourceErr, resourceErrorCode),
+			result("deprecated", false, deprecatedErr, deprecatedAPICode),
+		})
+		var diffErr Error
+		require.ErrorAs(t, err, &diffErr)
+		require.Equal(t, deprecatedAPICode, diffErr.Code)
+		require.EqualError(t, err, "1 of 3 releases use deprecated or removed API versions")
+		require.Contains(t, out.String(), "=== broken ===\nError: 1 resources could not be diffed, see the ERROR entries of the report\n")
+		require.Contains(t, out.String(), "Summary: 3 releases, 1 with changes, 0 without changes, 1 with resources that could not be diffed, 1 using deprecated or removed APIs, 0 failed\n")
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		var out bytes.Buffer
+		canceledErr := Error{error: errors.New("timed out after 1s: context deadline exceeded"), Code: canceledCode}
+		err := (&batch{}).report(&out, []*batchResult{
+			result("deprecated", false, deprecatedErr, deprecatedAPICode),
+			result("slow", false, canceledErr, canceledCode),
+		})
+		var diffErr Error
+		require.ErrorAs(t, err, &diffErr)
+		require.Equal(t, canceledCode, diffErr.Code)
+		require.EqualError(t, err, "the diff of 1 of 2 releases was canceled")
+		require.Contains(t, out.String(), "Summary: 2 releases, 0 with changes, 0 without changes, 1 using deprecated or removed APIs, 1 canceled, 0 failed\n")
+	})
+
+	t.Run("resource errors", func(t *testing.T) {
+		err := (&batch{detailedExitCode: true}).report(io.Discard, []*batchResult{
+			result("changed", true, nil, 0),
+			result("broken", false, resourceErr, resourceErrorCode),
+		})
+		var diffErr Error
+		require.ErrorAs(t, err, &diffErr)
+		require.Equal(t, resourceErrorCode, diffErr.Code)
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		var out bytes.Buffer
+		err := (&batch{}).report(&out, []*batchResult{
+			result("broken", false, resourceErr, resourceErrorCode),
+			result("missing", false, errors.New("release not found"), 0),
+		})
+		require.EqualError(t, err, "failed to diff 1 of 2 releases")
+		require.Contains(t, out.String(), "Summary: 2 releases, 0 with changes, 0 without changes, 1 with resources that could not be diffed, 1 failed\n")
+	})
+
+	t.Run("changes", func(t *testing.T) {
+		require.NoError(t, (&batch{}).report(io.Discard, []*batchResult{result("changed", true, nil, 0)}))
+		err := (&batch{detailedExitCode: true}).report(io.Discard, []*batchResult{result("changed", true, nil, 0)})
+		var diffErr Error
+		require.ErrorAs(t, err, &diffErr)
+		require.Equal(t, 2, diffErr.Code)
+	})
+}
+
+func TestBatchEntryTimeout(t *testing.T) {
+	setupFakeHelm(t, "hang", "", "", "")
+	chart := t.TempDir()
+
+	start := time.Now()
+	result := &batchResult{entry: batchEntry{Release: "slow", Chart: chart, Flags: []string{"--timeout", "200ms"}}}
+	result.run(context.Background(), nil)
+
+	require.Equal(t, canceledCode, result.code)
+	require.True(t, strings.HasPrefix(result.err.Error(), "timed out after 200ms: "), result.err.Error())
+	require.Less(t, time.Since(start), 30*time.Second, "helm was not killed")
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"helm.sh/helm/v4/pkg/cli"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// canceledCode is the exit code when the command is interrupted by SIGINT or SIGTERM or times out after --timeout.
+const canceledCode = 5
+
+// Execute runs the helm diff command until it is done or interrupted by SIGINT or SIGTERM.
+// An interrupted command kills the helm processes it started, removes its temporary files and returns
+// an Error with canceledCode. A second signal terminates the process right away.
+func Execute() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// restore the default behavior of the signals, so that a second one terminates a command that doesn't stop
+	context.AfterFunc(ctx, func() {
+		stop()
+		removeTempFiles()
+	})
+	defer removeTempFiles()
+
+	return New().ExecuteContext(ctx)
+}
+
+// addTimeoutFlag adds the --timeout flag to the command and its subcommands.
+func addTimeoutFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().Duration("timeout", 0, "time to wait for the diff, including the helm processes and Kubernetes API calls, before canceling it and exiting with code 5. 0 waits forever. Unlike the --timeout of helm upgrade, it does not wait for any resource")
+}
+
+// withTimeout returns the context of the command with the deadline of its --timeout flag, if set.
+func withTimeout(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	if timeout <= 0 {
+		return context.WithCancel(cmd.Context())
+	}
+	return context.WithTimeoutCause(cmd.Context(), timeout, fmt.Errorf("timed out after %s", timeout))
+}
+
+// cancelable makes the command and its subcommands run with the deadline of --timeout and return an Error
+// with canceledCode when they fail because they are interrupted or time out.
+func cancelable(cmd *cobra.Command) {
+	for _, sub := range cmd.Commands() {
+		cancelable(sub)
+	}
+	run := cmd.RunE
+	if run == nil {
+		return
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := withTimeout(cmd)
+		defer cancel()
+		cmd.SetContext(ctx)
+		return canceledError(ctx, run(cmd, args))
+	}
+}
+
+// withRequestTimeout bounds every Kubernetes API request of the clients of the settings by the deadline of ctx,
+// if it has one, as the resource helpers of manifest.Generate take no context.
+func withRequestTimeout(ctx context.Context, settings *cli.EnvSettings) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+	flags, ok := settings.RESTClientGetter().(*genericclioptions.ConfigFlags)
+	if !ok {
+		return
+	}
+	timeout := max(time.Until(deadline), time.Millisecond).String()
+	flags.Timeout = &timeout
+}
+
+// canceledError returns err as an Error with canceledCode telling why, if ctx is done.
+func canceledError(ctx context.Context, err error) error {
+	var cmdErr Error
+	if err == nil || ctx.Err() == nil || (errors.As(err, &cmdErr) && cmdErr.Code == canceledCode) {
+		return err
+	}
+	reason := "interrupted"
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		reason = context.Cause(ctx).Error()
+	}
+	return Error{
+		error: fmt.Errorf("%s: %w", reason, err),
+		Code:  canceledCode,
+	}
+}
+
+// tempFiles are the names of the temporary files of the running command,
+// which are removed when it is interrupted even if it doesn't stop.
+var tempFiles = struct {
+	sync.Mutex
+	names map[string]bool
+}{names: map[string]bool{}}
+
+// createTempFile creates a temporary file like os.CreateTemp in the default directory. It must be removed
+// with removeTempFile.
+func createTempFile(pattern string) (*os.File, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, err
+	}
+	tempFiles.Lock()
+	tempFiles.names[f.Name()] = true
+	tempFiles.Unlock()
+	return f, nil
+}
+
+// removeTempFile removes a file created with createTempFile.
+func removeTempFile(name string) {
+	tempFiles.Lock()
+	delete(tempFiles.names, name)
+	tempFiles.Unlock()
+	_ = os.Remove(name)
+}
+
+// removeTempFiles removes the files created with createTempFile that were not removed yet.
+func removeTempFiles() {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	for name := range tempFiles.names {
+		_ = os.Remove(name)
+		delete(tempFiles.names, name)
+	}
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeout(t *testing.T) {
+	setupFakeHelm(t, "hang", "", "", "")
+	chart := t.TempDir()
+
+	start := time.Now()
+	cmd := New()
+	cmd.SetArgs([]string{"local", chart, chart, "--timeout", "200ms"})
+	err := cmd.Execute()
+
+	var cmdErr Error
+	require.True(t, errors.As(err, &cmdErr), "expected an Error, got %v", err)
+	require.Equal(t, canceledCode, cmdErr.Code)
+	require.True(t, strings.HasPrefix(err.Error(), "timed out after 200ms: "), err.Error())
+	require.Less(t, time.Since(start), 30*time.Second, "helm was not killed")
+}
+
+func TestInterrupt(t *testing.T) {
+	setupFakeHelm(t, "hang", "", "", "")
+	chart := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	cmd := New()
+	cmd.SetArgs([]string{"local", chart, chart})
+	err := cmd.ExecuteContext(ctx)
+
+	var cmdErr Error
+	require.True(t, errors.As(err, &cmdErr), "expected an Error, got %v", err)
+	require.Equal(t, canceledCode, cmdErr.Code)
+	require.True(t, strings.HasPrefix(err.Error(), "interrupted: "), err.Error())
+}
+
+func TestCanceledError(t *testing.T) {
+	require.NoError(t, canceledError(context.Background(), nil))
+
+	err := errors.New("failed")
+	require.Equal(t, err, canceledError(context.Background(), err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	canceled := canceledError(ctx, err)
+	require.EqualError(t, canceled, "interrupted: failed")
+	require.Equal(t, canceled, canceledError(ctx, canceled), "canceled errors are not wrapped twice")
+}
+
+func TestRemoveTempFiles(t *testing.T) {
+	kept, err := createTempFile("helm-diff-test")
+	require.NoError(t, err)
+	require.NoError(t, kept.Close())
+	removed, err := createTempFile("helm-diff-test")
+	require.NoError(t, err)
+	require.NoError(t, removed.Close())
+
+	removeTempFile(removed.Name())
+	_, err = os.Stat(removed.Name())
+	require.True(t, os.IsNotExist(err))
+
+	removeTempFiles()
+	_, err = os.Stat(kept.Name())
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const chartCmdLongUsage = `
+This command compares the manifests of two versions of the same chart.
+
+It renders both chart versions with the same values using 'helm template'
+and shows the differences between the resulting manifests. No release or
+cluster access is needed, which makes it useful for previewing an upgrade
+of an upstream chart before scheduling it.
+
+The chart may be a chart reference (repo/chart), an OCI reference
+(oci://registry/chart) or a chart name together with --repo.
+When --to-version is not specified, the latest version is used.
+`
+
+func chartCmd() *cobra.Command {
+	diff := local{
+		release: "release",
+	}
+
+	chartCmd := &cobra.Command{
+		Use:   "chart [flags] CHART",
+		Short: "Shows diff between two versions of a chart",
+		Long:  chartCmdLongUsage,
+		Example: strings.Join([]string{
+			"  helm diff chart bitnami/nginx --from-version 15.0.0 --to-version 18.0.0 -f values.yaml",
+			"  helm diff chart nginx --repo https://charts.bitnami.com/bitnami --from-version 15.0.0",
+			"  helm diff chart oci://registry-1.docker.io/bitnamicharts/nginx --from-version 15.0.0 --to-version 18.0.0",
+		}, "\n"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			if err := checkArgsLength(len(args), "chart"); err != nil {
+				return err
+			}
+
+			if diff.chart1Version == "" {
+				return errors.New("--from-version is required")
+			}
+
+			ProcessDiffOptions(cmd.Flags(), &diff.Options)
+
+			diff.chart1 = args[0]
+			diff.chart2 = args[0]
+
+			if diff.namespace == "" {
+				diff.namespace = os.Getenv("HELM_NAMESPACE")
+			}
+
+			return diff.run(cmd.Context())
+		},
+	}
+
+	chartCmd.Flags().StringVar(&diff.chart1Version, "from-version", "", "chart version to compare from")
+	chartCmd.Flags().StringVar(&diff.chart2Version, "to-version", "", "chart version to compare to. If this is not specified, the latest version is used")
+	chartCmd.Flags().StringVar(&diff.chartRepo, "repo", "", "specify the chart repository url to locate the requested chart")
+	chartCmd.Flags().BoolVar(&diff.insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "skip tls certificate checks for the chart download")
+	addRenderFlags(chartCmd.Flags(), &diff)
+
+	AddDiffOptions(chartCmd.Flags(), &diff.Options)
+
+	chartCmd.SuggestionsMinimumDistance = 1
+
+	return chartCmd
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestChartCmdArgValidation(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+	}{
+		{
+			name: "no arguments",
+			args: []string{"--from-version", "1.0.0"},
+		},
+		{
+			name: "two arguments",
+			args: []string{"repo/chart", "repo/other", "--from-version", "1.0.0"},
+		},
+		{
+			name: "missing from-version",
+			args: []string{"repo/chart", "--to-version", "2.0.0"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := chartCmd()
+			cmd.SetArgs(tc.args)
+			if err := cmd.Execute(); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+}
+
+func TestChartCmdWithChanges(t *testing.T) {
+	manifest1 := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-config
+  namespace: default
+data:
+  key: value1
+`
+	manifest2 := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-config
+  namespace: default
+data:
+  key: value2
+`
+	setupFakeHelmDual(t, manifest1, manifest2)
+
+	output, err := captureStdout(func() {
+		cmd := chartCmd()
+		cmd.SetArgs([]string{"repo/chart", "--from-version", "1.0.0", "--to-version", "2.0.0"})
+
+		if execErr := cmd.Execute(); execErr != nil {
+			t.Errorf("Expected no error but got: %v", execErr)
+		}
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to capture stdout: %v", err)
+	}
+
+	if !strings.Contains(output, "value1") || !strings.Contains(output, "value2") {
+		t.Errorf("Expected diff output containing value1 and value2, got: %q", output)
+	}
+}
+
+func TestChartCmdTemplateArgs(t *testing.T) {
+	manifestYAML := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-config
+data:
+  key: value
+`
+	argsFile := t.TempDir() + "/args"
+	setupFakeHelm(t, "capture_args", manifestYAML, argsFile, "")
+
+	cmd := chartCmd()
+	cmd.SetArgs([]string{"nginx", "--repo", "https://charts.example.com", "--from-version", "1.0.0", "--to-version", "2.0.0", "-f", "values.yaml"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// the args file holds the arguments of the last call, which renders the to-version
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("Expected fake helm args file to be readable, but got: %v", err)
+	}
+	for _, expected := range []string{"template release nginx", "--version 2.0.0", "--repo https://charts.example.com", "--values values.yaml"} {
+		if !strings.Contains(string(args), expected) {
+			t.Errorf("Expected %q in helm template args, got: %q", expected, string(args))
+		}
+	}
+}
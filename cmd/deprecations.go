@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	"github.com/databus23/helm-diff/v3/diff"
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+// deprecatedAPICode is the exit code when --fail-on-deprecated-apis finds deprecated or removed API versions,
+// or --fail-on-removed-apis removed ones.
+const deprecatedAPICode = 4
+
+// apiDeprecationFlags control the check of the rendered manifests against deprecated and removed API versions.
+type apiDeprecationFlags struct {
+	check       bool
+	fail        bool
+	failRemoved bool
+}
+
+func addAPIDeprecationFlags(f *pflag.FlagSet, o *apiDeprecationFlags, kubeVersionSource string) {
+	f.BoolVar(&o.check, "check-deprecated-apis", false, "flag the rendered objects using API versions deprecated or removed in the Kubernetes version of "+kubeVersionSource)
+	f.BoolVar(&o.fail, "fail-on-deprecated-apis", false, fmt.Sprintf("exit with code %d when rendered objects use API versions deprecated or removed in the Kubernetes version, including deprecated ones it still serves. Implies --check-deprecated-apis", deprecatedAPICode))
+	f.BoolVar(&o.failRemoved, "fail-on-removed-apis", false, fmt.Sprintf("exit with code %d when rendered objects use API versions removed in the Kubernetes version, but not deprecated ones it still serves. Implies --check-deprecated-apis", deprecatedAPICode))
+}
+
+func (o apiDeprecationFlags) enabled() bool {
+	return o.check || o.fail || o.failRemoved
+}
+
+// serverKubeVersion returns the version of the Kubernetes API server of the kube context.
+func serverKubeVersion(kubeContext string) (string, error) {
+	discoveryClient, err := prepareEnvSettings(kubeContext).RESTClientGetter().ToDiscoveryClient()
+	if err != nil {
+		return "", err
+	}
+	info, err := discoveryClient.ServerVersion()
+	if err != nil {
+		return "", fmt.Errorf("unable to get the Kubernetes version of the cluster: %w", err)
+	}
+	return info.GitVersion, nil
+}
+
+// checkAPIDeprecations finds the objects of the index using API versions deprecated or removed in the Kubernetes version,
+// which the report warns about. With fail, it returns an Error with deprecatedAPICode counting all of them,
+// with failRemoved the removed ones.
+func (o apiDeprecationFlags) checkAPIDeprecations(kubeVersion string, index map[string]*manifest.MappingResult) error {
+	if !o.fail && !o.failRemoved {
+		return nil
+	}
+	deprecations, err := diff.FindAPIDeprecations(index, kubeVersion)
+	if err != nil {
+		return err
+	}
+	failing := 0
+	for _, deprecation := range deprecations {
+		if o.fail || deprecation.Removed {
+			failing++
+		}
+	}
+	switch {
+	case failing == 0:
+		return nil
+	case o.fail:
+		return Error{
+			error: fmt.Errorf("%d resources use API versions deprecated or removed in Kubernetes %s (fail-on-deprecated-apis parameter enabled)", failing, kubeVersion),
+			Code:  deprecatedAPICode,
+		}
+	default:
+		return Error{
+			error: fmt.Errorf("%d resources use API versions removed in Kubernetes %s (fail-on-removed-apis parameter enabled)", failing, kubeVersion),
+			Code:  deprecatedAPICode,
+		}
+	}
+}
@@ -1,7 +1,35 @@
 package cmd
 
+import (
+	"fmt"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
 // Error to report errors
 type Error struct {
 	error
 	Code int
 }
+
+// resourceErrorCode is the exit code when resources could not be diffed. The others are diffed nonetheless.
+const resourceErrorCode = 3
+
+// resourceErrors returns an Error with resourceErrorCode when resources of the indexes could not be diffed.
+func resourceErrors(indexes ...map[string]*manifest.MappingResult) error {
+	failed := map[string]bool{}
+	for _, index := range indexes {
+		for key, result := range index {
+			if result.Err != nil {
+				failed[key] = true
+			}
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return Error{
+		error: fmt.Errorf("%d resources could not be diffed, see the ERROR entries of the report", len(failed)),
+		Code:  resourceErrorCode,
+	}
+}
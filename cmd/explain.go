@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v4/pkg/chart/v2/loader"
+	"helm.sh/helm/v4/pkg/cli/values"
+	"helm.sh/helm/v4/pkg/getter"
+	"sigs.k8s.io/yaml"
+
+	"github.com/databus23/helm-diff/v3/diff"
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+// maxExplainedValuesKeys limits the number of changed values keys that are rendered one by one
+// to find the keys responsible for the changes of each resource.
+const maxExplainedValuesKeys = 20
+
+// valuesChange is a values key that differs between the values of the release and the new values.
+type valuesChange struct {
+	key     string
+	path    []string
+	value   interface{}
+	removed bool
+}
+
+// attributeChanges tells for the resources of the release whether they change because of the new chart
+// or the new values. The new chart is rendered once with the values of the release and, to name the values
+// keys responsible, once per changed values key.
+func (d *diffCmd) attributeChanges(ctx context.Context, releaseManifest, installManifest []byte) (*diff.Attribution, error) {
+	for _, valueFile := range d.valueFiles {
+		if strings.TrimSpace(valueFile) == "-" {
+			_, _ = fmt.Fprintln(d.errOut, "Not explaining changes by values: values read from stdin cannot be read a second time")
+			return nil, nil
+		}
+	}
+
+	if !d.noHooks {
+		hooks, err := getHooks(d.release, d.namespace, d.kubeContext, d.releaseFiles)
+		if err != nil {
+			return nil, err
+		}
+		releaseManifest = append(append([]byte{}, releaseManifest...), hooks...)
+	}
+
+	currentValues, err := getValues(d.release, d.namespace, d.kubeContext, d.releaseFiles)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get values of release %s: %w", d.release, err)
+	}
+	newValues, err := d.mergeValues(currentValues)
+	if err != nil {
+		return nil, err
+	}
+
+	withOldValues, err := d.renderWithValues(ctx, currentValues)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := changedValues(currentValues, newValues)
+	byValuesKey := map[string]map[string]*manifest.MappingResult{}
+	switch {
+	case len(changes) == 1:
+		specs, err := d.parseRendered(installManifest)
+		if err != nil {
+			return nil, err
+		}
+		byValuesKey[changes[0].key] = specs
+	case len(changes) > maxExplainedValuesKeys:
+		_, _ = fmt.Fprintf(d.errOut, "Not naming the values keys responsible for the changes: %d values keys changed, at most %d are supported\n", len(changes), maxExplainedValuesKeys)
+	default:
+		for _, change := range changes {
+			specs, err := d.renderWithValues(ctx, change.applyTo(currentValues))
+			if err != nil {
+				return nil, err
+			}
+			byValuesKey[change.key] = specs
+		}
+	}
+
+	oldSpecs, err := d.parseRendered(releaseManifest)
+	if err != nil {
+		return nil, err
+	}
+	newSpecs, err := d.parseRendered(installManifest)
+	if err != nil {
+		return nil, err
+	}
+	return diff.Attribute(oldSpecs, withOldValues, newSpecs, byValuesKey), nil
+}
+
+// mergeValues returns the user-supplied values of the upgrade, the way helm upgrade would compute them.
+func (d *diffCmd) mergeValues(currentValues map[string]interface{}) (map[string]interface{}, error) {
+	opts := values.Options{
+		ValueFiles:    d.valueFiles,
+		StringValues:  d.stringValues,
+		Values:        d.values,
+		FileValues:    d.fileValues,
+		JSONValues:    d.jsonValues,
+		LiteralValues: d.stringLiteralValues,
+	}
+	newValues, err := opts.MergeValues(getter.All(prepareEnvSettings(d.kubeContext)))
+	if err != nil {
+		return nil, err
+	}
+
+	// see template for when helm reuses the values of the release
+	shouldDefaultReusingValues := len(d.values) == 0 && len(d.stringValues) == 0 && len(d.stringLiteralValues) == 0 && len(d.jsonValues) == 0 && len(d.valueFiles) == 0 && len(d.fileValues) == 0
+	if (d.reuseValues || d.resetThenReuseValues || shouldDefaultReusingValues) && !d.resetValues {
+		return loader.MergeMaps(currentValues, newValues), nil
+	}
+	return newValues, nil
+}
+
+// renderWithValues renders the chart with the given values instead of the values given on the command line.
+func (d *diffCmd) renderWithValues(ctx context.Context, vals map[string]interface{}) (map[string]*manifest.MappingResult, error) {
+	data, err := yaml.Marshal(vals)
+	if err != nil {
+		return nil, err
+	}
+	tmpfile, err := createTempFile("helm-diff-explain-values")
+	if err != nil {
+		return nil, err
+	}
+	defer removeTempFile(tmpfile.Name())
+	if _, err := tmpfile.Write(data); err != nil {
+		_ = tmpfile.Close()
+		return nil, err
+	}
+	if err := tmpfile.Close(); err != nil {
+		return nil, err
+	}
+
+	render := *d
+	render.valueFiles = valueFiles{tmpfile.Name()}
+	render.values = nil
+	render.stringValues = nil
+	render.stringLiteralValues = nil
+	render.jsonValues = nil
+	render.fileValues = nil
+	render.reuseValues = false
+	render.resetThenReuseValues = false
+	render.resetValues = true
+
+	out, err := render.template(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to render chart to explain the changes: %w", err)
+	}
+	return d.parseRendered(out)
+}
+
+func (d *diffCmd) parseRendered(rendered []byte) (map[string]*manifest.MappingResult, error) {
+	if d.includeTests {
+		return parseManifest(rendered, d.namespace, d.normalizeManifests)
+	}
+	return parseManifest(rendered, d.namespace, d.normalizeManifests, manifest.Helm3TestHook, manifest.Helm2TestSuccessHook)
+}
+
+// changedValues returns the values keys that differ between two sets of values, sorted by key.
+// Maps are compared key by key, any other value including lists as a whole.
+func changedValues(oldValues, newValues map[string]interface{}) []valuesChange {
+	var changes []valuesChange
+	var walk func(path []string, a, b map[string]interface{})
+	walk = func(path []string, a, b map[string]interface{}) {
+		for k, av := range a {
+			p := append(append([]string{}, path...), k)
+			bv, ok := b[k]
+			if !ok {
+				changes = append(changes, valuesChange{key: valuesKey(p), path: p, removed: true})
+				continue
+			}
+			am, aIsMap := av.(map[string]interface{})
+			bm, bIsMap := bv.(map[string]interface{})
+			if aIsMap && bIsMap {
+				walk(p, am, bm)
+				continue
+			}
+			if !reflect.DeepEqual(av, bv) {
+				changes = append(changes, valuesChange{key: valuesKey(p), path: p, value: bv})
+			}
+		}
+		for k, bv := range b {
+			if _, ok := a[k]; !ok {
+				p := append(append([]string{}, path...), k)
+				changes = append(changes, valuesChange{key: valuesKey(p), path: p, value: bv})
+			}
+		}
+	}
+	walk(nil, oldValues, newValues)
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].key < changes[j].key
+	})
+	return changes
+}
+
+// valuesKey joins a values path the way it is written for --set, escaping dots in keys.
+func valuesKey(path []string) string {
+	escaped := make([]string, len(path))
+	for i, p := range path {
+		escaped[i] = strings.ReplaceAll(p, ".", `\.`)
+	}
+	return strings.Join(escaped, ".")
+}
+
+// applyTo returns a copy of the values with only this change applied.
+func (c valuesChange) applyTo(vals map[string]interface{}) map[string]interface{} {
+	result := copyValues(vals)
+	m := result
+	for _, p := range c.path[:len(c.path)-1] {
+		next, ok := m[p].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[p] = next
+		}
+		m = next
+	}
+	last := c.path[len(c.path)-1]
+	if c.removed {
+		delete(m, last)
+	} else {
+		m[last] = c.value
+	}
+	return result
+}
+
+// copyValues copies the maps of the values, the other values are shared.
+func copyValues(vals map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(vals))
+	for k, v := range vals {
+		if m, ok := v.(map[string]interface{}); ok {
+			v = copyValues(m)
+		}
+		result[k] = v
+	}
+	return result
+}
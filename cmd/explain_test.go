@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedValues(t *testing.T) {
+	oldValues := map[string]interface{}{
+		"image": map[string]interface{}{
+			"repository": "nginx",
+			"tag":        "1.0",
+		},
+		"replicas":         float64(1),
+		"ports":            []interface{}{float64(80)},
+		"annotations":      map[string]interface{}{"example.com/owner": "a"},
+		"removed":          true,
+		"becomesScalarMap": map[string]interface{}{"a": "b"},
+	}
+	newValues := map[string]interface{}{
+		"image": map[string]interface{}{
+			"repository": "nginx",
+			"tag":        "2.0",
+		},
+		"replicas":         float64(1),
+		"ports":            []interface{}{float64(80), float64(443)},
+		"annotations":      map[string]interface{}{"example.com/owner": "b"},
+		"added":            "yes",
+		"becomesScalarMap": "b",
+	}
+
+	changes := changedValues(oldValues, newValues)
+	var keys []string
+	for _, change := range changes {
+		keys = append(keys, change.key)
+	}
+	require.Equal(t, []string{"added", `annotations.example\.com/owner`, "becomesScalarMap", "image.tag", "ports", "removed"}, keys)
+	require.Empty(t, changedValues(oldValues, oldValues))
+
+	for _, change := range changes {
+		applied := change.applyTo(oldValues)
+		require.Equal(t, []valuesChange{change}, changedValues(oldValues, applied), change.key)
+	}
+	require.Equal(t, "1.0", oldValues["image"].(map[string]interface{})["tag"], "applyTo must not modify the values it is applied to")
+}
+
+func TestMergeValues(t *testing.T) {
+	valuesFile := filepath.Join(t.TempDir(), "values.yaml")
+	require.NoError(t, os.WriteFile(valuesFile, []byte("image:\n  tag: \"2.0\"\n"), 0o600))
+	current := map[string]interface{}{
+		"image":    map[string]interface{}{"tag": "1.0"},
+		"replicas": float64(2),
+	}
+
+	t.Run("new values only", func(t *testing.T) {
+		d := &diffCmd{valueFiles: valueFiles{valuesFile}, values: []string{"service.port=8080"}}
+		merged, err := d.mergeValues(current)
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{
+			"image":   map[string]interface{}{"tag": "2.0"},
+			"service": map[string]interface{}{"port": int64(8080)},
+		}, merged)
+	})
+
+	t.Run("reuse values", func(t *testing.T) {
+		d := &diffCmd{valueFiles: valueFiles{valuesFile}, reuseValues: true}
+		merged, err := d.mergeValues(current)
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{
+			"image":    map[string]interface{}{"tag": "2.0"},
+			"replicas": float64(2),
+		}, merged)
+	})
+
+	t.Run("reuse by default without new values", func(t *testing.T) {
+		d := &diffCmd{}
+		merged, err := d.mergeValues(current)
+		require.NoError(t, err)
+		require.Equal(t, current, merged)
+	})
+
+	t.Run("reset values", func(t *testing.T) {
+		d := &diffCmd{resetValues: true}
+		merged, err := d.mergeValues(current)
+		require.NoError(t, err)
+		require.Empty(t, merged)
+	})
+}
@@ -2,17 +2,17 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"regexp"
 	"slices"
-	"strconv"
 	"strings"
 
 	"github.com/Masterminds/semver/v3"
+	"sigs.k8s.io/yaml"
 )
 
 // Source: cmd/helm/install.go
@@ -77,12 +77,12 @@ var (
 	minHelmVersionWithResetThenReuseValues = semver.MustParse("v3.14.0")
 )
 
-func getHelmVersion() (*semver.Version, error) {
-	cmd := exec.Command(os.Getenv("HELM_BIN"), "version")
+func getHelmVersion(ctx context.Context) (*semver.Version, error) {
+	cmd := helmCommand(ctx, "version")
 	debugPrint("Executing %s", strings.Join(cmd.Args, " "))
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return nil, fmt.Errorf("Failed to run `%s version`: %w", os.Getenv("HELM_BIN"), err)
+		return nil, fmt.Errorf("Failed to run `%s version`: %w", helmBin(), err)
 	}
 	versionOutput := string(output)
 
@@ -98,8 +98,8 @@ func getHelmVersion() (*semver.Version, error) {
 	return helmVersion, nil
 }
 
-func isHelmVersionAtLeast(versionToCompareTo *semver.Version) (bool, error) {
-	helmVersion, err := getHelmVersion()
+func isHelmVersionAtLeast(ctx context.Context, versionToCompareTo *semver.Version) (bool, error) {
+	helmVersion, err := getHelmVersion(ctx)
 
 	if err != nil {
 		return false, err
@@ -110,8 +110,8 @@ func isHelmVersionAtLeast(versionToCompareTo *semver.Version) (bool, error) {
 	return true, nil
 }
 
-func isHelmVersionGreaterThanEqual(versionToCompareTo *semver.Version) (bool, error) {
-	helmVersion, err := getHelmVersion()
+func isHelmVersionGreaterThanEqual(ctx context.Context, versionToCompareTo *semver.Version) (bool, error) {
+	helmVersion, err := getHelmVersion(ctx)
 
 	if err != nil {
 		return false, err
@@ -120,8 +120,12 @@ func isHelmVersionGreaterThanEqual(versionToCompareTo *semver.Version) (bool, er
 	return helmVersion.GreaterThanEqual(versionToCompareTo), nil
 }
 
-func compatibleHelm3Version() error {
-	isCompatible, err := isHelmVersionAtLeast(minHelmVersion)
+func compatibleHelm3Version(ctx context.Context) error {
+	if renderInProcess() {
+		// rendering with the Helm SDK, no helm to check
+		return nil
+	}
+	isCompatible, err := isHelmVersionAtLeast(ctx, minHelmVersion)
 	if err != nil {
 		return err
 	}
@@ -131,59 +135,78 @@ func compatibleHelm3Version() error {
 	return nil
 }
 
-func getRelease(release, namespace, kubeContext string) ([]byte, error) {
-	args := []string{"get", "manifest", release}
-	if namespace != "" {
-		args = append(args, "--namespace", namespace)
-	}
-	if kubeContext != "" {
-		args = append(args, "--kube-context", kubeContext)
-	}
-	cmd := exec.Command(os.Getenv("HELM_BIN"), args...)
-	return outputWithRichError(cmd)
+func getRelease(release, namespace, kubeContext string, releaseFiles []string) ([]byte, error) {
+	return getRevision(release, 0, namespace, kubeContext, releaseFiles)
 }
 
-func getHooks(release, namespace, kubeContext string) ([]byte, error) {
-	args := []string{"get", "hooks", release}
-	if namespace != "" {
-		args = append(args, "--namespace", namespace)
+func getHooks(release, namespace, kubeContext string, releaseFiles []string) ([]byte, error) {
+	rel, err := readRelease(release, 0, namespace, kubeContext, releaseFiles)
+	if err != nil {
+		return nil, err
 	}
-	if kubeContext != "" {
-		args = append(args, "--kube-context", kubeContext)
+	return hooksOutput(rel), nil
+}
+
+// getRevision returns the manifest of the given revision, or of the latest revision if revision is 0.
+func getRevision(release string, revision int, namespace, kubeContext string, releaseFiles []string) ([]byte, error) {
+	rel, err := readRelease(release, revision, namespace, kubeContext, releaseFiles)
+	if err != nil {
+		return nil, err
 	}
-	cmd := exec.Command(os.Getenv("HELM_BIN"), args...)
-	return outputWithRichError(cmd)
+	return manifestOutput(rel), nil
 }
 
-func getRevision(release string, revision int, namespace, kubeContext string) ([]byte, error) {
-	args := []string{"get", "manifest", release, "--revision", strconv.Itoa(revision)}
-	if namespace != "" {
-		args = append(args, "--namespace", namespace)
+func getHistory(release, namespace, kubeContext string, releaseFiles []string) ([]releaseRevision, error) {
+	r, err := getReleaseReader(namespace, kubeContext, releaseFiles)
+	if err != nil {
+		return nil, err
 	}
-	if kubeContext != "" {
-		args = append(args, "--kube-context", kubeContext)
+	revisions, err := r.revisions(release)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]releaseRevision, 0, len(revisions))
+	for _, rel := range revisions {
+		revision := releaseRevision{Revision: rel.Version}
+		if rel.Info != nil {
+			revision.Updated = rel.Info.LastDeployed
+			revision.Status = rel.Info.Status.String()
+		}
+		history = append(history, revision)
 	}
-	cmd := exec.Command(os.Getenv("HELM_BIN"), args...)
-	return outputWithRichError(cmd)
+	return history, nil
 }
 
-func getChart(release, namespace, kubeContext string) (string, error) {
-	args := []string{"get", "all", release, "--template", "{{.Release.Chart.Name}}"}
-	if namespace != "" {
-		args = append(args, "--namespace", namespace)
-	}
-	if kubeContext != "" {
-		args = append(args, "--kube-context", kubeContext)
+func getValues(release, namespace, kubeContext string, releaseFiles []string) (map[string]interface{}, error) {
+	rel, err := readRelease(release, 0, namespace, kubeContext, releaseFiles)
+	if err != nil {
+		return nil, err
 	}
-	cmd := exec.Command(os.Getenv("HELM_BIN"), args...)
-	out, err := outputWithRichError(cmd)
+	return releaseValues(rel, false)
+}
+
+func getChart(release, namespace, kubeContext string, releaseFiles []string) (string, error) {
+	rel, err := readRelease(release, 0, namespace, kubeContext, releaseFiles)
 	if err != nil {
 		return "", err
 	}
-	return string(out), nil
+	if rel.Chart == nil || rel.Chart.Metadata == nil {
+		return "", fmt.Errorf("release %s has no chart metadata", release)
+	}
+	return rel.Chart.Metadata.Name, nil
 }
 
-func (d *diffCmd) template(isUpgrade bool) ([]byte, error) {
+// template renders the chart of the upgrade and returns the manifest.
+func (d *diffCmd) template(ctx context.Context, isUpgrade bool) ([]byte, error) {
+	var out bytes.Buffer
+	if err := d.renderTo(ctx, isUpgrade, &out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// renderTo renders the chart of the upgrade and writes the manifest to w as helm outputs it.
+func (d *diffCmd) renderTo(ctx context.Context, isUpgrade bool, w io.Writer) error {
 	flags := []string{}
 	if d.devel {
 		flags = append(flags, "--devel")
@@ -215,36 +238,40 @@ func (d *diffCmd) template(isUpgrade bool) ([]byte, error) {
 	if d.insecureSkipTLSVerify {
 		flags = append(flags, "--insecure-skip-tls-verify")
 	}
+	// the values files in the order passed to helm, for rendering in-process
+	var renderValueFiles []string
 	// Helm automatically enable --reuse-values when there's no --set, --set-string, --set-json, --set-values, --set-file present.
 	// Let's simulate that in helm-diff.
 	// See https://medium.com/@kcatstack/understand-helm-upgrade-flags-reset-values-reuse-values-6e58ac8f127e
 	shouldDefaultReusingValues := isUpgrade && len(d.values) == 0 && len(d.stringValues) == 0 && len(d.stringLiteralValues) == 0 && len(d.jsonValues) == 0 && len(d.valueFiles) == 0 && len(d.fileValues) == 0
-	if (d.reuseValues || d.resetThenReuseValues || shouldDefaultReusingValues) && !d.resetValues && d.clusterAccessAllowed() {
-		tmpfile, err := os.CreateTemp("", "existing-values")
+	if (d.reuseValues || d.resetThenReuseValues || shouldDefaultReusingValues) && !d.resetValues && d.releaseReadAllowed() {
+		tmpfile, err := createTempFile("existing-values")
 		if err != nil {
-			return nil, err
+			return err
 		}
-		defer func() {
-			_ = os.Remove(tmpfile.Name())
-		}()
+		defer removeTempFile(tmpfile.Name())
 		// In the presence of --reuse-values (or --reset-values), --reset-then-reuse-values is ignored.
 		if d.resetThenReuseValues && !d.reuseValues {
-			var supported bool
-			supported, err = isHelmVersionAtLeast(minHelmVersionWithResetThenReuseValues)
-			if err != nil {
-				return nil, err
-			}
-			if !supported {
-				return nil, fmt.Errorf("Using --reset-then-reuse-values requires at least helm version %s", minHelmVersionWithResetThenReuseValues.String())
+			// the Helm SDK rendering in-process always supports it
+			if !renderInProcess() {
+				var supported bool
+				supported, err = isHelmVersionAtLeast(ctx, minHelmVersionWithResetThenReuseValues)
+				if err != nil {
+					return err
+				}
+				if !supported {
+					return fmt.Errorf("Using --reset-then-reuse-values requires at least helm version %s", minHelmVersionWithResetThenReuseValues.String())
+				}
 			}
 			err = d.writeExistingValues(tmpfile, false)
 		} else {
 			err = d.writeExistingValues(tmpfile, true)
 		}
 		if err != nil {
-			return nil, err
+			return err
 		}
 		flags = append(flags, "--values", tmpfile.Name())
+		renderValueFiles = append(renderValueFiles, tmpfile.Name())
 	}
 	for _, value := range d.values {
 		flags = append(flags, "--set", value)
@@ -262,35 +289,39 @@ func (d *diffCmd) template(isUpgrade bool) ([]byte, error) {
 		if strings.TrimSpace(valueFile) == "-" {
 			bytes, err := io.ReadAll(os.Stdin)
 			if err != nil {
-				return nil, err
+				return err
 			}
 
-			tmpfile, err := os.CreateTemp("", "helm-diff-stdin-values")
+			tmpfile, err := createTempFile("helm-diff-stdin-values")
 			if err != nil {
-				return nil, err
+				return err
 			}
-			defer func() {
-				_ = os.Remove(tmpfile.Name())
-			}()
+			defer removeTempFile(tmpfile.Name())
 
 			if _, err := tmpfile.Write(bytes); err != nil {
 				_ = tmpfile.Close()
-				return nil, err
+				return err
 			}
 
 			if err := tmpfile.Close(); err != nil {
-				return nil, err
+				return err
 			}
 
 			flags = append(flags, "--values", tmpfile.Name())
+			renderValueFiles = append(renderValueFiles, tmpfile.Name())
 		} else {
 			flags = append(flags, "--values", valueFile)
+			renderValueFiles = append(renderValueFiles, valueFile)
 		}
 	}
 	for _, fileValue := range d.fileValues {
 		flags = append(flags, "--set-file", fileValue)
 	}
 
+	if renderInProcess() {
+		return renderChartTo(ctx, d.renderOptions(isUpgrade, renderValueFiles), w)
+	}
+
 	if d.disableOpenAPIValidation {
 		flags = append(flags, "--disable-openapi-validation")
 	}
@@ -307,13 +338,10 @@ func (d *diffCmd) template(isUpgrade bool) ([]byte, error) {
 		flags = append(flags, "--take-ownership")
 	}
 
-	isHelmV4, _ := isHelmVersionGreaterThanEqual(helmV4Version)
+	isHelmV4, _ := isHelmVersionGreaterThanEqual(ctx, helmV4Version)
 	flags = append(flags, serverSideFlags(isHelmV4, d.useUpgradeDryRun, d.serverSide)...)
 
-	var (
-		subcmd string
-		filter func([]byte) []byte
-	)
+	var subcmd string
 
 	// `--dry-run=client` or `--dry-run=server`?
 	//
@@ -337,18 +365,15 @@ func (d *diffCmd) template(isUpgrade bool) ([]byte, error) {
 		// As HELM_DIFF_UPGRADE_DRY_RUN is there for producing more complete and correct diff results,
 		// we use --dry-run=server if the version of helm supports it.
 		// Otherwise, we use --dry-run=client, as that's the best we can do.
-		if useDryRunService, err := isHelmVersionAtLeast(minHelmVersionWithDryRunLookupSupport); err == nil && useDryRunService {
+		if useDryRunService, err := isHelmVersionAtLeast(ctx, minHelmVersionWithDryRunLookupSupport); err == nil && useDryRunService {
 			flags = append(flags, "--dry-run=server")
 		} else {
 			flags = append(flags, "--dry-run")
 		}
 		subcmd = "upgrade"
-		filter = func(s []byte) []byte {
-			return extractManifestFromHelmUpgradeDryRunOutput(s, d.noHooks)
-		}
 	} else {
 		if !d.disableValidation && d.clusterAccessAllowed() {
-			isHelmV4, err := isHelmVersionGreaterThanEqual(helmV4Version)
+			isHelmV4, err := isHelmVersionGreaterThanEqual(ctx, helmV4Version)
 			if err == nil && isHelmV4 {
 				// For Helm v4, we use --dry-run=server by default to get correct .Capabilities.APIVersions.
 				// This is only applied if the user hasn't explicitly set --dry-run=client, --dry-run=true, or --dry-run=false.
@@ -377,8 +402,8 @@ func (d *diffCmd) template(isUpgrade bool) ([]byte, error) {
 
 		// To keep the full compatibility with older helm-diff versions,
 		// we pass --dry-run to `helm template` only if Helm is greater than v3.13.0.
-		if useDryRunService, err := isHelmVersionAtLeast(minHelmVersionWithDryRunLookupSupport); err == nil && useDryRunService {
-			isHelmV4, _ := isHelmVersionGreaterThanEqual(helmV4Version)
+		if useDryRunService, err := isHelmVersionAtLeast(ctx, minHelmVersionWithDryRunLookupSupport); err == nil && useDryRunService {
+			isHelmV4, _ := isHelmVersionGreaterThanEqual(ctx, helmV4Version)
 
 			// For Helm v4, --dry-run=server may already have been added above when
 			// clusterAccessAllowed() is true and d.dryRunMode is not "client", "true", or "false".
@@ -410,38 +435,47 @@ func (d *diffCmd) template(isUpgrade bool) ([]byte, error) {
 		}
 
 		subcmd = "template"
-
-		filter = func(s []byte) []byte {
-			return stripOCIPullProgress(s)
-		}
 	}
 
 	args := []string{subcmd, d.release, d.chart}
 	args = append(args, flags...)
 
-	cmd := exec.Command(os.Getenv("HELM_BIN"), args...)
-	out, err := outputWithRichError(cmd)
-	return filter(out), err
+	cmd := helmCommand(ctx, args...)
+	if d.useUpgradeDryRun {
+		// the manifest and hooks are extracted from the whole output of helm upgrade
+		out, err := outputWithRichError(cmd)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(extractManifestFromHelmUpgradeDryRunOutput(out, d.noHooks))
+		return err
+	}
+	progress := &ociPullProgressWriter{w: w}
+	cmd.Stdout = progress
+	if err := runWithRichError(cmd); err != nil {
+		return err
+	}
+	return progress.Close()
 }
 
 func (d *diffCmd) writeExistingValues(f *os.File, all bool) error {
-	args := []string{"get", "values", d.release, "--output", "yaml"}
-	if all {
-		args = append(args, "--all")
-	}
-	if d.namespace != "" {
-		args = append(args, "--namespace", d.namespace)
-	}
-	if d.kubeContext != "" {
-		args = append(args, "--kube-context", d.kubeContext)
-	}
-	cmd := exec.Command(os.Getenv("HELM_BIN"), args...)
-	debugPrint("Executing %s", strings.Join(cmd.Args, " "))
 	defer func() {
 		_ = f.Close()
 	}()
-	cmd.Stdout = f
-	return cmd.Run()
+	rel, err := readRelease(d.release, 0, d.namespace, d.kubeContext, d.releaseFiles)
+	if err != nil {
+		return err
+	}
+	values, err := releaseValues(rel, all)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
 }
 
 func extractManifestFromHelmUpgradeDryRunOutput(s []byte, noHooks bool) []byte {
@@ -524,6 +558,44 @@ func stripOCIPullProgress(s []byte) []byte {
 	return ociPullProgressRE.ReplaceAll(s, []byte(""))
 }
 
+// ociPullProgressWriter writes what is written to it to w line by line, without Helm's OCI chart pull progress
+// lines, like stripOCIPullProgress. Close writes the last line if it does not end with a newline.
+type ociPullProgressWriter struct {
+	w    io.Writer
+	line []byte
+}
+
+func (p *ociPullProgressWriter) Write(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		i := bytes.IndexByte(b[n:], '\n')
+		if i < 0 {
+			p.line = append(p.line, b[n:]...)
+			return len(b), nil
+		}
+		p.line = append(p.line, b[n:n+i+1]...)
+		n += i + 1
+		if err := p.flush(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (p *ociPullProgressWriter) Close() error {
+	return p.flush()
+}
+
+func (p *ociPullProgressWriter) flush() error {
+	line := p.line
+	p.line = p.line[:0]
+	if len(line) == 0 || ociPullProgressRE.Match(line) {
+		return nil
+	}
+	_, err := p.w.Write(line)
+	return err
+}
+
 // serverSideFlags returns the --server-side flag(s) to forward to helm.
 //
 // The flag is Helm v4 only:
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bytes"
 	"reflect"
 	"slices"
 	"testing"
@@ -76,6 +77,21 @@ metadata:
 			if d := cmp.Diff(tc.want, string(got)); d != "" {
 				t.Errorf("unexpected diff: %s", d)
 			}
+
+			// helm output streamed in arbitrary chunks
+			var streamed bytes.Buffer
+			w := &ociPullProgressWriter{w: &streamed}
+			for i := range len(tc.in) {
+				if _, err := w.Write([]byte{tc.in[i]}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if d := cmp.Diff(tc.want, streamed.String()); d != "" {
+				t.Errorf("unexpected streamed diff: %s", d)
+			}
 		})
 	}
 }
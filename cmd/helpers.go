@@ -1,14 +1,19 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"k8s.io/client-go/util/homedir"
+
+	"github.com/databus23/helm-diff/v3/manifest"
 )
 
 var (
@@ -25,6 +30,42 @@ func debugPrint(format string, a ...interface{}) {
 	}
 }
 
+// helmWaitDelay is how long helm commands wait for their output once helm exited or was killed,
+// so that processes started by helm, like post-renderers, cannot keep them from returning.
+const helmWaitDelay = time.Second
+
+// helmBin returns the helm binary to run: $HELM_BIN when helm-diff runs as a helm plugin,
+// otherwise helm on PATH. It is empty when there is no helm.
+func helmBin() string {
+	if bin := os.Getenv("HELM_BIN"); bin != "" {
+		return bin
+	}
+	if bin, err := exec.LookPath("helm"); err == nil {
+		return bin
+	}
+	return ""
+}
+
+// helmCommand returns the command running helm with the arguments. Helm is killed when ctx is done.
+func helmCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, helmBin(), args...)
+	cmd.WaitDelay = helmWaitDelay
+	return cmd
+}
+
+// runWithRichError runs the command like outputWithRichError, but writes its output to cmd.Stdout.
+func runWithRichError(cmd *exec.Cmd) error {
+	debugPrint("Executing %s", strings.Join(cmd.Args, " "))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		return fmt.Errorf("%s: %s", exitError.Error(), stderr.String())
+	}
+	return err
+}
+
 func outputWithRichError(cmd *exec.Cmd) ([]byte, error) {
 	debugPrint("Executing %s", strings.Join(cmd.Args, " "))
 	output, err := cmd.Output()
@@ -34,3 +75,8 @@ func outputWithRichError(cmd *exec.Cmd) ([]byte, error) {
 	}
 	return output, err
 }
+
+// parseManifest parses the manifest like manifest.Parse, but returns the error reading it instead of exiting.
+func parseManifest(data []byte, namespace string, normalizeManifests bool, excludedHooks ...string) (map[string]*manifest.MappingResult, error) {
+	return manifest.ParseWithOptions(data, manifest.ParseOptions{DefaultNamespace: namespace, NormalizeManifests: normalizeManifests, ExcludedHooks: excludedHooks})
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -34,6 +35,30 @@ func captureStdout(f func()) (string, error) {
 	return buf.String(), nil
 }
 
+// withoutHelm unsets HELM_BIN and replaces PATH by an empty directory, which it returns,
+// so that charts are rendered in-process.
+func withoutHelm(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HELM_BIN", "")
+	t.Setenv("PATH", dir)
+	return dir
+}
+
+func TestHelmBin(t *testing.T) {
+	dir := withoutHelm(t)
+	require.Empty(t, helmBin())
+	require.True(t, renderInProcess())
+
+	helm := filepath.Join(dir, "helm")
+	require.NoError(t, os.WriteFile(helm, []byte("#!/bin/sh\n"), 0o755))
+	require.Equal(t, helm, helmBin())
+	require.False(t, renderInProcess())
+
+	t.Setenv("HELM_BIN", "/opt/helm/bin/helm")
+	require.Equal(t, "/opt/helm/bin/helm", helmBin())
+}
+
 func TestCaptureStdout(t *testing.T) {
 	output, err := captureStdout(func() {
 		_, _ = os.Stdout.Write([]byte("test"))
@@ -1,52 +1,74 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/databus23/helm-diff/v3/diff"
 	"github.com/databus23/helm-diff/v3/manifest"
 )
 
 type local struct {
-	chart1              string
-	chart2              string
-	release             string
-	namespace           string
-	detailedExitCode    bool
-	includeTests        bool
-	includeCRDs         bool
-	normalizeManifests  bool
-	enableDNS           bool
-	valueFiles          valueFiles
-	values              []string
-	stringValues        []string
-	stringLiteralValues []string
-	jsonValues          []string
-	fileValues          []string
-	postRenderer        string
-	postRendererArgs    []string
-	extraAPIs           []string
-	kubeVersion         string
+	chart1                string
+	chart2                string
+	chart1Version         string
+	chart2Version         string
+	chartRepo             string
+	insecureSkipTLSVerify bool
+	release               string
+	namespace             string
+	detailedExitCode      bool
+	includeTests          bool
+	includeCRDs           bool
+	normalizeManifests    bool
+	enableDNS             bool
+	valueFiles            valueFiles
+	values                []string
+	stringValues          []string
+	stringLiteralValues   []string
+	jsonValues            []string
+	fileValues            []string
+	postRenderer          string
+	postRendererArgs      []string
+	extraAPIs             []string
+	kubeVersion           string
+	apiDeprecations       apiDeprecationFlags
+	saveReport            string
+	side1                 sideValues
+	side2                 sideValues
 	diff.Options
 }
 
+// sideValues are values applied to the render of one side of the comparison only,
+// on top of the values applied to both sides.
+type sideValues struct {
+	valueFiles   valueFiles
+	values       []string
+	stringValues []string
+}
+
 const localCmdLongUsage = `
 This command compares the manifests of two local chart directories.
 
 It renders both charts using 'helm template' and shows the differences
 between the resulting manifests.
 
+Values given with --values1, --set1 and --set-string1 are applied to CHART1
+only, those given with --values2, --set2 and --set-string2 to CHART2 only.
+Both charts may be the same, to compare two sets of values.
+
 This is useful for:
  - Comparing different versions of a chart
  - Previewing changes before committing
  - Validating chart modifications
+ - Comparing the values of two environments
 `
 
 func localCmd() *cobra.Command {
@@ -62,6 +84,7 @@ func localCmd() *cobra.Command {
 			"  helm diff local ./chart-v1 ./chart-v2",
 			"  helm diff local ./chart-v1 ./chart-v2 -f values.yaml",
 			"  helm diff local /path/to/chart-a /path/to/chart-b --set replicas=3",
+			"  helm diff local ./chart ./chart --values1 staging.yaml --values2 prod.yaml",
 		}, "\n"),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cmd.SilenceUsage = true
@@ -79,27 +102,13 @@ func localCmd() *cobra.Command {
 				diff.namespace = os.Getenv("HELM_NAMESPACE")
 			}
 
-			return diff.run()
+			return diff.run(cmd.Context())
 		},
 	}
 
-	localCmd.Flags().StringVar(&diff.release, "release", "release", "release name to use for template rendering")
-	localCmd.Flags().StringVar(&diff.namespace, "namespace", "", "namespace to use for template rendering")
-	localCmd.Flags().BoolVar(&diff.detailedExitCode, "detailed-exitcode", false, "return a non-zero exit code when there are changes")
-	localCmd.Flags().BoolVar(&diff.includeTests, "include-tests", false, "enable the diffing of the helm test hooks")
-	localCmd.Flags().BoolVar(&diff.includeCRDs, "include-crds", false, "include CRDs in the diffing")
-	localCmd.Flags().BoolVar(&diff.normalizeManifests, "normalize-manifests", false, "normalize manifests before running diff to exclude style differences from the output")
-	localCmd.Flags().BoolVar(&diff.enableDNS, "enable-dns", false, "enable DNS lookups when rendering templates")
-	localCmd.Flags().VarP(&diff.valueFiles, "values", "f", "specify values in a YAML file (can specify multiple)")
-	localCmd.Flags().StringArrayVar(&diff.values, "set", []string{}, "set values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
-	localCmd.Flags().StringArrayVar(&diff.stringValues, "set-string", []string{}, "set STRING values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
-	localCmd.Flags().StringArrayVar(&diff.stringLiteralValues, "set-literal", []string{}, "set STRING literal values on the command line")
-	localCmd.Flags().StringArrayVar(&diff.jsonValues, "set-json", []string{}, "set JSON values on the command line (can specify multiple or separate values with commas: key1=jsonval1,key2=jsonval2)")
-	localCmd.Flags().StringArrayVar(&diff.fileValues, "set-file", []string{}, "set values from respective files specified via the command line (can specify multiple or separate values with commas: key1=path1,key2=path2)")
-	localCmd.Flags().StringVar(&diff.postRenderer, "post-renderer", "", "the path to an executable to be used for post rendering. If it exists in $PATH, the binary will be used, otherwise it will try to look for the executable at the given path")
-	localCmd.Flags().StringArrayVar(&diff.postRendererArgs, "post-renderer-args", []string{}, "an argument to the post-renderer (can specify multiple)")
-	localCmd.Flags().StringArrayVarP(&diff.extraAPIs, "api-versions", "a", []string{}, "Kubernetes api versions used for Capabilities.APIVersions")
-	localCmd.Flags().StringVar(&diff.kubeVersion, "kube-version", "", "Kubernetes version used for Capabilities.KubeVersion")
+	addRenderFlags(localCmd.Flags(), &diff)
+	addSideValuesFlags(localCmd.Flags(), &diff.side1, "1", "CHART1")
+	addSideValuesFlags(localCmd.Flags(), &diff.side2, "2", "CHART2")
 
 	AddDiffOptions(localCmd.Flags(), &diff.Options)
 
@@ -108,7 +117,47 @@ func localCmd() *cobra.Command {
 	return localCmd
 }
 
-func (l *local) run() error {
+// addRenderFlags registers the flags controlling how charts are rendered with 'helm template'.
+func addRenderFlags(f *pflag.FlagSet, l *local) {
+	f.StringVar(&l.release, "release", "release", "release name to use for template rendering")
+	f.StringVar(&l.namespace, "namespace", "", "namespace to use for template rendering")
+	f.BoolVar(&l.detailedExitCode, "detailed-exitcode", false, "return a non-zero exit code when there are changes")
+	f.BoolVar(&l.includeTests, "include-tests", false, "enable the diffing of the helm test hooks")
+	f.BoolVar(&l.includeCRDs, "include-crds", false, "include CRDs in the diffing")
+	f.BoolVar(&l.normalizeManifests, "normalize-manifests", false, "normalize manifests before running diff to exclude style differences from the output")
+	f.BoolVar(&l.enableDNS, "enable-dns", false, "enable DNS lookups when rendering templates")
+	f.VarP(&l.valueFiles, "values", "f", "specify values in a YAML file (can specify multiple)")
+	f.StringArrayVar(&l.values, "set", []string{}, "set values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	f.StringArrayVar(&l.stringValues, "set-string", []string{}, "set STRING values on the command line (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	f.StringArrayVar(&l.stringLiteralValues, "set-literal", []string{}, "set STRING literal values on the command line")
+	f.StringArrayVar(&l.jsonValues, "set-json", []string{}, "set JSON values on the command line (can specify multiple or separate values with commas: key1=jsonval1,key2=jsonval2)")
+	f.StringArrayVar(&l.fileValues, "set-file", []string{}, "set values from respective files specified via the command line (can specify multiple or separate values with commas: key1=path1,key2=path2)")
+	f.StringVar(&l.postRenderer, "post-renderer", "", "the path to an executable to be used for post rendering. If it exists in $PATH, the binary will be used, otherwise it will try to look for the executable at the given path")
+	f.StringArrayVar(&l.postRendererArgs, "post-renderer-args", []string{}, "an argument to the post-renderer (can specify multiple)")
+	f.StringArrayVarP(&l.extraAPIs, "api-versions", "a", []string{}, "Kubernetes api versions used for Capabilities.APIVersions")
+	f.StringVar(&l.kubeVersion, "kube-version", "", "Kubernetes version used for Capabilities.KubeVersion")
+	addAPIDeprecationFlags(f, &l.apiDeprecations, "--kube-version")
+	addSaveReportFlag(f, &l.saveReport)
+}
+
+// addSideValuesFlags registers the flags for values applied to the render of one chart only.
+func addSideValuesFlags(f *pflag.FlagSet, v *sideValues, suffix, chart string) {
+	f.Var(&v.valueFiles, "values"+suffix, "specify values in a YAML file for rendering "+chart+" only, on top of --values (can specify multiple)")
+	f.StringArrayVar(&v.values, "set"+suffix, []string{}, "set values on the command line for rendering "+chart+" only, on top of --set (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+	f.StringArrayVar(&v.stringValues, "set-string"+suffix, []string{}, "set STRING values on the command line for rendering "+chart+" only, on top of --set-string (can specify multiple or separate values with commas: key1=val1,key2=val2)")
+}
+
+func (l *local) run(ctx context.Context) error {
+	if l.apiDeprecations.enabled() {
+		if l.kubeVersion == "" {
+			return errors.New("--check-deprecated-apis, --fail-on-deprecated-apis and --fail-on-removed-apis need --kube-version")
+		}
+		if _, err := diff.ParseKubeVersion(l.kubeVersion); err != nil {
+			return err
+		}
+		l.KubeVersion = l.kubeVersion
+	}
+
 	cleanup, err := l.prepareStdinValues()
 	if err != nil {
 		return err
@@ -122,20 +171,39 @@ func (l *local) run() error {
 		excludes = []string{}
 	}
 
-	manifest1, err := l.renderChart(l.chart1)
+	manifest1, err := l.renderChart(ctx, l.chart1, l.chart1Version, l.side1)
+	if err != nil {
+		return fmt.Errorf("failed to render chart %q: %w", chartReference(l.chart1, l.chart1Version), err)
+	}
+	specs1, err := parseManifest(manifest1, l.namespace, l.normalizeManifests, excludes...)
 	if err != nil {
-		return fmt.Errorf("failed to render chart %q: %w", l.chart1, err)
+		return fmt.Errorf("failed to parse chart %q: %w", chartReference(l.chart1, l.chart1Version), err)
 	}
-	specs1 := manifest.Parse(manifest1, l.namespace, l.normalizeManifests, excludes...)
 	manifest1 = nil //nolint:ineffassign // nil to allow GC to reclaim raw bytes before rendering the second chart
 
-	manifest2, err := l.renderChart(l.chart2)
+	manifest2, err := l.renderChart(ctx, l.chart2, l.chart2Version, l.side2)
+	if err != nil {
+		return fmt.Errorf("failed to render chart %q: %w", chartReference(l.chart2, l.chart2Version), err)
+	}
+	specs2, err := parseManifest(manifest2, l.namespace, l.normalizeManifests, excludes...)
 	if err != nil {
-		return fmt.Errorf("failed to render chart %q: %w", l.chart2, err)
+		return fmt.Errorf("failed to parse chart %q: %w", chartReference(l.chart2, l.chart2Version), err)
 	}
-	specs2 := manifest.Parse(manifest2, l.namespace, l.normalizeManifests, excludes...)
 
-	seenAnyChanges := diff.Manifests(specs1, specs2, &l.Options, os.Stdout)
+	seenAnyChanges, err := printReport(ctx, specs1, specs2, nil, &l.Options, os.Stdout, l.saveReport)
+	if err != nil {
+		return err
+	}
+
+	if err := resourceErrors(specs1, specs2); err != nil {
+		return err
+	}
+
+	if l.apiDeprecations.enabled() {
+		if err := l.apiDeprecations.checkAPIDeprecations(l.KubeVersion, specs2); err != nil {
+			return err
+		}
+	}
 
 	if l.detailedExitCode && seenAnyChanges {
 		return Error{
@@ -147,49 +215,79 @@ func (l *local) run() error {
 	return nil
 }
 
+// prepareStdinValues reads the values given as "-" from stdin once into a temporary file,
+// which replaces "-" in the values files of both sides.
 func (l *local) prepareStdinValues() (func(), error) {
 	var name string
 
-	for i, valueFile := range l.valueFiles {
-		if strings.TrimSpace(valueFile) == "-" {
+	for _, files := range []valueFiles{l.valueFiles, l.side1.valueFiles, l.side2.valueFiles} {
+		for i, valueFile := range files {
+			if strings.TrimSpace(valueFile) != "-" {
+				continue
+			}
 			if name == "" {
 				data, err := io.ReadAll(os.Stdin)
 				if err != nil {
 					return nil, err
 				}
 
-				tmpfile, err := os.CreateTemp("", "helm-diff-stdin-values")
+				tmpfile, err := createTempFile("helm-diff-stdin-values")
 				if err != nil {
 					return nil, err
 				}
 
 				if _, err := tmpfile.Write(data); err != nil {
 					_ = tmpfile.Close()
-					_ = os.Remove(tmpfile.Name())
+					removeTempFile(tmpfile.Name())
 					return nil, err
 				}
 
 				if err := tmpfile.Close(); err != nil {
-					_ = os.Remove(tmpfile.Name())
+					removeTempFile(tmpfile.Name())
 					return nil, err
 				}
 
 				name = tmpfile.Name()
 			}
 
-			l.valueFiles[i] = name
+			files[i] = name
 		}
 	}
 
 	if name != "" {
-		return func() { _ = os.Remove(name) }, nil
+		return func() { removeTempFile(name) }, nil
 	}
 	return nil, nil
 }
 
-func (l *local) renderChart(chartPath string) ([]byte, error) {
+// chartReference formats a chart and an optional version for messages.
+func chartReference(chart, version string) string {
+	if version == "" {
+		return chart
+	}
+	return chart + "@" + version
+}
+
+// renderChart renders one side of the comparison, applying the values of that side after the values of both sides.
+func (l *local) renderChart(ctx context.Context, chartPath, chartVersion string, side sideValues) ([]byte, error) {
+	if renderInProcess() {
+		return renderChart(ctx, l.renderOptions(chartPath, chartVersion, side))
+	}
+
 	flags := []string{}
 
+	if chartVersion != "" {
+		flags = append(flags, "--version", chartVersion)
+	}
+
+	if l.chartRepo != "" {
+		flags = append(flags, "--repo", l.chartRepo)
+	}
+
+	if l.insecureSkipTLSVerify {
+		flags = append(flags, "--insecure-skip-tls-verify")
+	}
+
 	if l.includeCRDs {
 		flags = append(flags, "--include-crds")
 	}
@@ -206,15 +304,15 @@ func (l *local) renderChart(chartPath string) ([]byte, error) {
 		flags = append(flags, "--post-renderer-args", arg)
 	}
 
-	for _, valueFile := range l.valueFiles {
+	for _, valueFile := range append(append([]string{}, l.valueFiles...), side.valueFiles...) {
 		flags = append(flags, "--values", valueFile)
 	}
 
-	for _, value := range l.values {
+	for _, value := range append(append([]string{}, l.values...), side.values...) {
 		flags = append(flags, "--set", value)
 	}
 
-	for _, stringValue := range l.stringValues {
+	for _, stringValue := range append(append([]string{}, l.stringValues...), side.stringValues...) {
 		flags = append(flags, "--set-string", stringValue)
 	}
 
@@ -245,11 +343,7 @@ func (l *local) renderChart(chartPath string) ([]byte, error) {
 	args := []string{"template", l.release, chartPath}
 	args = append(args, flags...)
 
-	helmBin := os.Getenv("HELM_BIN")
-	if helmBin == "" {
-		helmBin = "helm"
-	}
-	cmd := exec.Command(helmBin, args...)
+	cmd := helmCommand(ctx, args...)
 	out, err := outputWithRichError(cmd)
 	return stripOCIPullProgress(out), err
 }
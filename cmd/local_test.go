@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"strings"
 	"testing"
@@ -363,3 +364,275 @@ func setupFakeHelmDual(t *testing.T, manifest1, manifest2 string) {
 	t.Setenv("HELM_DIFF_FAKE_OUTPUT_1", manifest1)
 	t.Setenv("HELM_DIFF_FAKE_OUTPUT_2", manifest2)
 }
+
+func TestLocalCmdSideValuesArgs(t *testing.T) {
+	argsFile := t.TempDir() + "/args"
+	setupFakeHelm(t, "capture_args", "", argsFile, "")
+
+	chart := t.TempDir()
+
+	cmd := localCmd()
+	cmd.SetArgs([]string{chart, chart, "-f", "common.yaml", "--values1", "staging.yaml", "--values2", "prod.yaml", "--set", "a=1", "--set1", "b=1", "--set2", "b=2", "--set-string2", "c=2"})
+
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Expected no error but got: %v", err)
+	}
+
+	// the fake helm captures the arguments of the last render, that of CHART2
+	args, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("Expected fake helm args file to be readable, but got: %v", err)
+	}
+	for _, expected := range []string{"--values common.yaml --values prod.yaml", "--set a=1 --set b=2", "--set-string c=2"} {
+		if !strings.Contains(string(args), expected) {
+			t.Errorf("Expected %q in helm template args, got: %q", expected, string(args))
+		}
+	}
+	for _, unexpected := range []string{"staging.yaml", "b=1"} {
+		if strings.Contains(string(args), unexpected) {
+			t.Errorf("Expected no %q in helm template args of CHART2, got: %q", unexpected, string(args))
+		}
+	}
+}
+
+func TestLocalCmdSideValuesSameChart(t *testing.T) {
+	withoutHelm(t)
+	chart := writeChart(t, "1.0")
+	staging := t.TempDir() + "/staging.yaml"
+	if err := os.WriteFile(staging, []byte("image:\n  tag: \"1.1\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := captureStdout(func() {
+		cmd := localCmd()
+		cmd.SetArgs([]string{chart, chart, "--values1", staging, "--set2", "image.tag=2.0", "--output", "simple"})
+		if execErr := cmd.Execute(); execErr != nil {
+			t.Errorf("Expected no error but got: %v", execErr)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Failed to capture stdout: %v", err)
+	}
+	if !strings.Contains(output, "release-app, ConfigMap (v1) to be changed.") {
+		t.Errorf("Expected the ConfigMap to change between the values of both sides, got: %q", output)
+	}
+
+	output, err = captureStdout(func() {
+		cmd := localCmd()
+		cmd.SetArgs([]string{chart, chart, "--values1", staging, "--set2", "image.tag=1.1"})
+		if execErr := cmd.Execute(); execErr != nil {
+			t.Errorf("Expected no error but got: %v", execErr)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Failed to capture stdout: %v", err)
+	}
+	if output != "" {
+		t.Errorf("Expected no changes when both sides render the same values, got: %q", output)
+	}
+}
+
+func TestLocalCmdResourceErrors(t *testing.T) {
+	manifest1 := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-config
+  namespace: default
+data:
+  key: value1
+`
+	manifest2 := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-config
+  namespace: default
+data:
+  key: value2
+---
+kind: [
+`
+	setupFakeHelmDual(t, manifest1, manifest2)
+
+	chart1 := t.TempDir()
+	chart2 := t.TempDir()
+
+	cmd := localCmd()
+	cmd.SetArgs([]string{chart1, chart2})
+
+	var err error
+	output, captureErr := captureStdout(func() {
+		err = cmd.Execute()
+	})
+	if captureErr != nil {
+		t.Fatal(captureErr)
+	}
+
+	var diffErr Error
+	if !errors.As(err, &diffErr) {
+		t.Fatalf("Expected Error type but got %T: %v", err, err)
+	}
+	if diffErr.Code != resourceErrorCode {
+		t.Errorf("Expected exit code %d but got %d", resourceErrorCode, diffErr.Code)
+	}
+	if !strings.Contains(output, "default, test-config, ConfigMap (v1) has changed:") {
+		t.Errorf("Expected the diff of the valid resource but got:\n%s", output)
+	}
+	if !strings.Contains(output, "document 2 could not be diffed:") {
+		t.Errorf("Expected an ERROR entry of the invalid document but got:\n%s", output)
+	}
+}
+
+func TestLocalCmdFailOnDeprecatedAPIs(t *testing.T) {
+	manifest1 := `---
+apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: test-pdb
+  namespace: default
+spec:
+  minAvailable: 1
+`
+	manifest2 := `---
+apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: test-pdb
+  namespace: default
+spec:
+  minAvailable: 2
+`
+	setupFakeHelmDual(t, manifest1, manifest2)
+
+	chart1 := t.TempDir()
+	chart2 := t.TempDir()
+
+	cmd := localCmd()
+	cmd.SetArgs([]string{chart1, chart2, "--kube-version", "1.25.0", "--fail-on-deprecated-apis"})
+
+	var err error
+	output, captureErr := captureStdout(func() {
+		err = cmd.Execute()
+	})
+	if captureErr != nil {
+		t.Fatal(captureErr)
+	}
+
+	var diffErr Error
+	if !errors.As(err, &diffErr) {
+		t.Fatalf("Expected Error type but got %T: %v", err, err)
+	}
+	if diffErr.Code != deprecatedAPICode {
+		t.Errorf("Expected exit code %d but got %d", deprecatedAPICode, diffErr.Code)
+	}
+	if !strings.Contains(output, "policy/v1beta1 PodDisruptionBudget removed in 1.25, use policy/v1") {
+		t.Errorf("Expected a warning of the removed API but got:\n%s", output)
+	}
+}
+
+func TestLocalCmdFailOnRemovedAPIs(t *testing.T) {
+	// autoscaling/v2beta2 is deprecated in 1.25 but removed in 1.26 only
+	hpa := `---
+apiVersion: autoscaling/v2beta2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: test-hpa
+  namespace: default
+spec:
+  maxReplicas: %d
+`
+	for kubeVersion, failing := range map[string]bool{"1.25.0": false, "1.26.0": true} {
+		setupFakeHelmDual(t, fmt.Sprintf(hpa, 2), fmt.Sprintf(hpa, 3))
+
+		cmd := localCmd()
+		cmd.SetArgs([]string{t.TempDir(), t.TempDir(), "--kube-version", kubeVersion, "--fail-on-removed-apis"})
+
+		var err error
+		if _, captureErr := captureStdout(func() {
+			err = cmd.Execute()
+		}); captureErr != nil {
+			t.Fatal(captureErr)
+		}
+
+		var diffErr Error
+		if failing != errors.As(err, &diffErr) {
+			t.Fatalf("Expected failing %v in Kubernetes %s but got %v", failing, kubeVersion, err)
+		}
+		if failing && diffErr.Code != deprecatedAPICode {
+			t.Errorf("Expected exit code %d but got %d", deprecatedAPICode, diffErr.Code)
+		}
+		if !failing && err != nil {
+			t.Errorf("Expected no error in Kubernetes %s but got %v", kubeVersion, err)
+		}
+	}
+}
+
+func TestLocalCmdCheckDeprecatedAPIsNeedsKubeVersion(t *testing.T) {
+	cmd := localCmd()
+	cmd.SetArgs([]string{t.TempDir(), t.TempDir(), "--check-deprecated-apis"})
+
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "need --kube-version") {
+		t.Errorf("Expected an error asking for --kube-version but got %v", err)
+	}
+}
+
+func TestLocalCmdSaveReportAndRender(t *testing.T) {
+	manifest1 := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-config
+  namespace: default
+data:
+  key: value1
+`
+	manifest2 := `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: test-config
+  namespace: default
+data:
+  key: value2
+`
+	setupFakeHelmDual(t, manifest1, manifest2)
+
+	reportFile := t.TempDir() + "/report.json"
+	cmd := localCmd()
+	cmd.SetArgs([]string{t.TempDir(), t.TempDir(), "--save-report", reportFile, "--output", "simple"})
+	output, err := captureStdout(func() {
+		if err := cmd.Execute(); err != nil {
+			t.Error(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output, "default, test-config, ConfigMap (v1) to be changed.") {
+		t.Errorf("Expected the simple output but got:\n%s", output)
+	}
+
+	for format, expected := range map[string]string{
+		"diff":     "+   key: value2",
+		"markdown": "### `default, test-config, ConfigMap (v1)` has changed",
+	} {
+		render := renderCmd()
+		render.SetArgs([]string{reportFile, "--output", format, "--detailed-exitcode"})
+		var renderErr error
+		output, err := captureStdout(func() {
+			renderErr = render.Execute()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected the %s output to contain %q but got:\n%s", format, expected, output)
+		}
+		var diffErr Error
+		if !errors.As(renderErr, &diffErr) || diffErr.Code != 2 {
+			t.Errorf("Expected exit code 2 for the changes of the report but got %v", renderErr)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 func shouldRunFakeHelm() bool {
@@ -48,6 +49,9 @@ func TestMain(m *testing.M) {
 			} else {
 				fmt.Print(os.Getenv("HELM_DIFF_FAKE_OUTPUT_2"))
 			}
+		case "hang":
+			// a helm stalled on a registry, until it is killed
+			time.Sleep(time.Minute)
 		case "capture_args":
 			argsFile := os.Getenv("HELM_DIFF_FAKE_ARGS_FILE")
 			if argsFile != "" {
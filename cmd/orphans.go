@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+const (
+	releaseNameAnnotation      = "meta.helm.sh/release-name"
+	releaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+	resourcePolicyAnnotation   = "helm.sh/resource-policy"
+	hookAnnotation             = "helm.sh/hook"
+)
+
+// orphan is a cluster object annotated as part of a release that the release does not manage anymore.
+type orphan struct {
+	*manifest.MappingResult
+	resourcePolicy string
+}
+
+// objectKey identifies an object regardless of the API version it is read in,
+// as the cluster lists objects in the preferred version of their group only.
+type objectKey struct {
+	group     string
+	kind      string
+	namespace string
+	name      string
+}
+
+// findOrphansInCluster connects to the cluster and calls findOrphans.
+func findOrphansInCluster(ctx context.Context, getter genericclioptions.RESTClientGetter, namespace, release string, specs ...map[string]*manifest.MappingResult) ([]orphan, []string, error) {
+	discoveryClient, err := getter.ToDiscoveryClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	restConfig, err := getter.ToRESTConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return findOrphans(ctx, discoveryClient, dynamicClient, namespace, release, specs...)
+}
+
+// findOrphans lists the objects of all kinds in the namespace that carry the annotations of the release
+// but are part of none of the given specs, e.g. objects kept by helm.sh/resource-policy: keep.
+// Objects created by controllers, like the ReplicaSets of a Deployment, and hooks are skipped,
+// as releases do not list hooks among their objects.
+// It also returns the resource types that could not be listed, e.g. for lack of permissions,
+// whose orphans are missing.
+func findOrphans(ctx context.Context, discoveryClient discovery.DiscoveryInterface, client dynamic.Interface, namespace, release string, specs ...map[string]*manifest.MappingResult) ([]orphan, []string, error) {
+	keys, err := specKeys(namespace, specs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resourceLists, err := discovery.ServerPreferredNamespacedResources(discoveryClient)
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return nil, nil, fmt.Errorf("failed to discover the resources of the cluster: %w", err)
+	}
+	resourceLists = discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list"}}, resourceLists)
+
+	var (
+		orphans  []orphan
+		unlisted []string
+	)
+	for _, resourceList := range resourceLists {
+		gv, err := schema.ParseGroupVersion(resourceList.GroupVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, resource := range resourceList.APIResources {
+			if strings.Contains(resource.Name, "/") {
+				continue
+			}
+			objects, err := client.Resource(gv.WithResource(resource.Name)).Namespace(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				if apierrors.IsForbidden(err) || apierrors.IsNotFound(err) || apierrors.IsMethodNotSupported(err) {
+					unlisted = append(unlisted, gv.WithResource(resource.Name).GroupResource().String())
+					continue
+				}
+				return nil, nil, fmt.Errorf("failed to list %s in namespace %s: %w", resource.Name, namespace, err)
+			}
+			for i := range objects.Items {
+				object := &objects.Items[i]
+				annotations := object.GetAnnotations()
+				if annotations[releaseNameAnnotation] != release || annotations[releaseNamespaceAnnotation] != namespace {
+					continue
+				}
+				if _, hook := annotations[hookAnnotation]; hook || metav1.GetControllerOf(object) != nil {
+					continue
+				}
+				if keys[objectKey{group: gv.Group, kind: object.GetKind(), namespace: object.GetNamespace(), name: object.GetName()}] {
+					continue
+				}
+				result, _, err := manifest.ParseObject(object, namespace)
+				if err != nil {
+					return nil, nil, err
+				}
+				orphans = append(orphans, orphan{MappingResult: result, resourcePolicy: annotations[resourcePolicyAnnotation]})
+			}
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Name < orphans[j].Name
+	})
+	sort.Strings(unlisted)
+	return orphans, unlisted, nil
+}
+
+// specKeys returns the keys of the objects of the specs, whose namespace defaults to the given one.
+func specKeys(namespace string, specs []map[string]*manifest.MappingResult) (map[objectKey]bool, error) {
+	keys := map[objectKey]bool{}
+	for _, spec := range specs {
+		for _, result := range spec {
+			if result.Err != nil {
+				continue
+			}
+			var object struct {
+				APIVersion string `json:"apiVersion"`
+				Kind       string `json:"kind"`
+				Metadata   struct {
+					Name      string `json:"name"`
+					Namespace string `json:"namespace"`
+				} `json:"metadata"`
+			}
+			if err := yaml.Unmarshal([]byte(result.Content), &object); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", result.Name, err)
+			}
+			gv, err := schema.ParseGroupVersion(object.APIVersion)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the apiVersion of %s: %w", result.Name, err)
+			}
+			if object.Metadata.Namespace == "" {
+				object.Metadata.Namespace = namespace
+			}
+			keys[objectKey{group: gv.Group, kind: object.Kind, namespace: object.Metadata.Namespace, name: object.Metadata.Name}] = true
+		}
+	}
+	return keys, nil
+}
+
+// printOrphans lists the orphans, followed by the resource types that could not be listed.
+func printOrphans(to io.Writer, namespace, release string, orphans []orphan, unlisted []string) {
+	if len(orphans) > 0 {
+		_, _ = fmt.Fprintf(to, "Found %d orphaned resources of release %s/%s, not part of the release or the rendered chart:\n", len(orphans), namespace, release)
+		for _, o := range orphans {
+			if o.resourcePolicy != "" {
+				_, _ = fmt.Fprintf(to, "  %s (resource-policy: %s)\n", o.Name, o.resourcePolicy)
+			} else {
+				_, _ = fmt.Fprintf(to, "  %s\n", o.Name)
+			}
+		}
+	}
+	if len(unlisted) > 0 {
+		_, _ = fmt.Fprintf(to, "Unable to list %d resource types in namespace %s, so their orphaned resources are missing: %s\n", len(unlisted), namespace, strings.Join(unlisted, ", "))
+	}
+}
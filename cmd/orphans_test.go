@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	kubetesting "k8s.io/client-go/testing"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+func annotatedObject(kind, name, release string, annotations map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind(kind)
+	obj.SetNamespace("default")
+	obj.SetName(name)
+	if release != "" {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[releaseNameAnnotation] = release
+		annotations[releaseNamespaceAnnotation] = "default"
+	}
+	obj.SetAnnotations(annotations)
+	return obj
+}
+
+func TestFindOrphans(t *testing.T) {
+	discoveryClient := &fakediscovery.FakeDiscovery{Fake: &kubetesting.Fake{}}
+	discoveryClient.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}},
+				{Name: "secrets", Kind: "Secret", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}},
+				{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}},
+				{Name: "serviceaccounts", Kind: "ServiceAccount", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}},
+				{Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: metav1.Verbs{"create"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "replicasets", Kind: "ReplicaSet", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}},
+			},
+		},
+		{
+			GroupVersion: "autoscaling/v2",
+			APIResources: []metav1.APIResource{
+				{Name: "horizontalpodautoscalers", Kind: "HorizontalPodAutoscaler", Namespaced: true, Verbs: metav1.Verbs{"get", "list"}},
+			},
+		},
+	}
+
+	// ReplicaSets carry the annotations of the pod template of their Deployment
+	replicaSet := annotatedObject("ReplicaSet", "web-5d4f8", "my-release", nil)
+	replicaSet.SetAPIVersion("apps/v1")
+	controller := true
+	replicaSet.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "web", UID: "1", Controller: &controller}})
+
+	// the chart writes the HorizontalPodAutoscaler with another version than the preferred one
+	autoscaler := annotatedObject("HorizontalPodAutoscaler", "web", "my-release", nil)
+	autoscaler.SetAPIVersion("autoscaling/v2")
+
+	client := fakedynamic.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			{Version: "v1", Resource: "configmaps"}:                                     "ConfigMapList",
+			{Version: "v1", Resource: "secrets"}:                                        "SecretList",
+			{Version: "v1", Resource: "pods"}:                                           "PodList",
+			{Version: "v1", Resource: "serviceaccounts"}:                                "ServiceAccountList",
+			{Group: "apps", Version: "v1", Resource: "replicasets"}:                     "ReplicaSetList",
+			{Group: "autoscaling", Version: "v2", Resource: "horizontalpodautoscalers"}: "HorizontalPodAutoscalerList",
+		},
+		annotatedObject("ConfigMap", "managed", "my-release", nil),
+		annotatedObject("ConfigMap", "kept", "my-release", map[string]string{resourcePolicyAnnotation: "keep"}),
+		annotatedObject("ConfigMap", "other", "other-release", nil),
+		annotatedObject("ConfigMap", "unmanaged", "", nil),
+		annotatedObject("Secret", "leftover", "my-release", nil),
+		annotatedObject("Pod", "test", "my-release", map[string]string{hookAnnotation: manifest.Helm3TestHook}),
+		annotatedObject("Secret", "migration", "my-release", map[string]string{hookAnnotation: "pre-install,pre-upgrade"}),
+		replicaSet,
+		autoscaler,
+	)
+
+	client.PrependReactor("list", "serviceaccounts", func(kubetesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "serviceaccounts"}, "", errors.New("no access"))
+	})
+
+	specs := manifest.Parse([]byte(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: managed
+  namespace: default
+---
+apiVersion: autoscaling/v2beta2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+`), "default", false)
+
+	orphans, unlisted, err := findOrphans(context.Background(), discoveryClient, client, "default", "my-release", specs)
+	require.NoError(t, err)
+	require.Equal(t, []string{"serviceaccounts"}, unlisted)
+
+	var out bytes.Buffer
+	printOrphans(&out, "default", "my-release", orphans, unlisted)
+	require.Equal(t, `Found 2 orphaned resources of release default/my-release, not part of the release or the rendered chart:
+  default, kept, ConfigMap (v1) (resource-policy: keep)
+  default, leftover, Secret (v1)
+Unable to list 1 resource types in namespace default, so their orphaned resources are missing: serviceaccounts
+`, out.String())
+}
@@ -1,23 +1,34 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
 
 	"github.com/databus23/helm-diff/v3/diff"
 	"github.com/databus23/helm-diff/v3/manifest"
 )
 
 type release struct {
-	kubeContext        string
-	detailedExitCode   bool
-	releases           []string
-	includeTests       bool
-	normalizeManifests bool
+	kubeContext          string
+	detailedExitCode     bool
+	releases             []string
+	baseline             string
+	matrix               bool
+	allowDifferentCharts bool
+	sourceMappingFile    string
+	includeTests         bool
+	normalizeManifests   bool
+	// out and errOut are where the diffs and the diagnostics are written to.
+	out    io.Writer
+	errOut io.Writer
 	diff.Options
 }
 
@@ -32,12 +43,31 @@ It can be used to compare the manifests of
    Example:
 	$ helm diff release my-prod my-stage
 	$ helm diff release prod/my-prod stage/my-stage
+
+ - a baseline release with any number of other releases
+	$ helm diff release [flags] release1 release2 release3 ...
+   Every release is compared against the first one, or against the one given by --baseline.
+   Use --matrix to print a summary of which resources differ in which release instead.
+   Example:
+	$ helm diff release prod/app stage/app dev/app
+	$ helm diff release --baseline prod/app --matrix dev/app stage/app prod/app
+
+Releases created from different charts are only compared with --allow-different-charts.
+Their resources are then matched by source template path relative to the chart, e.g.
+"templates/deployment.yaml". Templates that were moved or renamed between the charts
+can be paired with a mapping file of source template paths:
+
+	fork/templates/deploy.yaml: upstream/templates/deployment.yaml
+	fork/templates/svc.yaml: upstream/templates/service.yaml
+
+   Example:
+	$ helm diff release --allow-different-charts --source-mapping mapping.yaml my-fork my-upstream
 `
 
 func releaseCmd() *cobra.Command {
 	diff := release{}
 	releaseCmd := &cobra.Command{
-		Use:   "release [flags] RELEASE release1 [release2]",
+		Use:   "release [flags] RELEASE1 RELEASE2 [RELEASE...]",
 		Short: "Shows diff between release's manifests",
 		Long:  releaseCmdLongUsage,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -54,10 +84,25 @@ func releaseCmd() *cobra.Command {
 				return errors.New("Too few arguments to Command \"release\".\nMinimum 2 arguments required: release name-1, release name-2")
 			}
 
+			if diff.baseline != "" && !slices.Contains(args, diff.baseline) {
+				return fmt.Errorf("baseline release %q must be one of the compared releases", diff.baseline)
+			}
+
 			ProcessDiffOptions(cmd.Flags(), &diff.Options)
 
+			if diff.sourceMappingFile != "" {
+				mapping, err := readSourceMapping(diff.sourceMappingFile)
+				if err != nil {
+					return err
+				}
+				diff.SourceMapping = mapping
+			}
+			diff.IgnoreChartName = diff.allowDifferentCharts
+
 			diff.releases = args[0:]
-			return diff.differentiateHelm3()
+			diff.out = cmd.OutOrStdout()
+			diff.errOut = cmd.ErrOrStderr()
+			return diff.differentiateHelm3(cmd.Context())
 		},
 	}
 
@@ -65,6 +110,10 @@ func releaseCmd() *cobra.Command {
 	releaseCmd.Flags().BoolVar(&diff.includeTests, "include-tests", false, "enable the diffing of the helm test hooks")
 	releaseCmd.Flags().BoolVar(&diff.normalizeManifests, "normalize-manifests", false, "normalize manifests before running diff to exclude style differences from the output")
 	releaseCmd.Flags().StringVar(&diff.kubeContext, "kube-context", "", "name of the kubeconfig context to use")
+	releaseCmd.Flags().StringVar(&diff.baseline, "baseline", "", "release every other release is compared against. Defaults to the first release")
+	releaseCmd.Flags().BoolVar(&diff.matrix, "matrix", false, "print a summary of which resources differ from the baseline in which release instead of the diffs. Printed as JSON with --output structured")
+	releaseCmd.Flags().BoolVar(&diff.allowDifferentCharts, "allow-different-charts", false, "compare releases created from different charts by matching resources on their source template path relative to the chart")
+	releaseCmd.Flags().StringVar(&diff.sourceMappingFile, "source-mapping", "", "YAML file mapping source template paths of one chart to the paths of the corresponding templates in another chart")
 	AddDiffOptions(releaseCmd.Flags(), &diff.Options)
 
 	releaseCmd.SuggestionsMinimumDistance = 1
@@ -72,62 +121,174 @@ func releaseCmd() *cobra.Command {
 	return releaseCmd
 }
 
-func (d *release) differentiateHelm3() error {
-	excludes := []string{manifest.Helm3TestHook, manifest.Helm2TestSuccessHook}
-	if d.includeTests {
-		excludes = []string{}
-	}
+// releaseManifest holds the manifest and chart name of a deployed release.
+type releaseManifest struct {
+	name      string
+	namespace string
+	manifest  []byte
+	chart     string
+}
 
-	namespace1 := os.Getenv("HELM_NAMESPACE")
-	release1 := d.releases[0]
-	if strings.Contains(release1, "/") {
-		namespace1 = strings.Split(release1, "/")[0]
-		release1 = strings.Split(release1, "/")[1]
+func (d *release) fetch(name string) (*releaseManifest, error) {
+	r := &releaseManifest{
+		name:      name,
+		namespace: os.Getenv("HELM_NAMESPACE"),
 	}
-	releaseResponse1, err := getRelease(release1, namespace1, d.kubeContext)
+	releaseName := name
+	if strings.Contains(name, "/") {
+		r.namespace = strings.Split(name, "/")[0]
+		releaseName = strings.Split(name, "/")[1]
+	}
+
+	var err error
+	r.manifest, err = getRelease(releaseName, r.namespace, d.kubeContext, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	releaseChart1, err := getChart(release1, namespace1, d.kubeContext)
+	r.chart, err = getChart(releaseName, r.namespace, d.kubeContext, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return r, nil
+}
 
-	namespace2 := os.Getenv("HELM_NAMESPACE")
-	release2 := d.releases[1]
-	if strings.Contains(release2, "/") {
-		namespace2 = strings.Split(release2, "/")[0]
-		release2 = strings.Split(release2, "/")[1]
-	}
-	releaseResponse2, err := getRelease(release2, namespace2, d.kubeContext)
+func (r *releaseManifest) parse(d *release, excludes []string) (map[string]*manifest.MappingResult, error) {
+	specs, err := parseManifest(r.manifest, r.namespace, d.normalizeManifests, excludes...)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to parse the manifest of release %s: %w", r.name, err)
 	}
-	releaseChart2, err := getChart(release2, namespace2, d.kubeContext)
-	if err != nil {
-		return err
+	return specs, nil
+}
+
+func (d *release) differentiateHelm3(ctx context.Context) error {
+	excludes := []string{manifest.Helm3TestHook, manifest.Helm2TestSuccessHook}
+	if d.includeTests {
+		excludes = []string{}
+	}
+
+	baselineName := d.baseline
+	if baselineName == "" {
+		baselineName = d.releases[0]
 	}
 
-	if releaseChart1 == releaseChart2 {
-		oldSpecs := manifest.Parse(releaseResponse1, namespace1, d.normalizeManifests, excludes...)
-		newSpecs := manifest.Parse(releaseResponse2, namespace2, d.normalizeManifests, excludes...)
-		releaseResponse1 = nil //nolint:ineffassign // nil to allow GC to reclaim raw bytes before diff computation
-		releaseResponse2 = nil //nolint:ineffassign // nil to allow GC to reclaim raw bytes before diff computation
+	var (
+		baseline *releaseManifest
+		others   []*releaseManifest
+	)
+	for _, name := range d.releases {
+		r, err := d.fetch(name)
+		if err != nil {
+			return err
+		}
+		if name == baselineName && baseline == nil {
+			baseline = r
+			continue
+		}
+		others = append(others, r)
+	}
 
-		seenAnyChanges := diff.Releases(
-			oldSpecs,
-			newSpecs,
-			&d.Options,
-			os.Stdout)
+	if !d.allowDifferentCharts {
+		for _, r := range others {
+			if r.chart != baseline.chart {
+				return fmt.Errorf("incomparable releases: unable to compare releases from two different charts %q, %q. Use --allow-different-charts to compare them anyway, try helm diff release --help to know more", baseline.chart, r.chart)
+			}
+		}
+	}
 
-		if d.detailedExitCode && seenAnyChanges {
-			return Error{
-				error: errors.New("identified at least one change, exiting with non-zero exit code (detailed-exitcode parameter enabled)"),
-				Code:  2,
+	var seenAnyChanges bool
+	var parsed []map[string]*manifest.MappingResult
+	if d.matrix {
+		names := make([]string, 0, len(others))
+		indexes := make([]map[string]*manifest.MappingResult, 0, len(others))
+		for _, r := range others {
+			names = append(names, r.name)
+			index, err := r.parse(d, excludes)
+			if err != nil {
+				return err
 			}
+			indexes = append(indexes, index)
+		}
+		baselineIndex, err := baseline.parse(d, excludes)
+		if err != nil {
+			return err
 		}
+		parsed = append(append(parsed, baselineIndex), indexes...)
+		matrix, err := diff.ReleasesMatrix(baseline.name, baselineIndex, names, indexes, &d.Options)
+		if err != nil {
+			return err
+		}
+		if err := matrix.Print(&d.Options, d.out); err != nil {
+			return err
+		}
+		seenAnyChanges = matrix.HasChanges()
 	} else {
-		fmt.Printf("Error : Incomparable Releases \n Unable to compare releases from two different charts \"%s\", \"%s\". \n try helm diff release --help to know more \n", releaseChart1, releaseChart2)
+		for _, r := range others {
+			// Only announce every comparison when there is more than one,
+			// so that the output of a plain two-release diff stays unchanged.
+			// Machine-readable diffs get the heading on errOut, to keep them parseable.
+			if len(others) > 1 {
+				to := d.out
+				if !isTextOutput(d.OutputFormat) {
+					to = d.errOut
+				}
+				_, _ = fmt.Fprintf(to, "Comparing %s with %s:\n", baseline.name, r.name)
+			}
+			// Both indexes are parsed anew for every comparison because
+			// the diff redacts secrets in place.
+			baselineIndex, err := baseline.parse(d, excludes)
+			if err != nil {
+				return err
+			}
+			index, err := r.parse(d, excludes)
+			if err != nil {
+				return err
+			}
+			parsed = append(parsed, baselineIndex, index)
+			changes, err := diff.PrintReleases(ctx, baselineIndex, index, &d.Options, d.out)
+			if err != nil {
+				return err
+			}
+			if changes {
+				seenAnyChanges = true
+			}
+		}
+	}
+
+	if err := resourceErrors(parsed...); err != nil {
+		return err
+	}
+
+	if d.detailedExitCode && seenAnyChanges {
+		return Error{
+			error: errors.New("identified at least one change, exiting with non-zero exit code (detailed-exitcode parameter enabled)"),
+			Code:  2,
+		}
 	}
 	return nil
 }
+
+// isTextOutput returns true for the built-in output formats meant to be read by humans,
+// in which additional headings do not break the output. Registered and external formats
+// may be machine-readable, so they are not.
+func isTextOutput(format string) bool {
+	switch format {
+	case "", "diff", "simple", "dyff", "markdown":
+		return true
+	default:
+		return false
+	}
+}
+
+// readSourceMapping reads a YAML map of source template paths to the paths
+// of the templates they should be compared with.
+func readSourceMapping(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading source mapping: %w", err)
+	}
+	mapping := map[string]string{}
+	if err := yaml.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("parsing source mapping %s: %w", path, err)
+	}
+	return mapping, nil
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSourceMapping(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "mapping.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("fork/templates/deploy.yaml: upstream/templates/deployment.yaml\n"), 0644))
+	mapping, err := readSourceMapping(path)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"fork/templates/deploy.yaml": "upstream/templates/deployment.yaml"}, mapping)
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	require.NoError(t, os.WriteFile(invalid, []byte("- not a map\n"), 0644))
+	_, err = readSourceMapping(invalid)
+	require.Error(t, err)
+
+	_, err = readSourceMapping(filepath.Join(dir, "missing.yaml"))
+	require.Error(t, err)
+}
+
+func TestReleaseCmdBaselineValidation(t *testing.T) {
+	cmd := releaseCmd()
+	cmd.SetArgs([]string{"--baseline", "prod/app", "stage/app", "dev/app"})
+	require.ErrorContains(t, cmd.Execute(), `baseline release "prod/app" must be one of the compared releases`)
+}
+
+func TestReleaseCmdComparisonHeadings(t *testing.T) {
+	setupMemoryDriver(t)
+	var data string
+	for _, name := range []string{"prod", "stage", "dev"} {
+		data += "- name: " + name + "\n  namespace: my-ns\n  version: 1\n  info:\n    status: deployed\n  chart:\n    metadata:\n      name: my-chart\n" +
+			"  manifest: |\n    ---\n    # Source: my-chart/templates/cm.yaml\n    apiVersion: v1\n    kind: ConfigMap\n    metadata:\n      name: app\n    data:\n      env: " + name + "\n"
+	}
+	path := filepath.Join(t.TempDir(), "releases.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+	t.Setenv("HELM_MEMORY_DRIVER_DATA", path)
+
+	for _, tc := range []struct {
+		output      string
+		outHeadings bool
+	}{
+		{output: "diff", outHeadings: true},
+		{output: "json"},
+		{output: "structured"},
+	} {
+		t.Run(tc.output, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			cmd := releaseCmd()
+			cmd.SetOut(&out)
+			cmd.SetErr(&errOut)
+			cmd.SetArgs([]string{"--output", tc.output, "my-ns/prod", "my-ns/stage", "my-ns/dev"})
+			require.NoError(t, cmd.Execute())
+
+			if tc.outHeadings {
+				require.Contains(t, out.String(), "Comparing my-ns/prod with my-ns/stage:\n")
+				require.Contains(t, out.String(), "Comparing my-ns/prod with my-ns/dev:\n")
+				require.Empty(t, errOut.String())
+				return
+			}
+			require.NotContains(t, out.String(), "Comparing")
+			require.Equal(t, "Comparing my-ns/prod with my-ns/stage:\nComparing my-ns/prod with my-ns/dev:\n", errOut.String())
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"helm.sh/helm/v4/pkg/action"
+	releasev1 "helm.sh/helm/v4/pkg/release/v1"
+	"helm.sh/helm/v4/pkg/storage"
+	"helm.sh/helm/v4/pkg/storage/driver"
+	"sigs.k8s.io/yaml"
+)
+
+const releaseFileUsage = "read the release from a Secret or ConfigMap of the Helm storage exported with kubectl get -o yaml or -o json instead of the cluster, e.g. sh.helm.release.v1.my-release.v7 (can specify multiple, a List holds multiple records)"
+
+// storageObject is a Secret or ConfigMap of the Helm storage, or a List of them.
+type storageObject struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Data  map[string]string `json:"data"`
+	Items []storageObject   `json:"items"`
+}
+
+// readReleaseFile returns the release records of a file exported from the Helm storage.
+func readReleaseFile(path string) ([]*releasev1.Release, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var obj storageObject
+	if err := yaml.Unmarshal(b, &obj); err != nil {
+		return nil, fmt.Errorf("unable to parse release file %s: %w", path, err)
+	}
+	releases, err := obj.releases()
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode release file %s: %w", path, err)
+	}
+	return releases, nil
+}
+
+func (o storageObject) releases() ([]*releasev1.Release, error) {
+	switch o.Kind {
+	case "List", "SecretList", "ConfigMapList":
+		var releases []*releasev1.Release
+		for _, item := range o.Items {
+			r, err := item.releases()
+			if err != nil {
+				return nil, err
+			}
+			releases = append(releases, r...)
+		}
+		return releases, nil
+	case "Secret", "ConfigMap":
+	default:
+		return nil, fmt.Errorf("expected a Secret or a ConfigMap of the Helm storage, got %q", o.Kind)
+	}
+
+	data, ok := o.Data["release"]
+	if !ok {
+		return nil, fmt.Errorf("%s %s has no release record", o.Kind, o.Metadata.Name)
+	}
+	if o.Kind == "Secret" {
+		// data of Secrets is base64 encoded once more
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", o.Kind, o.Metadata.Name, err)
+		}
+		data = string(decoded)
+	}
+	rel, err := decodeRelease(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", o.Kind, o.Metadata.Name, err)
+	}
+	return []*releasev1.Release{rel}, nil
+}
+
+// decodeRelease decodes a release record the way the Secret and ConfigMap drivers of Helm store it:
+// JSON, gzipped unless written by old versions of Helm, base64 encoded.
+func decodeRelease(data string) (*releasev1.Release, error) {
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > 3 && bytes.Equal(b[0:3], []byte{0x1f, 0x8b, 0x08}) {
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = r.Close()
+		}()
+		if b, err = io.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+	var rel releasev1.Release
+	if err := json.Unmarshal(b, &rel); err != nil {
+		return nil, err
+	}
+	return &rel, nil
+}
+
+// releaseFilesConfiguration returns a configuration whose storage holds the records of the release files.
+// Without a namespace, the namespace of the first record is used.
+func releaseFilesConfiguration(paths []string, namespace string) (*action.Configuration, error) {
+	mem := driver.NewMemory()
+	cfg := &action.Configuration{Releases: storage.Init(mem)}
+	for _, path := range paths {
+		releases, err := readReleaseFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, rel := range releases {
+			if namespace == "" {
+				namespace = rel.Namespace
+			}
+			if err := cfg.Releases.Create(rel); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	mem.SetNamespace(namespace)
+	return cfg, nil
+}
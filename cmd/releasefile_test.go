@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	chart "helm.sh/helm/v4/pkg/chart/v2"
+	rcommon "helm.sh/helm/v4/pkg/release/common"
+	releasev1 "helm.sh/helm/v4/pkg/release/v1"
+)
+
+// encodeRelease encodes a release record like the Secret and ConfigMap drivers of Helm.
+func encodeRelease(t *testing.T, rel *releasev1.Release) string {
+	t.Helper()
+	b, err := json.Marshal(rel)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err = w.Write(b)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func testRelease(revision int, status rcommon.Status, manifest string) *releasev1.Release {
+	return &releasev1.Release{
+		Name:      "app",
+		Namespace: "prod",
+		Version:   revision,
+		Info:      &releasev1.Info{Status: status},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "app"}},
+		Config:    map[string]interface{}{"image": map[string]interface{}{"tag": "1.0"}},
+		Manifest:  manifest,
+		Hooks:     []*releasev1.Hook{{Path: "app/templates/job.yaml", Manifest: "kind: Job"}},
+	}
+}
+
+func writeReleaseFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "release.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func secretRecord(t *testing.T, rel *releasev1.Release) string {
+	t.Helper()
+	return `apiVersion: v1
+kind: Secret
+metadata:
+  name: sh.helm.release.v1.app.v1
+type: helm.sh/release.v1
+data:
+  release: ` + base64.StdEncoding.EncodeToString([]byte(encodeRelease(t, rel))) + "\n"
+}
+
+func TestReadReleaseFile(t *testing.T) {
+	rel := testRelease(1, rcommon.StatusDeployed, "kind: ConfigMap")
+
+	t.Run("secret", func(t *testing.T) {
+		releases, err := readReleaseFile(writeReleaseFile(t, secretRecord(t, rel)))
+		require.NoError(t, err)
+		require.Len(t, releases, 1)
+		require.Equal(t, "kind: ConfigMap", releases[0].Manifest)
+		require.Equal(t, rel.Config, releases[0].Config)
+		require.Equal(t, "kind: Job", releases[0].Hooks[0].Manifest)
+	})
+
+	t.Run("configmap as json", func(t *testing.T) {
+		b, err := json.Marshal(map[string]interface{}{
+			"kind":     "ConfigMap",
+			"metadata": map[string]interface{}{"name": "app.v1"},
+			"data":     map[string]interface{}{"release": encodeRelease(t, rel)},
+		})
+		require.NoError(t, err)
+		releases, err := readReleaseFile(writeReleaseFile(t, string(b)))
+		require.NoError(t, err)
+		require.Len(t, releases, 1)
+		require.Equal(t, 1, releases[0].Version)
+	})
+
+	t.Run("uncompressed record", func(t *testing.T) {
+		b, err := json.Marshal(rel)
+		require.NoError(t, err)
+		decoded, err := decodeRelease(base64.StdEncoding.EncodeToString(b))
+		require.NoError(t, err)
+		require.Equal(t, "app", decoded.Name)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		content := "kind: List\nitems:\n- kind: ConfigMap\n  data:\n    release: " + encodeRelease(t, rel) +
+			"\n- kind: ConfigMap\n  data:\n    release: " + encodeRelease(t, testRelease(2, rcommon.StatusDeployed, "")) + "\n"
+		releases, err := readReleaseFile(writeReleaseFile(t, content))
+		require.NoError(t, err)
+		require.Len(t, releases, 2)
+		require.Equal(t, 2, releases[1].Version)
+	})
+
+	t.Run("not a release record", func(t *testing.T) {
+		_, err := readReleaseFile(writeReleaseFile(t, "kind: Deployment\n"))
+		require.ErrorContains(t, err, `expected a Secret or a ConfigMap of the Helm storage, got "Deployment"`)
+
+		_, err = readReleaseFile(writeReleaseFile(t, "kind: Secret\nmetadata:\n  name: other\ndata:\n  token: eA==\n"))
+		require.ErrorContains(t, err, "Secret other has no release record")
+	})
+}
+
+func TestReleaseFiles(t *testing.T) {
+	setupMemoryDriver(t)
+
+	content := "kind: SecretList\nitems:\n"
+	for _, rel := range []*releasev1.Release{
+		testRelease(6, rcommon.StatusSuperseded, "kind: ConfigMap\nrevision: 6"),
+		testRelease(7, rcommon.StatusDeployed, "kind: ConfigMap\nrevision: 7"),
+	} {
+		content += "- kind: Secret\n  data:\n    release: " + base64.StdEncoding.EncodeToString([]byte(encodeRelease(t, rel))) + "\n"
+	}
+	releaseFiles := []string{writeReleaseFile(t, content)}
+
+	out, err := getRelease("app", "", "", releaseFiles)
+	require.NoError(t, err)
+	require.Equal(t, "kind: ConfigMap\nrevision: 7\n", string(out))
+
+	out, err = getRevision("app", 6, "prod", "", releaseFiles)
+	require.NoError(t, err)
+	require.Equal(t, "kind: ConfigMap\nrevision: 6\n", string(out))
+
+	hooks, err := getHooks("app", "prod", "", releaseFiles)
+	require.NoError(t, err)
+	require.Equal(t, "---\n# Source: app/templates/job.yaml\nkind: Job\n", string(hooks))
+
+	_, err = getRelease("app", "staging", "", releaseFiles)
+	require.ErrorContains(t, err, "not found")
+
+	// the storage of the cluster is read by the commands without release files
+	_, err = getRelease("app", "prod", "", nil)
+	require.ErrorContains(t, err, "not found")
+}
+
+func TestUpgradeWithReleaseFile(t *testing.T) {
+	withoutHelm(t)
+	setupMemoryDriver(t)
+
+	rel := testRelease(7, rcommon.StatusDeployed, `---
+# Source: app/templates/cm.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-app
+data:
+  tag: "0.9"
+`)
+	rel.Hooks = nil
+	releaseFile := writeReleaseFile(t, secretRecord(t, rel))
+
+	var out bytes.Buffer
+	cmd := newChartCommand()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"app", writeChart(t, "0.1"), "--release-file", releaseFile, "--dry-run=client", "--no-hooks", "--output", "simple"})
+	require.NoError(t, cmd.Execute())
+	require.Contains(t, out.String(), "app-app, ConfigMap (v1) to be changed.")
+	require.Contains(t, out.String(), "Plan: 0 to add, 1 to change, 0 to destroy")
+
+	// the values of the release are reused
+	out.Reset()
+	cmd = newChartCommand()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"app", writeChart(t, "0.1"), "--release-file", releaseFile, "--dry-run=client", "--no-hooks"})
+	require.NoError(t, cmd.Execute())
+	require.Contains(t, out.String(), `tag: "1.0"`)
+	require.NotContains(t, out.String(), `tag: "0.1"`)
+}
@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"helm.sh/helm/v4/pkg/action"
+	"helm.sh/helm/v4/pkg/chart"
+	"helm.sh/helm/v4/pkg/chart/common"
+	chartloader "helm.sh/helm/v4/pkg/chart/loader"
+	"helm.sh/helm/v4/pkg/cli"
+	"helm.sh/helm/v4/pkg/cli/values"
+	"helm.sh/helm/v4/pkg/getter"
+	"helm.sh/helm/v4/pkg/postrenderer"
+	"helm.sh/helm/v4/pkg/registry"
+)
+
+// renderInProcess tells whether charts are rendered with the Helm SDK instead of a helm subprocess.
+// This is the case when helm-diff runs as a standalone binary and there is no helm on PATH.
+func renderInProcess() bool {
+	return helmBin() == ""
+}
+
+// renderOptions are the inputs of an in-process render, named after the helm template flags.
+type renderOptions struct {
+	release                  string
+	chart                    string
+	chartVersion             string
+	chartRepo                string
+	namespace                string
+	kubeContext              string
+	devel                    bool
+	insecureSkipTLSVerify    bool
+	noHooks                  bool
+	includeCRDs              bool
+	isUpgrade                bool
+	enableDNS                bool
+	skipSchemaValidation     bool
+	disableOpenAPIValidation bool
+	takeOwnership            bool
+	postRenderer             string
+	postRendererArgs         []string
+	extraAPIs                []string
+	kubeVersion              string
+	values                   values.Options
+
+	// server renders with access to the cluster, like helm template --dry-run=server.
+	// The capabilities then come from the cluster and lookup functions work.
+	server bool
+}
+
+// renderChart renders the chart like helm template does and returns the same output:
+// the manifest followed by the hooks unless noHooks is set.
+func renderChart(ctx context.Context, o renderOptions) ([]byte, error) {
+	var out bytes.Buffer
+	if err := renderChartTo(ctx, o, &out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// renderChartTo renders the chart like renderChart and writes the output to w.
+func renderChartTo(ctx context.Context, o renderOptions, w io.Writer) error {
+	settings := prepareEnvSettings(o.kubeContext)
+	if o.namespace != "" {
+		settings.SetNamespace(o.namespace)
+	}
+
+	cfg := new(action.Configuration)
+	if err := cfg.Init(settings.RESTClientGetter(), settings.Namespace(), os.Getenv("HELM_DRIVER")); err != nil {
+		return err
+	}
+
+	client := action.NewInstall(cfg)
+	client.DryRunStrategy = action.DryRunClient
+	if o.server {
+		client.DryRunStrategy = action.DryRunServer
+	}
+	client.ReleaseName = o.release
+	client.Namespace = settings.Namespace()
+	client.Replace = true
+	client.IsUpgrade = o.isUpgrade
+	client.Devel = o.devel
+	client.DisableHooks = o.noHooks
+	client.IncludeCRDs = o.includeCRDs
+	client.EnableDNS = o.enableDNS
+	client.SkipSchemaValidation = o.skipSchemaValidation
+	client.DisableOpenAPIValidation = o.disableOpenAPIValidation
+	client.TakeOwnership = o.takeOwnership
+	client.Version = o.chartVersion
+	client.RepoURL = o.chartRepo
+	client.InsecureSkipTLSVerify = o.insecureSkipTLSVerify
+	client.APIVersions = common.VersionSet(o.extraAPIs)
+
+	if o.kubeVersion != "" {
+		kubeVersion, err := common.ParseKubeVersion(o.kubeVersion)
+		if err != nil {
+			return fmt.Errorf("invalid kube version %q: %w", o.kubeVersion, err)
+		}
+		client.KubeVersion = kubeVersion
+	}
+
+	if o.postRenderer != "" {
+		pr, err := newPostRenderer(ctx, settings, o.postRenderer, o.postRendererArgs)
+		if err != nil {
+			return err
+		}
+		client.PostRenderer = pr
+	}
+
+	registryClient, err := registry.NewClient(
+		registry.ClientOptCredentialsFile(settings.RegistryConfig),
+		registry.ClientOptWriter(io.Discard),
+		registry.ClientOptEnableCache(true),
+	)
+	if err != nil {
+		return fmt.Errorf("unable to create registry client: %w", err)
+	}
+	client.SetRegistryClient(registryClient)
+
+	chartPath, err := client.LocateChart(o.chart, settings)
+	if err != nil {
+		return err
+	}
+	vals, err := o.values.MergeValues(getter.All(settings))
+	if err != nil {
+		return err
+	}
+	ch, err := chartloader.Load(chartPath)
+	if err != nil {
+		return err
+	}
+	accessor, err := chart.NewAccessor(ch)
+	if err != nil {
+		return err
+	}
+	if deps := accessor.MetaDependencies(); len(deps) > 0 {
+		if err := action.CheckDependencies(ch, deps); err != nil {
+			return fmt.Errorf("an error occurred while checking for chart dependencies. You may need to run 'helm dependency build' to fetch missing dependencies: %w", err)
+		}
+	}
+
+	releaser, err := client.RunWithContext(ctx, ch, vals)
+	if err != nil {
+		return err
+	}
+	rel, err := toV1Release(releaser)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, strings.TrimSpace(rel.Manifest)); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return err
+	}
+	if !o.noHooks {
+		if _, err := w.Write(hooksOutput(rel)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newPostRenderer returns the post-renderer of --post-renderer: the executable at the given path or on PATH,
+// like helm v3 runs it, or else the Helm v4 post-renderer plugin of that name.
+func newPostRenderer(ctx context.Context, settings *cli.EnvSettings, name string, args []string) (postrenderer.PostRenderer, error) {
+	if path, err := exec.LookPath(name); err == nil {
+		return &execPostRenderer{ctx: ctx, path: path, args: args}, nil
+	}
+	return postrenderer.NewPostRendererPlugin(settings, name, args...)
+}
+
+// execPostRenderer pipes the rendered manifests through an executable.
+type execPostRenderer struct {
+	ctx  context.Context
+	path string
+	args []string
+}
+
+func (p *execPostRenderer) Run(renderedManifests *bytes.Buffer) (*bytes.Buffer, error) {
+	cmd := exec.CommandContext(p.ctx, p.path, p.args...)
+	cmd.WaitDelay = helmWaitDelay
+	cmd.Stdin = renderedManifests
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error while running post-renderer %s: %w: %s", p.path, err, stderr.String())
+	}
+	if len(bytes.TrimSpace(out.Bytes())) == 0 {
+		return nil, fmt.Errorf("post-renderer %s produced empty output", p.path)
+	}
+	return &out, nil
+}
+
+// renderOptions returns the options to render the chart of the upgrade in-process with the given values files.
+func (d *diffCmd) renderOptions(isUpgrade bool, valueFiles []string) renderOptions {
+	return renderOptions{
+		release:                  d.release,
+		chart:                    d.chart,
+		chartVersion:             d.chartVersion,
+		chartRepo:                d.chartRepo,
+		namespace:                d.namespace,
+		kubeContext:              d.kubeContext,
+		devel:                    d.devel,
+		insecureSkipTLSVerify:    d.insecureSkipTLSVerify,
+		noHooks:                  d.noHooks,
+		includeCRDs:              d.includeCRDs,
+		isUpgrade:                isUpgrade,
+		enableDNS:                d.enableDNS,
+		skipSchemaValidation:     d.SkipSchemaValidation,
+		disableOpenAPIValidation: d.disableOpenAPIValidation,
+		takeOwnership:            d.takeOwnership,
+		postRenderer:             d.postRenderer,
+		postRendererArgs:         d.postRendererArgs,
+		extraAPIs:                d.extraAPIs,
+		kubeVersion:              d.kubeVersion,
+		values: values.Options{
+			ValueFiles:    valueFiles,
+			StringValues:  d.stringValues,
+			Values:        d.values,
+			FileValues:    d.fileValues,
+			JSONValues:    d.jsonValues,
+			LiteralValues: d.stringLiteralValues,
+		},
+		// the SDK is Helm v4, which validates against the cluster by default, see template
+		server: d.useUpgradeDryRun || d.dryRunMode == dryRunServer ||
+			(!d.disableValidation && d.clusterAccessAllowed() && !slices.Contains([]string{dryRunNoOptDefVal, envTrue, envFalse}, d.dryRunMode)),
+	}
+}
+
+// renderOptions returns the options to render the given chart in-process without cluster access.
+func (l *local) renderOptions(chartPath, chartVersion string, side sideValues) renderOptions {
+	return renderOptions{
+		release:               l.release,
+		chart:                 chartPath,
+		chartVersion:          chartVersion,
+		chartRepo:             l.chartRepo,
+		namespace:             l.namespace,
+		insecureSkipTLSVerify: l.insecureSkipTLSVerify,
+		includeCRDs:           l.includeCRDs,
+		enableDNS:             l.enableDNS,
+		postRenderer:          l.postRenderer,
+		postRendererArgs:      l.postRendererArgs,
+		extraAPIs:             l.extraAPIs,
+		kubeVersion:           l.kubeVersion,
+		values: values.Options{
+			ValueFiles:    append(append([]string{}, l.valueFiles...), side.valueFiles...),
+			StringValues:  append(append([]string{}, l.stringValues...), side.stringValues...),
+			Values:        append(append([]string{}, l.values...), side.values...),
+			FileValues:    l.fileValues,
+			JSONValues:    l.jsonValues,
+			LiteralValues: l.stringLiteralValues,
+		},
+	}
+}
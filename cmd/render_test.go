@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v4/pkg/cli/values"
+)
+
+// writeChart writes a chart rendering a ConfigMap from the values, the release and the capabilities, and a hook.
+func writeChart(t *testing.T, tag string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: app\nversion: 0.1.0\n",
+		"values.yaml": "image:\n  tag: \"" + tag + "\"\n",
+		"templates/cm.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-app
+data:
+  tag: {{ .Values.image.tag | quote }}
+  kubeVersion: {{ .Capabilities.KubeVersion.Version | quote }}
+  hasExampleAPI: {{ .Capabilities.APIVersions.Has "example.com/v1" | quote }}
+  isUpgrade: {{ .Release.IsUpgrade | quote }}
+`,
+		"templates/hook.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-hook
+  annotations:
+    helm.sh/hook: pre-install
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	return dir
+}
+
+func TestRenderChart(t *testing.T) {
+	bin := withoutHelm(t)
+	chart := writeChart(t, "1.0")
+	valuesFile := filepath.Join(t.TempDir(), "values.yaml")
+	require.NoError(t, os.WriteFile(valuesFile, []byte("image:\n  tag: \"2.0\"\n"), 0o600))
+
+	t.Run("defaults", func(t *testing.T) {
+		out, err := renderChart(context.Background(), renderOptions{release: "rel", chart: chart, namespace: "ns"})
+		require.NoError(t, err)
+		require.Equal(t, `---
+# Source: app/templates/cm.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: rel-app
+data:
+  tag: "1.0"
+  kubeVersion: "v1.20.0"
+  hasExampleAPI: "false"
+  isUpgrade: "false"
+---
+# Source: app/templates/hook.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: rel-hook
+  annotations:
+    helm.sh/hook: pre-install
+
+`, string(out))
+	})
+
+	t.Run("flags", func(t *testing.T) {
+		out, err := renderChart(context.Background(), renderOptions{
+			release:     "rel",
+			chart:       chart,
+			namespace:   "ns",
+			noHooks:     true,
+			isUpgrade:   true,
+			extraAPIs:   []string{"example.com/v1"},
+			kubeVersion: "1.31.0",
+			values:      values.Options{ValueFiles: []string{valuesFile}, StringValues: []string{"unused=1"}},
+		})
+		require.NoError(t, err)
+		require.Contains(t, string(out), `tag: "2.0"`)
+		require.Contains(t, string(out), `kubeVersion: "v1.31.0"`)
+		require.Contains(t, string(out), `hasExampleAPI: "true"`)
+		require.Contains(t, string(out), `isUpgrade: "true"`)
+		require.NotContains(t, string(out), "rel-hook")
+	})
+
+	t.Run("set takes precedence over values files", func(t *testing.T) {
+		out, err := renderChart(context.Background(), renderOptions{
+			release: "rel",
+			chart:   chart,
+			values:  values.Options{ValueFiles: []string{valuesFile}, Values: []string{"image.tag=3.0"}},
+		})
+		require.NoError(t, err)
+		require.Contains(t, string(out), `tag: "3.0"`)
+	})
+
+	t.Run("executable post-renderer", func(t *testing.T) {
+		script := "#!/bin/sh\nwhile IFS= read -r line; do printf '%s\\n' \"$line\"; done\n" +
+			"printf -- '---\\napiVersion: v1\\nkind: ConfigMap\\nmetadata:\\n  name: %s\\n' \"$1\"\n"
+		require.NoError(t, os.WriteFile(filepath.Join(bin, "add-config-map"), []byte(script), 0o755))
+
+		for _, postRenderer := range []string{"add-config-map", filepath.Join(bin, "add-config-map")} {
+			out, err := renderChart(context.Background(), renderOptions{release: "rel", chart: chart, noHooks: true, postRenderer: postRenderer, postRendererArgs: []string{"post-rendered"}})
+			require.NoError(t, err, postRenderer)
+			require.Contains(t, string(out), "name: rel-app")
+			require.Contains(t, string(out), "name: post-rendered")
+		}
+	})
+
+	t.Run("invalid kube version", func(t *testing.T) {
+		_, err := renderChart(context.Background(), renderOptions{release: "rel", chart: chart, kubeVersion: "x.y"})
+		require.ErrorContains(t, err, `invalid kube version "x.y"`)
+	})
+
+	t.Run("missing chart", func(t *testing.T) {
+		_, err := renderChart(context.Background(), renderOptions{release: "rel", chart: filepath.Join(t.TempDir(), "missing")})
+		require.Error(t, err)
+	})
+}
+
+func TestLocalCmdRendersInProcess(t *testing.T) {
+	withoutHelm(t)
+	chart1 := writeChart(t, "1.0")
+	chart2 := writeChart(t, "2.0")
+
+	output, err := captureStdout(func() {
+		cmd := localCmd()
+		cmd.SetArgs([]string{chart1, chart2, "--output", "simple"})
+		require.NoError(t, cmd.Execute())
+	})
+	require.NoError(t, err)
+	require.Contains(t, output, ", release-app, ConfigMap (v1) to be changed.")
+	require.Contains(t, output, "Plan: 0 to add, 1 to change, 0 to destroy, 0 to change ownership.")
+}
+
+func TestDiffCmdRenderOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		d      diffCmd
+		server bool
+	}{
+		{name: "validates against the cluster by default", d: diffCmd{dryRunMode: "none"}, server: true},
+		{name: "client dry run", d: diffCmd{dryRunMode: dryRunNoOptDefVal}},
+		{name: "dry run true", d: diffCmd{dryRunMode: envTrue}},
+		{name: "disable validation", d: diffCmd{dryRunMode: "none", disableValidation: true}},
+		{name: "server dry run", d: diffCmd{dryRunMode: dryRunServer, disableValidation: true}, server: true},
+		{name: "upgrade dry run", d: diffCmd{dryRunMode: dryRunNoOptDefVal, useUpgradeDryRun: true}, server: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.server, tc.d.renderOptions(true, nil).server)
+		})
+	}
+
+	d := diffCmd{release: "rel", chart: "chart", values: []string{"a=b"}, stringLiteralValues: []string{"c=d"}}
+	o := d.renderOptions(true, []string{"existing.yaml", "values.yaml"})
+	require.Equal(t, values.Options{ValueFiles: []string{"existing.yaml", "values.yaml"}, Values: []string{"a=b"}, LiteralValues: []string{"c=d"}}, o.values)
+	require.True(t, o.isUpgrade)
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/databus23/helm-diff/v3/diff"
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+const renderCmdLongUsage = `
+This command prints a report saved with --save-report in any output format,
+without computing the diff again and without access to a cluster.
+`
+
+func addSaveReportFlag(f *pflag.FlagSet, path *string) {
+	f.StringVar(path, "save-report", "", "save the full report to the file, to print it later in any output format with 'helm diff render'")
+}
+
+// printReport diffs the indexes and prints the report like diff.Print. With a saveReport path, the report is
+// computed for every output format and saved to the path first.
+func printReport(ctx context.Context, oldIndex, newIndex map[string]*manifest.MappingResult, newOwnedReleases map[string]diff.OwnershipDiff, options *diff.Options, to io.Writer, saveReport string) (bool, error) {
+	if saveReport == "" {
+		return diff.Print(ctx, oldIndex, newIndex, newOwnedReleases, options, to)
+	}
+
+	report, err := diff.CompareOwnership(ctx, oldIndex, newIndex, newOwnedReleases, options)
+	if err != nil {
+		return false, err
+	}
+	if err := saveReportFile(report, saveReport); err != nil {
+		return false, err
+	}
+	if err := report.Show(ctx, to, options); err != nil {
+		return false, err
+	}
+	return report.HasChanges(), nil
+}
+
+func saveReportFile(report *diff.Report, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to save the report: %w", err)
+	}
+	if err := report.Save(f); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("unable to save the report to %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+func renderCmd() *cobra.Command {
+	var output string
+	var detailedExitCode bool
+
+	cmd := &cobra.Command{
+		Use:   "render [flags] REPORT",
+		Short: "Prints a report saved with --save-report",
+		Long:  renderCmdLongUsage,
+		Example: strings.Join([]string{
+			"  helm diff upgrade my-release stable/postgresql --save-report report.json --output simple",
+			"  helm diff render report.json --output markdown",
+		}, "\n"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			if err := checkArgsLength(len(args), "report path"); err != nil {
+				return err
+			}
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			report, err := diff.LoadReport(f)
+			if err != nil {
+				return fmt.Errorf("unable to load the report %s: %w", args[0], err)
+			}
+
+			if err := report.WriteContext(cmd.Context(), os.Stdout, output); err != nil {
+				return err
+			}
+
+			if detailedExitCode && report.HasChanges() {
+				return Error{
+					error: errors.New("identified at least one change, exiting with non-zero exit code (detailed-exitcode parameter enabled)"),
+					Code:  2,
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&output, "output", "diff", "Possible values: diff, simple, template, json, structured, dyff, markdown, html, or the NAME of a helm-diff-format-NAME executable on PATH, which reads the structured output on stdin. When set to \"template\", use the env var HELM_DIFF_TPL to specify the template.")
+	cmd.Flags().BoolVar(&detailedExitCode, "detailed-exitcode", false, "return a non-zero exit code when the report has changes")
+
+	return cmd
+}
@@ -1,10 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
-	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -19,6 +20,8 @@ type revision struct {
 	revisions          []string
 	includeTests       bool
 	normalizeManifests bool
+	releaseFiles       []string
+	saveReport         string
 	diff.Options
 }
 
@@ -36,7 +39,7 @@ It can be used to compare the manifests of
 	$ helm diff revision [flags] RELEASE REVISION1 REVISION2
    Example:
 	$ helm diff revision my-release 2 3
-`
+` + revisionSelectorUsage
 
 func revisionCmd() *cobra.Command {
 	diff := revision{}
@@ -44,6 +47,10 @@ func revisionCmd() *cobra.Command {
 		Use:   "revision [flags] RELEASE REVISION1 [REVISION2]",
 		Short: "Shows diff between revision's manifests",
 		Long:  revisionCmdLongUsage,
+		Example: strings.Join([]string{
+			"  helm diff revision my-release last-successful",
+			"  helm diff revision my-release @2024-05-01T12:00:00Z previous",
+		}, "\n"),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Suppress the command usage on error. See #77 for more info
 			cmd.SilenceUsage = true
@@ -64,7 +71,7 @@ func revisionCmd() *cobra.Command {
 
 			diff.release = args[0]
 			diff.revisions = args[1:]
-			return diff.differentiateHelm3()
+			return diff.differentiateHelm3(cmd.Context())
 		},
 	}
 
@@ -72,6 +79,8 @@ func revisionCmd() *cobra.Command {
 	revisionCmd.Flags().BoolVar(&diff.includeTests, "include-tests", false, "enable the diffing of the helm test hooks")
 	revisionCmd.Flags().BoolVar(&diff.normalizeManifests, "normalize-manifests", false, "normalize manifests before running diff to exclude style differences from the output")
 	revisionCmd.Flags().StringVar(&diff.kubeContext, "kube-context", "", "name of the kubeconfig context to use")
+	revisionCmd.Flags().StringArrayVar(&diff.releaseFiles, "release-file", []string{}, releaseFileUsage)
+	addSaveReportFlag(revisionCmd.Flags(), &diff.saveReport)
 	AddDiffOptions(revisionCmd.Flags(), &diff.Options)
 
 	revisionCmd.SuggestionsMinimumDistance = 1
@@ -79,64 +88,90 @@ func revisionCmd() *cobra.Command {
 	return revisionCmd
 }
 
-func (d *revision) differentiateHelm3() error {
+func (d *revision) differentiateHelm3(ctx context.Context) error {
 	namespace := os.Getenv("HELM_NAMESPACE")
 	excludes := []string{manifest.Helm3TestHook, manifest.Helm2TestSuccessHook}
 	if d.includeTests {
 		excludes = []string{}
 	}
-	switch len(d.revisions) {
+	resolver := &revisionResolver{release: d.release, namespace: namespace, kubeContext: d.kubeContext, releaseFiles: d.releaseFiles}
+	revisions := make([]int, len(d.revisions))
+	for i, arg := range d.revisions {
+		revision, err := resolver.resolve(arg)
+		if err != nil {
+			return err
+		}
+		revisions[i] = revision
+	}
+
+	switch len(revisions) {
 	case 1:
-		releaseResponse, err := getRelease(d.release, namespace, d.kubeContext)
+		releaseResponse, err := getRelease(d.release, namespace, d.kubeContext, d.releaseFiles)
 
 		if err != nil {
 			return err
 		}
 
-		revision, _ := strconv.Atoi(d.revisions[0])
-		revisionResponse, err := getRevision(d.release, revision, namespace, d.kubeContext)
+		revision := revisions[0]
+		revisionResponse, err := getRevision(d.release, revision, namespace, d.kubeContext, d.releaseFiles)
 		if err != nil {
 			return err
 		}
 
-		oldSpecs := manifest.Parse(revisionResponse, namespace, d.normalizeManifests, excludes...)
-		newSpecs := manifest.Parse(releaseResponse, namespace, d.normalizeManifests, excludes...)
+		oldSpecs, err := parseManifest(revisionResponse, namespace, d.normalizeManifests, excludes...)
+		if err != nil {
+			return err
+		}
+		newSpecs, err := parseManifest(releaseResponse, namespace, d.normalizeManifests, excludes...)
+		if err != nil {
+			return err
+		}
 		revisionResponse = nil //nolint:ineffassign // nil to allow GC to reclaim raw bytes before diff computation
 		releaseResponse = nil  //nolint:ineffassign // nil to allow GC to reclaim raw bytes before diff computation
 
-		diff.Manifests(
-			oldSpecs,
-			newSpecs,
-			&d.Options,
-			os.Stdout)
+		if _, err := printReport(ctx, oldSpecs, newSpecs, nil, &d.Options, os.Stdout, d.saveReport); err != nil {
+			return err
+		}
+
+		if err := resourceErrors(oldSpecs, newSpecs); err != nil {
+			return err
+		}
 
 	case 2:
-		revision1, _ := strconv.Atoi(d.revisions[0])
-		revision2, _ := strconv.Atoi(d.revisions[1])
+		revision1, revision2 := revisions[0], revisions[1]
 		if revision1 > revision2 {
 			revision1, revision2 = revision2, revision1
 		}
 
-		revisionResponse1, err := getRevision(d.release, revision1, namespace, d.kubeContext)
+		revisionResponse1, err := getRevision(d.release, revision1, namespace, d.kubeContext, d.releaseFiles)
 		if err != nil {
 			return err
 		}
 
-		revisionResponse2, err := getRevision(d.release, revision2, namespace, d.kubeContext)
+		revisionResponse2, err := getRevision(d.release, revision2, namespace, d.kubeContext, d.releaseFiles)
 		if err != nil {
 			return err
 		}
 
-		oldSpecs := manifest.Parse(revisionResponse1, namespace, d.normalizeManifests, excludes...)
-		newSpecs := manifest.Parse(revisionResponse2, namespace, d.normalizeManifests, excludes...)
+		oldSpecs, err := parseManifest(revisionResponse1, namespace, d.normalizeManifests, excludes...)
+		if err != nil {
+			return err
+		}
+		newSpecs, err := parseManifest(revisionResponse2, namespace, d.normalizeManifests, excludes...)
+		if err != nil {
+			return err
+		}
 		revisionResponse1 = nil //nolint:ineffassign // nil to allow GC to reclaim raw bytes before diff computation
 		revisionResponse2 = nil //nolint:ineffassign // nil to allow GC to reclaim raw bytes before diff computation
 
-		seenAnyChanges := diff.Manifests(
-			oldSpecs,
-			newSpecs,
-			&d.Options,
-			os.Stdout)
+		seenAnyChanges, err := printReport(ctx, oldSpecs, newSpecs, nil, &d.Options, os.Stdout, d.saveReport)
+		if err != nil {
+			return err
+		}
+
+		if err := resourceErrors(oldSpecs, newSpecs); err != nil {
+			return err
+		}
 
 		if d.detailedExitCode && seenAnyChanges {
 			return Error{
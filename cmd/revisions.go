@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const revisionSelectorUsage = `
+Instead of a revision number, a revision may be given as one of the following selectors:
+
+ - previous            the revision before the latest one
+ - -N                  the revision N revisions before the latest one, e.g. -2
+ - last-deployed       the latest revision that was deployed successfully, skipping failed and pending ones
+ - last-successful     the last known good revision: the latest one deployed successfully before the latest revision
+ - @TIMESTAMP          the latest revision updated at or before TIMESTAMP, given in RFC 3339 format or as Unix seconds
+
+Selectors starting with a dash must be passed after "--", e.g. "helm diff rollback my-release -- -2".
+`
+
+// Release statuses as reported by helm history.
+const (
+	statusDeployed   = "deployed"
+	statusSuperseded = "superseded"
+)
+
+// releaseRevision is a single entry of the release history as printed by helm history.
+type releaseRevision struct {
+	Revision int       `json:"revision"`
+	Updated  time.Time `json:"updated"`
+	Status   string    `json:"status"`
+}
+
+// revisionResolver turns revision arguments into revision numbers.
+// The release history is only fetched when a selector needs it.
+type revisionResolver struct {
+	release      string
+	namespace    string
+	kubeContext  string
+	releaseFiles []string
+	history      []releaseRevision
+}
+
+// resolve returns the revision number the given revision argument refers to.
+func (r *revisionResolver) resolve(arg string) (int, error) {
+	if n, err := strconv.Atoi(arg); err == nil {
+		if n > 0 {
+			return n, nil
+		}
+		if n < 0 {
+			return r.relative(-n)
+		}
+		return 0, fmt.Errorf("invalid revision %q: revisions start at 1", arg)
+	}
+
+	switch {
+	case arg == "previous":
+		return r.relative(1)
+	case arg == "last-deployed":
+		return r.latest("deployed successfully", wasDeployed)
+	case arg == "last-successful":
+		history, err := r.loadHistory()
+		if err != nil {
+			return 0, err
+		}
+		latest := history[len(history)-1].Revision
+		return r.latest("deployed successfully before the latest one", func(rev releaseRevision) bool {
+			return rev.Revision < latest && wasDeployed(rev)
+		})
+	case strings.HasPrefix(arg, "@"):
+		timestamp, err := parseRevisionTimestamp(strings.TrimPrefix(arg, "@"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid revision %q: %w", arg, err)
+		}
+		return r.latest("updated at or before "+timestamp.Format(time.RFC3339), func(rev releaseRevision) bool {
+			return !rev.Updated.After(timestamp)
+		})
+	}
+
+	return 0, fmt.Errorf("invalid revision %q: must be a revision number, previous, -N, last-deployed, last-successful or @TIMESTAMP", arg)
+}
+
+// wasDeployed tells whether the revision was deployed successfully: it is the current revision,
+// or it was until a later one replaced it.
+func wasDeployed(rev releaseRevision) bool {
+	return rev.Status == statusDeployed || rev.Status == statusSuperseded
+}
+
+// relative returns the revision n revisions before the latest one.
+func (r *revisionResolver) relative(n int) (int, error) {
+	history, err := r.loadHistory()
+	if err != nil {
+		return 0, err
+	}
+	revision := history[len(history)-1].Revision - n
+	for _, rev := range history {
+		if rev.Revision == revision {
+			return revision, nil
+		}
+	}
+	return 0, fmt.Errorf("release %s has no revision %d revisions before the latest one", r.release, n)
+}
+
+// latest returns the newest revision matching the given predicate.
+func (r *revisionResolver) latest(description string, matches func(releaseRevision) bool) (int, error) {
+	history, err := r.loadHistory()
+	if err != nil {
+		return 0, err
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if matches(history[i]) {
+			return history[i].Revision, nil
+		}
+	}
+	return 0, fmt.Errorf("release %s has no revision that was %s", r.release, description)
+}
+
+// loadHistory returns the release history sorted by revision.
+func (r *revisionResolver) loadHistory() ([]releaseRevision, error) {
+	if r.history == nil {
+		history, err := getHistory(r.release, r.namespace, r.kubeContext, r.releaseFiles)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get history of release %s: %w", r.release, err)
+		}
+		r.history = history
+	}
+	if len(r.history) == 0 {
+		return nil, fmt.Errorf("release %s has no revisions", r.release)
+	}
+	sort.Slice(r.history, func(i, j int) bool {
+		return r.history[i].Revision < r.history[j].Revision
+	})
+	return r.history, nil
+}
+
+func parseRevisionTimestamp(s string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.New("timestamp must be in RFC 3339 format or Unix seconds")
+	}
+	return t, nil
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevisionResolver(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, time.May, d, 12, 0, 0, 0, time.UTC)
+	}
+	history := []releaseRevision{
+		{Revision: 5, Updated: day(5), Status: "pending-upgrade"},
+		{Revision: 2, Updated: day(2), Status: "superseded"},
+		{Revision: 3, Updated: day(3), Status: "deployed"},
+		{Revision: 4, Updated: day(4), Status: "failed"},
+	}
+
+	for _, tt := range []struct {
+		arg      string
+		expected int
+		err      string
+	}{
+		{arg: "3", expected: 3},
+		{arg: "previous", expected: 4},
+		{arg: "-1", expected: 4},
+		{arg: "-3", expected: 2},
+		{arg: "-4", err: "release my-release has no revision 4 revisions before the latest one"},
+		{arg: "last-deployed", expected: 3},
+		{arg: "last-successful", expected: 3},
+		{arg: "@2024-05-03T13:00:00Z", expected: 3},
+		{arg: "@2024-05-04T12:00:00Z", expected: 4},
+		{arg: "@1714737600", expected: 3},
+		{arg: "@2024-05-01T00:00:00Z", err: "release my-release has no revision that was updated at or before 2024-05-01T00:00:00Z"},
+		{arg: "@yesterday", err: `invalid revision "@yesterday": timestamp must be in RFC 3339 format or Unix seconds`},
+		{arg: "0", err: `invalid revision "0": revisions start at 1`},
+		{arg: "2a", err: `invalid revision "2a": must be a revision number, previous, -N, last-deployed, last-successful or @TIMESTAMP`},
+	} {
+		t.Run(tt.arg, func(t *testing.T) {
+			resolver := &revisionResolver{release: "my-release", history: append([]releaseRevision(nil), history...)}
+			revision, err := resolver.resolve(tt.arg)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, revision)
+		})
+	}
+}
+
+func TestRevisionResolverLastSuccessful(t *testing.T) {
+	resolver := &revisionResolver{release: "my-release", history: []releaseRevision{
+		{Revision: 1, Status: "superseded"},
+		{Revision: 2, Status: "superseded"},
+		{Revision: 3, Status: "deployed"},
+	}}
+	revision, err := resolver.resolve("last-deployed")
+	require.NoError(t, err)
+	require.Equal(t, 3, revision)
+	revision, err = resolver.resolve("last-successful")
+	require.NoError(t, err)
+	require.Equal(t, 2, revision)
+
+	resolver = &revisionResolver{release: "my-release", history: []releaseRevision{
+		{Revision: 1, Status: "failed"},
+		{Revision: 2, Status: "deployed"},
+	}}
+	_, err = resolver.resolve("last-successful")
+	require.EqualError(t, err, "release my-release has no revision that was deployed successfully before the latest one")
+}
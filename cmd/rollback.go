@@ -1,10 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
-	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -19,6 +20,8 @@ type rollback struct {
 	revisions          []string
 	includeTests       bool
 	normalizeManifests bool
+	releaseFiles       []string
+	saveReport         string
 	diff.Options
 }
 
@@ -27,15 +30,19 @@ This command compares the latest manifest details of a named release
 with specific revision values to rollback.
 
 It forecasts/visualizes changes, that a helm rollback could perform.
-`
+` + revisionSelectorUsage
 
 func rollbackCmd() *cobra.Command {
 	diff := rollback{}
 	rollbackCmd := &cobra.Command{
-		Use:     "rollback [flags] [RELEASE] [REVISION]",
-		Short:   "Show a diff explaining what a helm rollback could perform",
-		Long:    rollbackCmdLongUsage,
-		Example: "  helm diff rollback my-release 2",
+		Use:   "rollback [flags] [RELEASE] [REVISION]",
+		Short: "Show a diff explaining what a helm rollback could perform",
+		Long:  rollbackCmdLongUsage,
+		Example: strings.Join([]string{
+			"  helm diff rollback my-release 2",
+			"  helm diff rollback my-release last-successful",
+			"  helm diff rollback my-release -- -2",
+		}, "\n"),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Suppress the command usage on error. See #77 for more info
 			cmd.SilenceUsage = true
@@ -54,7 +61,7 @@ func rollbackCmd() *cobra.Command {
 			diff.release = args[0]
 			diff.revisions = args[1:]
 
-			return diff.backcastHelm3()
+			return diff.backcastHelm3(cmd.Context())
 		},
 	}
 
@@ -62,6 +69,8 @@ func rollbackCmd() *cobra.Command {
 	rollbackCmd.Flags().BoolVar(&diff.includeTests, "include-tests", false, "enable the diffing of the helm test hooks")
 	rollbackCmd.Flags().BoolVar(&diff.normalizeManifests, "normalize-manifests", false, "normalize manifests before running diff to exclude style differences from the output")
 	rollbackCmd.Flags().StringVar(&diff.kubeContext, "kube-context", "", "name of the kubeconfig context to use")
+	rollbackCmd.Flags().StringArrayVar(&diff.releaseFiles, "release-file", []string{}, releaseFileUsage)
+	addSaveReportFlag(rollbackCmd.Flags(), &diff.saveReport)
 	AddDiffOptions(rollbackCmd.Flags(), &diff.Options)
 
 	rollbackCmd.SuggestionsMinimumDistance = 1
@@ -69,37 +78,51 @@ func rollbackCmd() *cobra.Command {
 	return rollbackCmd
 }
 
-func (d *rollback) backcastHelm3() error {
+func (d *rollback) backcastHelm3(ctx context.Context) error {
 	namespace := os.Getenv("HELM_NAMESPACE")
 	excludes := []string{manifest.Helm3TestHook, manifest.Helm2TestSuccessHook}
 	if d.includeTests {
 		excludes = []string{}
 	}
+	resolver := &revisionResolver{release: d.release, namespace: namespace, kubeContext: d.kubeContext, releaseFiles: d.releaseFiles}
+	revision, err := resolver.resolve(d.revisions[0])
+	if err != nil {
+		return err
+	}
+
 	// get manifest of the latest release
-	releaseResponse, err := getRelease(d.release, namespace, d.kubeContext)
+	releaseResponse, err := getRelease(d.release, namespace, d.kubeContext, d.releaseFiles)
 
 	if err != nil {
 		return err
 	}
 
 	// get manifest of the release to rollback
-	revision, _ := strconv.Atoi(d.revisions[0])
-	revisionResponse, err := getRevision(d.release, revision, namespace, d.kubeContext)
+	revisionResponse, err := getRevision(d.release, revision, namespace, d.kubeContext, d.releaseFiles)
 	if err != nil {
 		return err
 	}
 
 	// create a diff between the current manifest and the version of the manifest that a user is intended to rollback
-	oldSpecs := manifest.Parse(releaseResponse, namespace, d.normalizeManifests, excludes...)
-	newSpecs := manifest.Parse(revisionResponse, namespace, d.normalizeManifests, excludes...)
+	oldSpecs, err := parseManifest(releaseResponse, namespace, d.normalizeManifests, excludes...)
+	if err != nil {
+		return err
+	}
+	newSpecs, err := parseManifest(revisionResponse, namespace, d.normalizeManifests, excludes...)
+	if err != nil {
+		return err
+	}
 	releaseResponse = nil  //nolint:ineffassign // nil to allow GC to reclaim raw bytes before diff computation
 	revisionResponse = nil //nolint:ineffassign // nil to allow GC to reclaim raw bytes before diff computation
 
-	seenAnyChanges := diff.Manifests(
-		oldSpecs,
-		newSpecs,
-		&d.Options,
-		os.Stdout)
+	seenAnyChanges, err := printReport(ctx, oldSpecs, newSpecs, nil, &d.Options, os.Stdout, d.saveReport)
+	if err != nil {
+		return err
+	}
+
+	if err := resourceErrors(oldSpecs, newSpecs); err != nil {
+		return err
+	}
 
 	if d.detailedExitCode && seenAnyChanges {
 		return Error{
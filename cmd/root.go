@@ -95,7 +95,12 @@ func New() *cobra.Command {
 		rollbackCmd(),
 		releaseCmd(),
 		localCmd(),
+		chartCmd(),
+		batchCmd(),
+		renderCmd(),
 	)
 	cmd.SetHelpCommand(&cobra.Command{}) // Disable the help command
+	addTimeoutFlag(cmd)
+	cancelable(cmd)
 	return cmd
 }
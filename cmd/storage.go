@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"helm.sh/helm/v4/pkg/action"
+	"helm.sh/helm/v4/pkg/chart/common/util"
+	kubefake "helm.sh/helm/v4/pkg/kube/fake"
+	helmrelease "helm.sh/helm/v4/pkg/release"
+	releasev1 "helm.sh/helm/v4/pkg/release/v1"
+	"helm.sh/helm/v4/pkg/storage/driver"
+	"sigs.k8s.io/yaml"
+)
+
+// releaseReader reads release records through the Helm SDK, from the storage driver
+// selected by HELM_DRIVER just like helm itself does, or from the release files if any.
+// Records are cached, so that the manifest, hooks and values of a revision are read at once.
+type releaseReader struct {
+	cfg *action.Configuration
+
+	mu      sync.Mutex
+	records map[string]*releasev1.Release
+	history map[string][]*releasev1.Release
+}
+
+var (
+	releaseReadersMu sync.Mutex
+	releaseReaders   = map[string]*releaseReader{}
+)
+
+// getReleaseReader returns the reader for releases in the given namespace, or in the given release files if any,
+// creating it on first use.
+func getReleaseReader(namespace, kubeContext string, releaseFiles []string) (*releaseReader, error) {
+	releaseReadersMu.Lock()
+	defer releaseReadersMu.Unlock()
+
+	key := namespace + "/" + kubeContext + "/" + strings.Join(releaseFiles, string(os.PathListSeparator))
+	if r, ok := releaseReaders[key]; ok {
+		return r, nil
+	}
+
+	var cfg *action.Configuration
+	if len(releaseFiles) > 0 {
+		var err error
+		if cfg, err = releaseFilesConfiguration(releaseFiles, namespace); err != nil {
+			return nil, err
+		}
+	} else {
+		localEnv := prepareEnvSettings(kubeContext)
+		if namespace != "" {
+			localEnv.SetNamespace(namespace)
+		}
+		cfg = new(action.Configuration)
+		if err := cfg.Init(localEnv.RESTClientGetter(), localEnv.Namespace(), os.Getenv("HELM_DRIVER")); err != nil {
+			return nil, err
+		}
+		if err := loadReleasesInMemory(cfg, localEnv.Namespace()); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &releaseReader{
+		cfg:     cfg,
+		records: map[string]*releasev1.Release{},
+		history: map[string][]*releasev1.Release{},
+	}
+	releaseReaders[key] = r
+	return r, nil
+}
+
+// loadReleasesInMemory fills the memory driver with the releases of the files listed in HELM_MEMORY_DRIVER_DATA,
+// the way helm does when HELM_DRIVER is memory.
+func loadReleasesInMemory(cfg *action.Configuration, namespace string) error {
+	mem, ok := cfg.Releases.Driver.(*driver.Memory)
+	if !ok || os.Getenv("HELM_MEMORY_DRIVER_DATA") == "" {
+		return nil
+	}
+
+	cfg.KubeClient = &kubefake.PrintingKubeClient{Out: io.Discard}
+	for _, path := range strings.Split(os.Getenv("HELM_MEMORY_DRIVER_DATA"), ":") {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("unable to read memory driver data: %w", err)
+		}
+		var releases []*releasev1.Release
+		if err := yaml.Unmarshal(b, &releases); err != nil {
+			return fmt.Errorf("unable to unmarshal memory driver data %s: %w", path, err)
+		}
+		for _, rel := range releases {
+			if err := cfg.Releases.Create(rel); err != nil {
+				return err
+			}
+		}
+	}
+	mem.SetNamespace(namespace)
+	return nil
+}
+
+// get returns the given revision of the release, or its latest revision if revision is 0.
+func (r *releaseReader) get(name string, revision int) (*releasev1.Release, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := fmt.Sprintf("%s/%d", name, revision)
+	if rel, ok := r.records[key]; ok {
+		return rel, nil
+	}
+
+	// read the storage directly like action.Get does, without its extra request for the cluster version
+	var releaser helmrelease.Releaser
+	var err error
+	if revision <= 0 {
+		releaser, err = r.cfg.Releases.Last(name)
+	} else {
+		releaser, err = r.cfg.Releases.Get(name, revision)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rel, err := toV1Release(releaser)
+	if err != nil {
+		return nil, err
+	}
+	r.records[key] = rel
+	r.records[fmt.Sprintf("%s/%d", name, rel.Version)] = rel
+	return rel, nil
+}
+
+// revisions returns all revisions of the release.
+func (r *releaseReader) revisions(name string) ([]*releasev1.Release, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if history, ok := r.history[name]; ok {
+		return history, nil
+	}
+
+	releasers, err := r.cfg.Releases.History(name)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]*releasev1.Release, 0, len(releasers))
+	for _, releaser := range releasers {
+		rel, err := toV1Release(releaser)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, rel)
+		r.records[fmt.Sprintf("%s/%d", name, rel.Version)] = rel
+	}
+	r.history[name] = history
+	return history, nil
+}
+
+func toV1Release(releaser helmrelease.Releaser) (*releasev1.Release, error) {
+	switch rel := releaser.(type) {
+	case *releasev1.Release:
+		return rel, nil
+	case releasev1.Release:
+		return &rel, nil
+	default:
+		return nil, fmt.Errorf("unsupported release type: %T", releaser)
+	}
+}
+
+// readRelease returns the given revision of the release, or its latest revision if revision is 0.
+func readRelease(release string, revision int, namespace, kubeContext string, releaseFiles []string) (*releasev1.Release, error) {
+	r, err := getReleaseReader(namespace, kubeContext, releaseFiles)
+	if err != nil {
+		return nil, err
+	}
+	return r.get(release, revision)
+}
+
+// manifestOutput returns the manifest of the release as printed by helm get manifest.
+func manifestOutput(rel *releasev1.Release) []byte {
+	return []byte(rel.Manifest + "\n")
+}
+
+// hooksOutput returns the hooks of the release as printed by helm get hooks.
+func hooksOutput(rel *releasev1.Release) []byte {
+	var b strings.Builder
+	for _, hook := range rel.Hooks {
+		_, _ = fmt.Fprintf(&b, "---\n# Source: %s\n%s\n", hook.Path, hook.Manifest)
+	}
+	return []byte(b.String())
+}
+
+// releaseValues returns the user-supplied values of the release, or all values including the chart defaults.
+func releaseValues(rel *releasev1.Release, all bool) (map[string]interface{}, error) {
+	if all {
+		return util.CoalesceValues(rel.Chart, rel.Config)
+	}
+	if rel.Config == nil {
+		return map[string]interface{}{}, nil
+	}
+	return rel.Config, nil
+}
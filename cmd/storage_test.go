@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const memoryDriverData = `- name: my-release
+  namespace: my-ns
+  version: 1
+  info:
+    status: superseded
+    last_deployed: "2024-05-01T12:00:00Z"
+  chart:
+    metadata:
+      name: my-chart
+    values:
+      replicas: 1
+      image:
+        tag: "1.0"
+  config:
+    image:
+      tag: "1.1"
+  manifest: |
+    ---
+    # Source: my-chart/templates/cm.yaml
+    kind: ConfigMap
+- name: my-release
+  namespace: my-ns
+  version: 2
+  info:
+    status: deployed
+    last_deployed: "2024-05-02T12:00:00Z"
+  chart:
+    metadata:
+      name: my-chart
+  manifest: |
+    ---
+    # Source: my-chart/templates/cm.yaml
+    kind: Secret
+  hooks:
+  - name: job
+    path: my-chart/templates/job.yaml
+    manifest: |-
+      kind: Job
+`
+
+func setupMemoryDriver(t *testing.T) {
+	t.Helper()
+	data := filepath.Join(t.TempDir(), "releases.yaml")
+	require.NoError(t, os.WriteFile(data, []byte(memoryDriverData), 0o600))
+	t.Setenv("HELM_DRIVER", "memory")
+	t.Setenv("HELM_MEMORY_DRIVER_DATA", data)
+
+	releaseReadersMu.Lock()
+	releaseReaders = map[string]*releaseReader{}
+	releaseReadersMu.Unlock()
+	t.Cleanup(func() {
+		releaseReadersMu.Lock()
+		releaseReaders = map[string]*releaseReader{}
+		releaseReadersMu.Unlock()
+	})
+}
+
+func TestReleaseReads(t *testing.T) {
+	setupMemoryDriver(t)
+
+	manifest, err := getRelease("my-release", "my-ns", "", nil)
+	require.NoError(t, err)
+	require.Equal(t, "---\n# Source: my-chart/templates/cm.yaml\nkind: Secret\n\n", string(manifest))
+
+	manifest, err = getRevision("my-release", 1, "my-ns", "", nil)
+	require.NoError(t, err)
+	require.Equal(t, "---\n# Source: my-chart/templates/cm.yaml\nkind: ConfigMap\n\n", string(manifest))
+
+	hooks, err := getHooks("my-release", "my-ns", "", nil)
+	require.NoError(t, err)
+	require.Equal(t, "---\n# Source: my-chart/templates/job.yaml\nkind: Job\n", string(hooks))
+
+	chart, err := getChart("my-release", "my-ns", "", nil)
+	require.NoError(t, err)
+	require.Equal(t, "my-chart", chart)
+
+	values, err := getValues("my-release", "my-ns", "", nil)
+	require.NoError(t, err)
+	require.Empty(t, values)
+
+	history, err := getHistory("my-release", "my-ns", "", nil)
+	require.NoError(t, err)
+	require.Equal(t, []releaseRevision{
+		{Revision: 1, Updated: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Status: statusSuperseded},
+		{Revision: 2, Updated: time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC), Status: statusDeployed},
+	}, history)
+
+	_, err = getRelease("missing", "my-ns", "", nil)
+	require.ErrorContains(t, err, "release: not found")
+	_, err = getRelease("my-release", "other-ns", "", nil)
+	require.ErrorContains(t, err, "release: not found")
+}
+
+func TestWriteExistingValues(t *testing.T) {
+	setupMemoryDriver(t)
+	rel, err := readRelease("my-release", 1, "my-ns", "", nil)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		all      bool
+		expected string
+	}{
+		{all: false, expected: "image:\n  tag: \"1.1\"\n"},
+		{all: true, expected: "image:\n  tag: \"1.1\"\nreplicas: 1\n"},
+	} {
+		// writeExistingValues reads the latest revision, point it to the first one
+		reader, err := getReleaseReader("my-ns", "", nil)
+		require.NoError(t, err)
+		reader.records["my-release/0"] = rel
+
+		f, err := os.CreateTemp(t.TempDir(), "values")
+		require.NoError(t, err)
+		d := &diffCmd{release: "my-release", namespace: "my-ns"}
+		require.NoError(t, d.writeExistingValues(f, tc.all))
+		data, err := os.ReadFile(f.Name())
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, string(data))
+	}
+}
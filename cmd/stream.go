@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	releasev1 "helm.sh/helm/v4/pkg/release/v1"
+
+	"github.com/databus23/helm-diff/v3/diff"
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+const streamUsage = "diff the manifests one resource at a time through temporary files instead of in memory, for releases too large to be diffed otherwise. " +
+	"Supports the diff, simple and structured output formats only: dyff and the other formats need all resources at once"
+
+// streamConflict returns the flag --stream cannot be combined with because it needs all resources in memory, if any.
+func (d *diffCmd) streamConflict() string {
+	switch {
+	case d.threeWayMerge:
+		return "--three-way-merge"
+	case d.takeOwnership:
+		return "--take-ownership"
+	case d.showFieldOwners:
+		return "--show-field-owners"
+	case d.showFieldOrigins:
+		return "--show-field-origins"
+	case d.findOrphans:
+		return "--find-orphans"
+	case d.apiDeprecations.enabled():
+		return "--check-deprecated-apis"
+	case d.saveReport != "":
+		return "--save-report"
+	case d.Explain:
+		return "--explain"
+	case d.Interactive:
+		return "--interactive"
+	case d.FindRenames > 0:
+		return "--find-renames"
+	}
+	return ""
+}
+
+// checkStreamFlags returns an error if --stream is combined with flags or an output format it does not support.
+func (d *diffCmd) checkStreamFlags() error {
+	if flag := d.streamConflict(); flag != "" {
+		return fmt.Errorf("--stream cannot be combined with %s", flag)
+	}
+	switch d.OutputFormat {
+	case "diff", "simple", "structured":
+		return nil
+	}
+	return fmt.Errorf("--stream supports the diff, simple and structured output formats only, but got %q", d.OutputFormat)
+}
+
+// streamManifests diffs the manifests one resource at a time, keeping their documents in temporary files.
+// Neither manifest is held in memory: the release manifest is read from the release, and the chart is rendered
+// straight into its store.
+func (d *diffCmd) streamManifests(ctx context.Context, newInstall bool) error {
+	parseOptions := manifest.ParseOptions{DefaultNamespace: d.namespace, NormalizeManifests: d.normalizeManifests}
+	if !d.includeTests {
+		parseOptions.ExcludedHooks = []string{manifest.Helm3TestHook, manifest.Helm2TestSuccessHook}
+	}
+
+	releaseManifest := io.Reader(strings.NewReader(""))
+	if !newInstall && d.releaseReadAllowed() {
+		rel, err := readRelease(d.release, 0, d.namespace, d.kubeContext, d.releaseFiles)
+		if err != nil {
+			return fmt.Errorf("Failed to get release %s in namespace %s: %w", d.release, d.namespace, err)
+		}
+		releaseManifest = releaseManifestReader(rel, !d.noHooks)
+	}
+	currentStore, err := manifest.NewStore(releaseManifest, "", parseOptions)
+	if err != nil {
+		return fmt.Errorf("unable to store the release manifest: %w", err)
+	}
+	defer func() { _ = currentStore.Close() }()
+
+	newStore, err := d.renderStore(ctx, !newInstall, parseOptions)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = newStore.Close() }()
+
+	seenAnyChanges, err := diff.Stream(ctx, currentStore, newStore, &d.Options, d.out)
+	if err != nil {
+		return err
+	}
+
+	if err := resourceErrors(currentStore.Failed(), newStore.Failed()); err != nil {
+		return err
+	}
+
+	if d.detailedExitCode && seenAnyChanges {
+		return Error{
+			error: errors.New("identified at least one change, exiting with non-zero exit code (detailed-exitcode parameter enabled)"),
+			Code:  2,
+		}
+	}
+	return nil
+}
+
+// releaseManifestReader returns a reader of the manifest of the release like manifestOutput, followed by its hooks
+// like hooksOutput if hooks is set, without copying the manifest.
+func releaseManifestReader(rel *releasev1.Release, hooks bool) io.Reader {
+	readers := []io.Reader{strings.NewReader(rel.Manifest), strings.NewReader("\n")}
+	if hooks {
+		readers = append(readers, bytes.NewReader(hooksOutput(rel)))
+	}
+	return io.MultiReader(readers...)
+}
+
+// renderStore renders the chart of the upgrade into a Store while helm, or the Helm SDK, outputs it.
+func (d *diffCmd) renderStore(ctx context.Context, isUpgrade bool, options manifest.ParseOptions) (*manifest.Store, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r, w := io.Pipe()
+	rendered := make(chan error, 1)
+	go func() {
+		err := d.renderTo(ctx, isUpgrade, w)
+		_ = w.CloseWithError(err)
+		rendered <- err
+	}()
+
+	store, err := manifest.NewStore(r, "", options)
+	if err != nil {
+		// stop rendering, which may be blocked writing what is no longer read
+		cancel()
+		_ = r.CloseWithError(err)
+		// the store fails with the error of the render if it stopped it
+		if renderErr := <-rendered; renderErr != nil && errors.Is(err, renderErr) {
+			return nil, fmt.Errorf("Failed to render chart: %w", renderErr)
+		}
+		return nil, fmt.Errorf("unable to store the rendered manifest: %w", err)
+	}
+	if err := <-rendered; err != nil {
+		_ = store.Close()
+		return nil, fmt.Errorf("Failed to render chart: %w", err)
+	}
+	return store, nil
+}
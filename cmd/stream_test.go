@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	rcommon "helm.sh/helm/v4/pkg/release/common"
+)
+
+func TestUpgradeStream(t *testing.T) {
+	withoutHelm(t)
+	setupMemoryDriver(t)
+
+	rel := testRelease(7, rcommon.StatusDeployed, `---
+# Source: app/templates/cm.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-app
+data:
+  tag: "0.9"
+`)
+	rel.Hooks = nil
+	releaseFile := writeReleaseFile(t, secretRecord(t, rel))
+	chart := writeChart(t, "0.1")
+
+	for _, output := range []string{"diff", "simple", "structured"} {
+		t.Run(output, func(t *testing.T) {
+			var inMemory, streamed bytes.Buffer
+			cmd := newChartCommand()
+			cmd.SetOut(&inMemory)
+			cmd.SetArgs([]string{"app", chart, "--release-file", releaseFile, "--dry-run=client", "--no-hooks", "--output", output})
+			require.NoError(t, cmd.Execute())
+
+			cmd = newChartCommand()
+			cmd.SetOut(&streamed)
+			cmd.SetArgs([]string{"app", chart, "--release-file", releaseFile, "--dry-run=client", "--no-hooks", "--output", output, "--stream"})
+			require.NoError(t, cmd.Execute())
+
+			require.Contains(t, streamed.String(), "app-app")
+			require.Equal(t, inMemory.String(), streamed.String())
+		})
+	}
+
+	t.Run("render errors", func(t *testing.T) {
+		cmd := newChartCommand()
+		cmd.SetArgs([]string{"app", filepath.Join(t.TempDir(), "missing"), "--release-file", releaseFile, "--dry-run=client", "--stream"})
+		err := cmd.Execute()
+		require.ErrorContains(t, err, "Failed to render chart: ")
+		require.NotContains(t, err.Error(), "unable to store")
+	})
+
+	t.Run("unsupported flags", func(t *testing.T) {
+		for args, message := range map[string]string{
+			"--find-renames=0.5": "--stream cannot be combined with --find-renames",
+			"--output=json":      `--stream supports the diff, simple and structured output formats only, but got "json"`,
+		} {
+			cmd := newChartCommand()
+			cmd.SetArgs([]string{"app", chart, "--stream", args})
+			require.EqualError(t, cmd.Execute(), message)
+		}
+	})
+}
@@ -2,9 +2,10 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"path/filepath"
 	"slices"
@@ -15,6 +16,7 @@ import (
 	"helm.sh/helm/v4/pkg/action"
 	"helm.sh/helm/v4/pkg/cli"
 	"helm.sh/helm/v4/pkg/kube"
+	releasev1 "helm.sh/helm/v4/pkg/release/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/cli-runtime/pkg/resource"
 
@@ -67,11 +69,20 @@ type diffCmd struct {
 	install                  bool
 	normalizeManifests       bool
 	takeOwnership            bool
+	findOrphans              bool
 	threeWayMerge            bool
+	showFieldOwners          bool
+	showFieldOrigins         bool
+	forceConflicts           bool
+	apiDeprecations          apiDeprecationFlags
+	saveReport               string
+	stream                   bool
+	concurrency              int
 	serverSide               string
 	extraAPIs                []string
 	kubeVersion              string
 	useUpgradeDryRun         bool
+	releaseFiles             []string
 	diff.Options
 
 	// dryRunMode can take the following values:
@@ -82,6 +93,10 @@ type diffCmd struct {
 	// - "false": same as "none"
 	dryRunMode  string
 	kubeContext string
+
+	// out and errOut are where the diff and the diagnostics are written to.
+	out    io.Writer
+	errOut io.Writer
 }
 
 func (d *diffCmd) isAllowUnreleased() bool {
@@ -111,6 +126,11 @@ func (d *diffCmd) clusterAccessAllowed() bool {
 	return d.dryRunMode == dryRunNone || d.dryRunMode == envFalse || d.dryRunMode == dryRunServer
 }
 
+// releaseReadAllowed returns true if the release can be read, from the cluster or from exported release records.
+func (d *diffCmd) releaseReadAllowed() bool {
+	return d.clusterAccessAllowed() || len(d.releaseFiles) > 0
+}
+
 const globalUsage = `Show a diff explaining what a helm upgrade would change.
 
 This fetches the currently deployed version of a release
@@ -120,9 +140,13 @@ perform.
 `
 
 func newChartCommand() *cobra.Command {
-	diff := diffCmd{
+	return newUpgradeCommand(&diffCmd{
 		namespace: os.Getenv("HELM_NAMESPACE"),
-	}
+	})
+}
+
+// newUpgradeCommand returns the upgrade command running the given diffCmd.
+func newUpgradeCommand(diff *diffCmd) *cobra.Command {
 	unknownFlags := os.Getenv("HELM_DIFF_IGNORE_UNKNOWN_FLAGS") == envTrue
 
 	cmd := &cobra.Command{
@@ -173,6 +197,10 @@ func newChartCommand() *cobra.Command {
 				return fmt.Errorf("flag %q must be %q, %q or %q, but got %q", "server-side", envTrue, envFalse, serverSideAuto, diff.serverSide)
 			}
 
+			if diff.findOrphans && !diff.clusterAccessAllowed() {
+				return fmt.Errorf("flag %q requires cluster access and cannot be used with --dry-run=%s", "find-orphans", diff.dryRunMode)
+			}
+
 			// Suppress the command usage on error. See #77 for more info
 			cmd.SilenceUsage = true
 
@@ -184,7 +212,7 @@ func newChartCommand() *cobra.Command {
 				diff.threeWayMerge = enabled
 
 				if enabled {
-					fmt.Fprintf(os.Stderr, "Enabled three way merge via the envvar\n")
+					fmt.Fprintf(cmd.ErrOrStderr(), "Enabled three way merge via the envvar\n")
 				}
 			}
 
@@ -193,7 +221,7 @@ func newChartCommand() *cobra.Command {
 				diff.normalizeManifests = enabled
 
 				if enabled {
-					fmt.Fprintf(os.Stderr, "Enabled normalize manifests via the envvar\n")
+					fmt.Fprintf(cmd.ErrOrStderr(), "Enabled normalize manifests via the envvar\n")
 				}
 			}
 
@@ -209,9 +237,20 @@ func newChartCommand() *cobra.Command {
 
 			ProcessDiffOptions(cmd.Flags(), &diff.Options)
 
+			if diff.stream {
+				if err := diff.checkStreamFlags(); err != nil {
+					return err
+				}
+			}
+
+			if diff.concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1, but got %d", diff.concurrency)
+			}
 			diff.release = args[0]
 			diff.chart = args[1]
-			return diff.runHelm3()
+			diff.out = cmd.OutOrStdout()
+			diff.errOut = cmd.ErrOrStderr()
+			return diff.runHelm3(cmd.Context())
 		},
 		FParseErrWhitelist: cobra.FParseErrWhitelist{
 			UnknownFlags: unknownFlags,
@@ -259,15 +298,24 @@ func newChartCommand() *cobra.Command {
 	f.BoolVar(&diff.insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "skip tls certificate checks for the chart download")
 	f.BoolVar(&diff.normalizeManifests, "normalize-manifests", false, "normalize manifests before running diff to exclude style differences from the output")
 	f.BoolVar(&diff.takeOwnership, "take-ownership", false, "if set, upgrade will ignore the check for helm annotations and take ownership of the existing resources")
-	f.StringVar(&diff.serverSide, "server-side", serverSideAuto, `must be "true", "false" or "auto". Object updates run in the server instead of the client ("auto" defaults the value from the previous chart release's method)`)
+	f.BoolVar(&diff.findOrphans, "find-orphans", false, "list the objects in the release namespace that are annotated as part of the release, but are part of neither the release nor the rendered chart")
+	f.StringArrayVar(&diff.releaseFiles, "release-file", []string{}, releaseFileUsage+". Combine with --dry-run=client to not access the cluster at all")
+	f.BoolVar(&diff.showFieldOwners, "show-field-owners", false, "report the other field managers owning the changed fields of the objects in the cluster, flagging the conflicts that fail a server-side apply or that a controller may revert. Implies --three-way-merge")
+	f.BoolVar(&diff.showFieldOrigins, "show-field-origins", false, `label every changed field of the objects in the cluster by origin: "chart change", "reverts live drift" or "live drift preserved", comparing the release manifest, the live object and the result of the upgrade. Implies --three-way-merge`)
+	f.IntVar(&diff.concurrency, "concurrency", 1, "maximum number of objects fetched from and dry-run patched in the cluster at the same time with --three-way-merge and --take-ownership")
+	addAPIDeprecationFlags(f, &diff.apiDeprecations, "--kube-version, or of the cluster")
+	addSaveReportFlag(f, &diff.saveReport)
+	f.BoolVar(&diff.stream, "stream", false, streamUsage)
+	f.BoolVar(&diff.forceConflicts, "force-conflicts", false, "if set server-side apply will force changes against conflicts, like helm upgrade --force-conflicts. Without it, the objects whose dry-run server-side apply of --three-way-merge conflicts are reported as errors, or diffed with the conflicting fields flagged with --show-field-owners")
+	f.StringVar(&diff.serverSide, "server-side", serverSideAuto, `must be "true", "false" or "auto". Object updates run in the server instead of the client ("auto" defaults the value from the previous chart release's method). With --three-way-merge, objects applied server-side are diffed against a dry-run server-side apply`)
 
 	AddDiffOptions(f, &diff.Options)
 
 	return cmd
 }
 
-func (d *diffCmd) runHelm3() error {
-	if err := compatibleHelm3Version(); err != nil {
+func (d *diffCmd) runHelm3(ctx context.Context) error {
+	if err := compatibleHelm3Version(ctx); err != nil {
 		return err
 	}
 
@@ -275,14 +323,25 @@ func (d *diffCmd) runHelm3() error {
 
 	var err error
 
-	if d.takeOwnership {
+	if d.apiDeprecations.enabled() {
+		if d.KubeVersion, err = d.targetKubeVersion(); err != nil {
+			return err
+		}
+	}
+
+	if d.takeOwnership || d.showFieldOwners || d.showFieldOrigins {
 		// We need to do a three way merge between the manifests of the new
 		// release, the manifests of the old release and what is currently deployed
 		d.threeWayMerge = true
 	}
 
-	if d.clusterAccessAllowed() {
-		releaseManifest, err = getRelease(d.release, d.namespace, d.kubeContext)
+	if d.releaseReadAllowed() {
+		if d.stream {
+			// streamManifests reads the manifest from the release itself, without copying it
+			_, err = readRelease(d.release, 0, d.namespace, d.kubeContext, d.releaseFiles)
+		} else {
+			releaseManifest, err = getRelease(d.release, d.namespace, d.kubeContext, d.releaseFiles)
+		}
 	}
 
 	var newInstall bool
@@ -291,7 +350,7 @@ func (d *diffCmd) runHelm3() error {
 			newInstall = true
 			err = nil
 		} else {
-			fmt.Fprintf(os.Stderr, "********************\n\n\tRelease was not present in Helm.  Include the `--allow-unreleased` to perform diff without exiting in error.\n\n********************\n")
+			fmt.Fprintf(d.errOut, "********************\n\n\tRelease was not present in Helm.  Include the `--allow-unreleased` to perform diff without exiting in error.\n\n********************\n")
 			return err
 		}
 	}
@@ -299,43 +358,95 @@ func (d *diffCmd) runHelm3() error {
 		return fmt.Errorf("Failed to get release %s in namespace %s: %w", d.release, d.namespace, err)
 	}
 
-	installManifest, err := d.template(!newInstall)
+	if d.stream {
+		return d.streamManifests(ctx, newInstall)
+	}
+
+	installManifest, err := d.template(ctx, !newInstall)
 	if err != nil {
 		return fmt.Errorf("Failed to render chart: %w", err)
 	}
 
+	if d.Explain && !newInstall && d.releaseReadAllowed() {
+		d.Attribution, err = d.attributeChanges(ctx, releaseManifest, installManifest)
+		if err != nil {
+			return fmt.Errorf("unable to explain the changes: %w", err)
+		}
+	}
+
 	var actionConfig *action.Configuration
 	if d.threeWayMerge || d.takeOwnership {
 		actionConfig = new(action.Configuration)
 		localEnv := prepareEnvSettings(d.kubeContext)
+		withRequestTimeout(ctx, localEnv)
 		if err := actionConfig.Init(localEnv.RESTClientGetter(), localEnv.Namespace(), os.Getenv("HELM_DRIVER")); err != nil {
-			log.Fatalf("%+v", err)
+			return err
 		}
 		if err := actionConfig.KubeClient.IsReachable(); err != nil {
 			return err
 		}
 	}
 
+	var fieldOwners, applyConflicts map[string][]manifest.FieldOwner
+	var originals map[string]string
+	var generateErrors map[string]error
 	if d.threeWayMerge {
-		releaseManifest, installManifest, err = manifest.Generate(actionConfig, releaseManifest, installManifest)
+		serverSideApply, err := d.serverSideApply(newInstall)
+		if err != nil {
+			return err
+		}
+		generateOptions := manifest.GenerateOptions{
+			ServerSideApply:  serverSideApply,
+			ForceConflicts:   d.forceConflicts,
+			Concurrency:      d.concurrency,
+			ResourceErrors:   map[string]error{},
+			DefaultNamespace: d.namespace,
+		}
+		if d.showFieldOwners {
+			generateOptions.FieldOwners = map[string][]manifest.FieldOwner{}
+			generateOptions.ApplyConflicts = map[string][]manifest.FieldOwner{}
+		}
+		if d.showFieldOrigins {
+			generateOptions.Originals = map[string]string{}
+		}
+		releaseManifest, installManifest, err = manifest.GenerateWithContext(ctx, actionConfig, releaseManifest, installManifest, generateOptions)
 		if err != nil {
 			return fmt.Errorf("unable to generate manifests: %w", err)
 		}
+		fieldOwners, applyConflicts = generateOptions.FieldOwners, generateOptions.ApplyConflicts
+		originals, generateErrors = generateOptions.Originals, generateOptions.ResourceErrors
+	}
+
+	if newInstall || !d.releaseReadAllowed() {
+		releaseManifest = nil
+	} else if !d.noHooks && !d.threeWayMerge {
+		hooks, err := getHooks(d.release, d.namespace, d.kubeContext, d.releaseFiles)
+		if err != nil {
+			return err
+		}
+		releaseManifest = append(releaseManifest, hooks...)
 	}
 
 	currentSpecs := make(map[string]*manifest.MappingResult)
-	if !newInstall && d.clusterAccessAllowed() {
-		if !d.noHooks && !d.threeWayMerge {
-			hooks, err := getHooks(d.release, d.namespace, d.kubeContext)
-			if err != nil {
-				return err
+	if !newInstall && d.releaseReadAllowed() {
+		currentSpecs, err = d.parseRendered(releaseManifest)
+		if err != nil {
+			return err
+		}
+		for name, owners := range fieldOwners {
+			if spec, ok := currentSpecs[name]; ok {
+				spec.FieldOwners = owners
 			}
-			releaseManifest = append(releaseManifest, hooks...)
 		}
-		if d.includeTests {
-			currentSpecs = manifest.Parse(releaseManifest, d.namespace, d.normalizeManifests)
-		} else {
-			currentSpecs = manifest.Parse(releaseManifest, d.namespace, d.normalizeManifests, manifest.Helm3TestHook, manifest.Helm2TestSuccessHook)
+		for name, conflicts := range applyConflicts {
+			if spec, ok := currentSpecs[name]; ok {
+				spec.ApplyConflicts = conflicts
+			}
+		}
+		for name, original := range originals {
+			if spec, ok := currentSpecs[name]; ok {
+				spec.Original = original
+			}
 		}
 	}
 	releaseManifest = nil //nolint:ineffassign // nil to allow GC to reclaim raw bytes before diff computation
@@ -352,15 +463,35 @@ func (d *diffCmd) runHelm3() error {
 		}
 	}
 
-	var newSpecs map[string]*manifest.MappingResult
-	if d.includeTests {
-		newSpecs = manifest.Parse(installManifest, d.namespace, d.normalizeManifests)
-	} else {
-		newSpecs = manifest.Parse(installManifest, d.namespace, d.normalizeManifests, manifest.Helm3TestHook, manifest.Helm2TestSuccessHook)
+	newSpecs, err := d.parseRendered(installManifest)
+	if err != nil {
+		return err
 	}
 	installManifest = nil //nolint:ineffassign // nil to allow GC to reclaim raw bytes before diff computation
+	for name, err := range generateErrors {
+		newSpecs[name] = &manifest.MappingResult{Name: name, Err: err}
+	}
 
-	seenAnyChanges := diff.ManifestsOwnership(currentSpecs, newSpecs, newOwnedReleases, &d.Options, os.Stdout)
+	seenAnyChanges, err := printReport(ctx, currentSpecs, newSpecs, newOwnedReleases, &d.Options, d.out, d.saveReport)
+	if err != nil {
+		return err
+	}
+
+	if d.findOrphans {
+		if err := d.printOrphans(ctx, currentSpecs, newSpecs); err != nil {
+			return err
+		}
+	}
+
+	if err := resourceErrors(currentSpecs, newSpecs); err != nil {
+		return err
+	}
+
+	if d.apiDeprecations.enabled() {
+		if err := d.apiDeprecations.checkAPIDeprecations(d.KubeVersion, newSpecs); err != nil {
+			return err
+		}
+	}
 
 	if d.detailedExitCode && seenAnyChanges {
 		return Error{
@@ -372,13 +503,73 @@ func (d *diffCmd) runHelm3() error {
 	return nil
 }
 
-func checkOwnership(d *diffCmd, resources kube.ResourceList, currentSpecs map[string]*manifest.MappingResult) (map[string]diff.OwnershipDiff, error) {
-	newOwnedReleases := make(map[string]diff.OwnershipDiff)
-	err := resources.Visit(func(info *resource.Info, err error) error {
-		if err != nil {
-			return err
+// targetKubeVersion returns the Kubernetes version API deprecations are checked against:
+// --kube-version if set, the version of the cluster otherwise.
+func (d *diffCmd) targetKubeVersion() (string, error) {
+	kubeVersion := d.kubeVersion
+	if kubeVersion == "" {
+		if !d.clusterAccessAllowed() {
+			return "", errors.New("--check-deprecated-apis, --fail-on-deprecated-apis and --fail-on-removed-apis need --kube-version without cluster access")
+		}
+		var err error
+		if kubeVersion, err = serverKubeVersion(d.kubeContext); err != nil {
+			return "", err
 		}
+	}
+	if _, err := diff.ParseKubeVersion(kubeVersion); err != nil {
+		return "", err
+	}
+	return kubeVersion, nil
+}
 
+// serverSideApply tells whether the upgrade applies the objects server-side, following --server-side.
+// "auto" follows the apply method of the deployed release like helm upgrade does.
+func (d *diffCmd) serverSideApply(newInstall bool) (bool, error) {
+	switch d.serverSide {
+	case envTrue:
+		return true, nil
+	case envFalse:
+		return false, nil
+	}
+	if newInstall || !d.releaseReadAllowed() {
+		return false, nil
+	}
+	rel, err := readRelease(d.release, 0, d.namespace, d.kubeContext, d.releaseFiles)
+	if err != nil {
+		return false, err
+	}
+	return rel.ApplyMethod == string(releasev1.ApplyMethodServerSideApply), nil
+}
+
+// printOrphans lists the objects of the release that are part of neither of the given specs.
+// The list is written to errOut when the diff is machine-readable, to keep the output parseable.
+func (d *diffCmd) printOrphans(ctx context.Context, currentSpecs, newSpecs map[string]*manifest.MappingResult) error {
+	localEnv := prepareEnvSettings(d.kubeContext)
+	namespace := d.namespace
+	if namespace == "" {
+		namespace = localEnv.Namespace()
+	}
+
+	orphans, unlisted, err := findOrphansInCluster(ctx, localEnv.RESTClientGetter(), namespace, d.release, currentSpecs, newSpecs)
+	if err != nil {
+		return fmt.Errorf("unable to find orphaned resources: %w", err)
+	}
+
+	to := d.out
+	if !isTextOutput(d.OutputFormat) {
+		to = d.errOut
+	}
+	printOrphans(to, namespace, d.release, orphans, unlisted)
+	return nil
+}
+
+func checkOwnership(d *diffCmd, resources kube.ResourceList, currentSpecs map[string]*manifest.MappingResult) (map[string]diff.OwnershipDiff, error) {
+	type owned struct {
+		result     *manifest.MappingResult
+		oldRelease string
+	}
+	objects := make([]*owned, len(resources))
+	err := manifest.VisitConcurrently(resources, d.concurrency, func(i int, info *resource.Info) error {
 		helper := resource.NewHelper(info.Client, info.Mapping)
 		currentObj, err := helper.Get(info.Namespace, info.Name)
 		if err != nil {
@@ -400,19 +591,22 @@ func checkOwnership(d *diffCmd, resources kube.ResourceList, currentSpecs map[st
 			return err
 		}
 
-		newRelease := d.namespace + "/" + d.release
-		if oldRelease == newRelease {
-			return nil
-		}
+		objects[i] = &owned{result: result, oldRelease: oldRelease}
+		return nil
+	})
 
-		newOwnedReleases[result.Name] = diff.OwnershipDiff{
-			OldRelease: oldRelease,
+	newOwnedReleases := make(map[string]diff.OwnershipDiff)
+	newRelease := d.namespace + "/" + d.release
+	for _, o := range objects {
+		if o == nil || o.oldRelease == newRelease {
+			continue
+		}
+		newOwnedReleases[o.result.Name] = diff.OwnershipDiff{
+			OldRelease: o.oldRelease,
 			NewRelease: newRelease,
 		}
-		currentSpecs[result.Name] = result
-
-		return nil
-	})
+		currentSpecs[o.result.Name] = o.result
+	}
 	return newOwnedReleases, err
 }
 
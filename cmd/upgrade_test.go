@@ -5,6 +5,9 @@ import (
 	"path/filepath"
 	"slices"
 	"testing"
+
+	rcommon "helm.sh/helm/v4/pkg/release/common"
+	releasev1 "helm.sh/helm/v4/pkg/release/v1"
 )
 
 func TestIsRemoteAccessAllowed(t *testing.T) {
@@ -205,3 +208,51 @@ func TestServerSideFlagValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestConcurrencyFlagValidation(t *testing.T) {
+	cmd := newChartCommand()
+	cmd.SetArgs([]string{"app", "chart", "--concurrency", "0"})
+	err := cmd.Execute()
+	if err == nil || err.Error() != "--concurrency must be at least 1, but got 0" {
+		t.Errorf("expected the concurrency to be rejected, got %v", err)
+	}
+}
+
+func TestServerSideApply(t *testing.T) {
+	setupMemoryDriver(t)
+
+	ssa := testRelease(1, rcommon.StatusDeployed, "")
+	ssa.ApplyMethod = string(releasev1.ApplyMethodServerSideApply)
+	csa := testRelease(1, rcommon.StatusDeployed, "")
+	csa.Name = "csa"
+	csa.ApplyMethod = string(releasev1.ApplyMethodClientSideApply)
+	releaseFiles := []string{writeReleaseFile(t, secretRecord(t, ssa)), writeReleaseFile(t, secretRecord(t, csa))}
+
+	cases := []struct {
+		name       string
+		release    string
+		serverSide string
+		dryRunMode string
+		newInstall bool
+		expected   bool
+	}{
+		{name: "true", release: "csa", serverSide: envTrue, dryRunMode: dryRunNone, expected: true},
+		{name: "false", release: "app", serverSide: envFalse, dryRunMode: dryRunNone},
+		{name: "auto with a release applied server-side", release: "app", serverSide: serverSideAuto, dryRunMode: dryRunNone, expected: true},
+		{name: "auto with a release applied client-side", release: "csa", serverSide: serverSideAuto, dryRunMode: dryRunNone},
+		{name: "auto with a new install", release: "app", serverSide: serverSideAuto, dryRunMode: dryRunNone, newInstall: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := diffCmd{release: tc.release, namespace: "prod", serverSide: tc.serverSide, dryRunMode: tc.dryRunMode, releaseFiles: releaseFiles}
+			actual, err := d.serverSideApply(tc.newInstall)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
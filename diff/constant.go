@@ -9,5 +9,26 @@ const defaultTemplateReport = `[
   "namespace": "{{ $entry.Namespace }}",
   "name": "{{ $entry.Name }}",
   "change": "{{ $entry.Change }}"
+{{- if $entry.Explanation }},
+  "explanation": {{ toJson $entry.Explanation }}
+{{- end }}
+{{- if $entry.Error }},
+  "error": {{ toJson $entry.Error }}
+{{- end }}
+{{- if $entry.ImmutableFields }},
+  "immutableFields": {{ toJson $entry.ImmutableFields }}
+{{- end }}
+{{- if $entry.Rollout }},
+  "rollout": {{ toJson $entry.Rollout }}
+{{- end }}
+{{- if $entry.APIDeprecation }},
+  "apiDeprecation": {{ toJson $entry.APIDeprecation }}
+{{- end }}
+{{- if $entry.FieldConflicts }},
+  "fieldConflicts": {{ toJson $entry.FieldConflicts }}
+{{- end }}
+{{- if $entry.FieldOrigins }},
+  "fieldOrigins": {{ toJson $entry.FieldOrigins }}
+{{- end }}
 }{{ if not (last $idx  $global) }},{{ end }}
 {{- end }}]`
@@ -0,0 +1,161 @@
+package diff
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/version"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+type apiKind struct {
+	apiVersion string
+	kind       string
+}
+
+type apiLifecycle struct {
+	deprecatedIn string
+	removedIn    string
+	replacement  string
+}
+
+// apiLifecycles are the Kubernetes versions deprecating and removing served API versions, by apiVersion and kind.
+// See https://kubernetes.io/docs/reference/using-api/deprecation-guide/.
+var apiLifecycles = map[apiKind]apiLifecycle{
+	{"extensions/v1beta1", "Deployment"}:        {"1.9", "1.16", "apps/v1"},
+	{"apps/v1beta1", "Deployment"}:              {"1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", "Deployment"}:              {"1.9", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "DaemonSet"}:         {"1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", "DaemonSet"}:               {"1.9", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "ReplicaSet"}:        {"1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", "ReplicaSet"}:              {"1.9", "1.16", "apps/v1"},
+	{"apps/v1beta1", "StatefulSet"}:             {"1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", "StatefulSet"}:             {"1.9", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "NetworkPolicy"}:     {"1.9", "1.16", "networking.k8s.io/v1"},
+	{"extensions/v1beta1", "PodSecurityPolicy"}: {"1.10", "1.16", "policy/v1beta1"},
+
+	{"admissionregistration.k8s.io/v1beta1", "MutatingWebhookConfiguration"}:   {"1.16", "1.22", "admissionregistration.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", "ValidatingWebhookConfiguration"}: {"1.16", "1.22", "admissionregistration.k8s.io/v1"},
+	{"apiextensions.k8s.io/v1beta1", "CustomResourceDefinition"}:               {"1.16", "1.22", "apiextensions.k8s.io/v1"},
+	{"apiregistration.k8s.io/v1beta1", "APIService"}:                           {"1.19", "1.22", "apiregistration.k8s.io/v1"},
+	{"authentication.k8s.io/v1beta1", "TokenReview"}:                           {"1.19", "1.22", "authentication.k8s.io/v1"},
+	{"authorization.k8s.io/v1beta1", "LocalSubjectAccessReview"}:               {"1.19", "1.22", "authorization.k8s.io/v1"},
+	{"authorization.k8s.io/v1beta1", "SelfSubjectAccessReview"}:                {"1.19", "1.22", "authorization.k8s.io/v1"},
+	{"authorization.k8s.io/v1beta1", "SubjectAccessReview"}:                    {"1.19", "1.22", "authorization.k8s.io/v1"},
+	{"certificates.k8s.io/v1beta1", "CertificateSigningRequest"}:               {"1.19", "1.22", "certificates.k8s.io/v1"},
+	{"coordination.k8s.io/v1beta1", "Lease"}:                                   {"1.19", "1.22", "coordination.k8s.io/v1"},
+	{"extensions/v1beta1", "Ingress"}:                                          {"1.14", "1.22", "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "Ingress"}:                                   {"1.19", "1.22", "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "IngressClass"}:                              {"1.19", "1.22", "networking.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRole"}:                       {"1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRoleBinding"}:                {"1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "Role"}:                              {"1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "RoleBinding"}:                       {"1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"scheduling.k8s.io/v1beta1", "PriorityClass"}:                             {"1.14", "1.22", "scheduling.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSIDriver"}:                                    {"1.19", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSINode"}:                                      {"1.17", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "StorageClass"}:                                 {"1.14", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "VolumeAttachment"}:                             {"1.15", "1.22", "storage.k8s.io/v1"},
+
+	{"batch/v1beta1", "CronJob"}:                       {"1.21", "1.25", "batch/v1"},
+	{"discovery.k8s.io/v1beta1", "EndpointSlice"}:      {"1.21", "1.25", "discovery.k8s.io/v1"},
+	{"events.k8s.io/v1beta1", "Event"}:                 {"1.19", "1.25", "events.k8s.io/v1"},
+	{"autoscaling/v2beta1", "HorizontalPodAutoscaler"}: {"1.22", "1.25", "autoscaling/v2"},
+	{"policy/v1beta1", "PodDisruptionBudget"}:          {"1.21", "1.25", "policy/v1"},
+	{"policy/v1beta1", "PodSecurityPolicy"}:            {"1.21", "1.25", ""},
+	{"node.k8s.io/v1beta1", "RuntimeClass"}:            {"1.20", "1.25", "node.k8s.io/v1"},
+
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "FlowSchema"}:                 {"1.23", "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "PriorityLevelConfiguration"}: {"1.23", "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"autoscaling/v2beta2", "HorizontalPodAutoscaler"}:                     {"1.23", "1.26", "autoscaling/v2"},
+	{"storage.k8s.io/v1beta1", "CSIStorageCapacity"}:                       {"1.24", "1.27", "storage.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "FlowSchema"}:                 {"1.26", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "PriorityLevelConfiguration"}: {"1.26", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "FlowSchema"}:                 {"1.29", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "PriorityLevelConfiguration"}: {"1.29", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+}
+
+// APIDeprecation is the use of an API version that is deprecated or removed in the target Kubernetes version.
+type APIDeprecation struct {
+	APIVersion   string `json:"apiVersion"`
+	Kind         string `json:"kind"`
+	DeprecatedIn string `json:"deprecatedIn"`
+	RemovedIn    string `json:"removedIn"`
+	// Removed tells whether the target Kubernetes version does not serve the API version anymore.
+	Removed bool `json:"removed"`
+	// Replacement is the API version to migrate to, if any.
+	Replacement string `json:"replacement,omitempty"`
+}
+
+func (d APIDeprecation) String() string {
+	s := fmt.Sprintf("%s %s deprecated in %s, removed in %s", d.APIVersion, d.Kind, d.DeprecatedIn, d.RemovedIn)
+	if d.Removed {
+		s = fmt.Sprintf("%s %s removed in %s", d.APIVersion, d.Kind, d.RemovedIn)
+	}
+	if d.Replacement != "" {
+		s += ", use " + d.Replacement
+	}
+	return s
+}
+
+// ParseKubeVersion parses the Kubernetes version API deprecations are checked against, like 1.25 or v1.25.3.
+func ParseKubeVersion(kubeVersion string) (*version.Version, error) {
+	v, err := version.ParseGeneric(kubeVersion)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kubernetes version %q: %w", kubeVersion, err)
+	}
+	return v, nil
+}
+
+// FindAPIDeprecations returns the deprecated and removed API versions the manifests use in the Kubernetes version,
+// by resource key.
+func FindAPIDeprecations(index map[string]*manifest.MappingResult, kubeVersion string) (map[string]APIDeprecation, error) {
+	target, err := ParseKubeVersion(kubeVersion)
+	if err != nil {
+		return nil, err
+	}
+	deprecations := map[string]APIDeprecation{}
+	for key, content := range index {
+		if d := apiDeprecation(content, target); d != nil {
+			deprecations[key] = *d
+		}
+	}
+	return deprecations, nil
+}
+
+// apiDeprecation returns the deprecation of the API version of the manifest in Options.KubeVersion, if any.
+func (o *Options) apiDeprecation(content *manifest.MappingResult) *APIDeprecation {
+	if o.KubeVersion == "" {
+		return nil
+	}
+	target, err := ParseKubeVersion(o.KubeVersion)
+	if err != nil {
+		return nil
+	}
+	return apiDeprecation(content, target)
+}
+
+// apiDeprecation returns the deprecation of the API version of the manifest in the target version, if any.
+func apiDeprecation(content *manifest.MappingResult, target *version.Version) *APIDeprecation {
+	if content == nil || target == nil {
+		return nil
+	}
+	_, obj, err := manifestToJSON(content)
+	if err != nil || obj == nil {
+		return nil
+	}
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	lifecycle, ok := apiLifecycles[apiKind{apiVersion, kind}]
+	if !ok || !target.AtLeast(version.MustParseGeneric(lifecycle.deprecatedIn)) {
+		return nil
+	}
+	return &APIDeprecation{
+		APIVersion:   apiVersion,
+		Kind:         kind,
+		DeprecatedIn: lifecycle.deprecatedIn,
+		RemovedIn:    lifecycle.removedIn,
+		Removed:      target.AtLeast(version.MustParseGeneric(lifecycle.removedIn)),
+		Replacement:  lifecycle.replacement,
+	}
+}
@@ -0,0 +1,107 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mgutz/ansi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+func pdbYAML(apiVersion, minAvailable string) string {
+	return "apiVersion: " + apiVersion + "\nkind: PodDisruptionBudget\nmetadata:\n  name: app\nspec:\n  minAvailable: " + minAvailable + "\n"
+}
+
+func TestFindAPIDeprecations(t *testing.T) {
+	index := map[string]*manifest.MappingResult{
+		"pdb":     parseObject(t, pdbYAML("policy/v1beta1", "1")),
+		"current": parseObject(t, pdbYAML("policy/v1", "1")),
+		"hpa":     parseObject(t, "apiVersion: autoscaling/v2beta2\nkind: HorizontalPodAutoscaler\n"),
+	}
+
+	for _, tc := range []struct {
+		kubeVersion string
+		expected    map[string]APIDeprecation
+	}{
+		{kubeVersion: "1.20", expected: map[string]APIDeprecation{}},
+		{
+			kubeVersion: "v1.23.4",
+			expected: map[string]APIDeprecation{
+				"pdb": {APIVersion: "policy/v1beta1", Kind: "PodDisruptionBudget", DeprecatedIn: "1.21", RemovedIn: "1.25", Replacement: "policy/v1"},
+				"hpa": {APIVersion: "autoscaling/v2beta2", Kind: "HorizontalPodAutoscaler", DeprecatedIn: "1.23", RemovedIn: "1.26", Replacement: "autoscaling/v2"},
+			},
+		},
+		{
+			kubeVersion: "v1.25.3-eks-4f4795d",
+			expected: map[string]APIDeprecation{
+				"pdb": {APIVersion: "policy/v1beta1", Kind: "PodDisruptionBudget", DeprecatedIn: "1.21", RemovedIn: "1.25", Removed: true, Replacement: "policy/v1"},
+				"hpa": {APIVersion: "autoscaling/v2beta2", Kind: "HorizontalPodAutoscaler", DeprecatedIn: "1.23", RemovedIn: "1.26", Replacement: "autoscaling/v2"},
+			},
+		},
+	} {
+		t.Run(tc.kubeVersion, func(t *testing.T) {
+			deprecations, err := FindAPIDeprecations(index, tc.kubeVersion)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, deprecations)
+		})
+	}
+
+	_, err := FindAPIDeprecations(index, "latest")
+	require.ErrorContains(t, err, `invalid Kubernetes version "latest"`)
+}
+
+func TestAPIDeprecationString(t *testing.T) {
+	require.Equal(t, "policy/v1beta1 PodDisruptionBudget removed in 1.25, use policy/v1",
+		APIDeprecation{APIVersion: "policy/v1beta1", Kind: "PodDisruptionBudget", DeprecatedIn: "1.21", RemovedIn: "1.25", Removed: true, Replacement: "policy/v1"}.String())
+	require.Equal(t, "policy/v1beta1 PodSecurityPolicy deprecated in 1.21, removed in 1.25",
+		APIDeprecation{APIVersion: "policy/v1beta1", Kind: "PodSecurityPolicy", DeprecatedIn: "1.21", RemovedIn: "1.25"}.String())
+}
+
+func TestAPIDeprecationReport(t *testing.T) {
+	ansi.DisableColors(true)
+	oldIndex := indexOf(parseObject(t, pdbYAML("policy/v1beta1", "1")))
+	newIndex := indexOf(parseObject(t, pdbYAML("policy/v1beta1", "2")))
+	warning := "policy/v1beta1 PodDisruptionBudget removed in 1.25, use policy/v1"
+
+	t.Run("without kube version", func(t *testing.T) {
+		var buf bytes.Buffer
+		Manifests(oldIndex, newIndex, &Options{OutputFormat: "diff", OutputContext: -1}, &buf)
+		require.NotContains(t, buf.String(), warning)
+	})
+
+	t.Run("unchanged objects", func(t *testing.T) {
+		report, err := Compare(context.Background(), oldIndex, oldIndex, &Options{OutputContext: -1, KubeVersion: "1.25"})
+		require.NoError(t, err)
+		require.False(t, report.HasChanges())
+		require.Len(t, report.Entries, 1)
+		require.Equal(t, "UNCHANGED", report.Entries[0].ChangeType)
+
+		for _, format := range []string{"diff", "simple", "dyff", "json", "structured", "markdown", "html"} {
+			var buf bytes.Buffer
+			require.NoError(t, report.Write(&buf, format))
+			require.Contains(t, buf.String(), "policy/v1", format)
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, report.Write(&buf, "simple"))
+		require.Equal(t, "default, app, PodDisruptionBudget (policy) is unchanged:\n  ! "+warning+"\n"+
+			"Plan: 0 to add, 0 to change, 0 to destroy, 0 to change ownership.\n"+
+			"Deprecated APIs: 1 unchanged resources use deprecated or removed API versions.\n", buf.String())
+
+		buf.Reset()
+		require.NoError(t, report.Write(&buf, "structured"))
+		var entries []StructuredEntry
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entries))
+		require.Len(t, entries, 1)
+		require.Equal(t, "PodDisruptionBudget", entries[0].Kind)
+		require.True(t, entries[0].APIDeprecation.Removed)
+
+		report, err = Compare(context.Background(), oldIndex, oldIndex, &Options{OutputContext: -1})
+		require.NoError(t, err)
+		require.Empty(t, report.Entries)
+	})
+}
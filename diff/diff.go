@@ -2,10 +2,10 @@ package diff
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"math"
-	"os"
 	"regexp"
 	"sort"
 	"strings"
@@ -30,6 +30,26 @@ type Options struct {
 	SuppressedKinds           []string
 	FindRenames               float32
 	SuppressedOutputLineRegex []string
+	// SourceMapping renames source template paths before releases are compared,
+	// pairing templates of releases created from different charts.
+	SourceMapping map[string]string
+	// IgnoreChartName compares releases by source template paths without
+	// the leading chart name, so that releases created from different charts line up.
+	IgnoreChartName bool
+	// Interactive browses the report in a terminal UI instead of printing it,
+	// when the output is a terminal.
+	Interactive bool
+	// Explain attaches the source template and subchart to every entry of the report.
+	Explain bool
+	// Attribution tells which changes come from the chart and which from the values.
+	// It is only used together with Explain.
+	Attribution *Attribution
+	// KubeVersion is the Kubernetes version the API versions of the new manifests are checked against,
+	// flagging deprecated and removed ones. No check runs if it is empty.
+	KubeVersion string
+
+	// allFormats builds the report for every output format rather than for OutputFormat only. See Compare.
+	allFormats bool
 }
 
 const kindSecret = "Secret"
@@ -39,57 +59,119 @@ func (o *Options) StructuredOutput() bool {
 	return o != nil && o.OutputFormat == "structured"
 }
 
+// lineDiffs tells whether the entries of the report need line diffs, which all output formats but structured print.
+func (o *Options) lineDiffs() bool {
+	return o.allFormats || o.customFormat() || !o.StructuredOutput()
+}
+
+// structuredEntries tells whether the entries of the report need structured entries for the structured output.
+func (o *Options) structuredEntries() bool {
+	return o.allFormats || o.customFormat() || o.StructuredOutput()
+}
+
+// customFormat tells whether the output format is not one of this package, which may use everything in the report.
+func (o *Options) customFormat() bool {
+	if o == nil {
+		return false
+	}
+	_, builtin := lookupFormat(o.OutputFormat).(builtinFormat)
+	return !builtin
+}
+
 type OwnershipDiff struct {
 	OldRelease string
 	NewRelease string
 }
 
+// Compare diffs the old and the new manifests into a report, which can be written in every output format.
+// It returns an error if the options are invalid or ctx is done before the diff completes.
+func Compare(ctx context.Context, oldIndex, newIndex map[string]*manifest.MappingResult, options *Options) (*Report, error) {
+	return CompareOwnership(ctx, oldIndex, newIndex, nil, options)
+}
+
+// CompareOwnership is Compare with the releases whose objects change ownership.
+func CompareOwnership(ctx context.Context, oldIndex, newIndex map[string]*manifest.MappingResult, newOwnedReleases map[string]OwnershipDiff, options *Options) (*Report, error) {
+	opts := *options
+	opts.allFormats = true
+	return generateReport(ctx, oldIndex, newIndex, newOwnedReleases, &opts)
+}
+
+// Print diffs the old and the new manifests and prints the report in the output format of the options, or browses it
+// with Options.Interactive when to is a terminal. It returns whether there are changes.
+func Print(ctx context.Context, oldIndex, newIndex map[string]*manifest.MappingResult, newOwnedReleases map[string]OwnershipDiff, options *Options, to io.Writer) (bool, error) {
+	report, err := generateReport(ctx, oldIndex, newIndex, newOwnedReleases, options)
+	if err != nil {
+		return false, err
+	}
+
+	if err := report.Show(ctx, to, options); err != nil {
+		return false, err
+	}
+	return report.HasChanges(), nil
+}
+
 // Manifests diff on manifests
+//
+// Deprecated: use Print, or Compare and Report.Write, which return errors rather than writing them to to.
 func Manifests(oldIndex, newIndex map[string]*manifest.MappingResult, options *Options, to io.Writer) bool {
 	return ManifestsOwnership(oldIndex, newIndex, nil, options, to)
 }
 
+// ManifestsOwnership diff on manifests and on the releases whose objects change ownership.
+// An error diffing the manifests is reported as an entry of the ERROR change type, like the resources that cannot be
+// diffed, and errors writing the report are lost.
+//
+// Deprecated: use Print, or CompareOwnership and Report.Write, which return errors rather than reporting them.
 func ManifestsOwnership(oldIndex, newIndex map[string]*manifest.MappingResult, newOwnedReleases map[string]OwnershipDiff, options *Options, to io.Writer) bool {
-	seenAnyChanges, report, err := generateReport(oldIndex, newIndex, newOwnedReleases, options)
+	report, err := generateReport(context.Background(), oldIndex, newIndex, newOwnedReleases, options)
 	if err != nil {
-		panic(err)
+		report = &Report{}
+		addErrorEntry(report, "manifests", nil, nil, err, options)
 	}
-
-	report.print(to)
-	report.clean()
-	return seenAnyChanges
+	_ = report.Show(context.Background(), to, options)
+	return report.HasChanges()
 }
 
 func ManifestReport(oldIndex, newIndex map[string]*manifest.MappingResult, options *Options) (*Report, error) {
-	_, report, err := generateReport(oldIndex, newIndex, nil, options)
-
-	return report, err
+	return generateReport(context.Background(), oldIndex, newIndex, nil, options)
 }
 
-func generateReport(oldIndex, newIndex map[string]*manifest.MappingResult, newOwnedReleases map[string]OwnershipDiff, options *Options) (bool, *Report, error) {
+func generateReport(ctx context.Context, oldIndex, newIndex map[string]*manifest.MappingResult, newOwnedReleases map[string]OwnershipDiff, options *Options) (*Report, error) {
 	report := Report{findRenames: options.FindRenames}
-	report.setupReportFormat(options.OutputFormat)
 	var possiblyRemoved []string
+	failed := failedSources(newIndex)
 
 	for name, diff := range newOwnedReleases {
 		diff := diffStrings(diff.OldRelease, diff.NewRelease, true)
-		report.addEntry(name, options.SuppressedKinds, "", 0, diff, "OWNERSHIP", nil)
+		report.addEntry(ReportEntry{Key: name, SuppressedKinds: options.SuppressedKinds, Diffs: diff, ChangeType: "OWNERSHIP"})
 	}
 
 	for _, key := range sortedKeys(oldIndex) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		oldContent := oldIndex[key]
 
 		if newContent, ok := newIndex[key]; ok {
 			// modified?
 			doDiff(&report, key, oldContent, newContent, options)
-		} else {
+		} else if oldContent.Err != nil {
+			doDiff(&report, key, oldContent, nil, options)
+		} else if !failed[oldContent.Source] {
 			possiblyRemoved = append(possiblyRemoved, key)
 		}
 	}
 
 	var possiblyAdded []string
 	for _, key := range sortedKeys(newIndex) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if _, ok := oldIndex[key]; !ok {
+			if newIndex[key].Err != nil {
+				doDiff(&report, key, nil, newIndex[key], options)
+				continue
+			}
 			possiblyAdded = append(possiblyAdded, key)
 		}
 	}
@@ -107,12 +189,25 @@ func generateReport(oldIndex, newIndex map[string]*manifest.MappingResult, newOw
 		newContent := newIndex[key]
 		doDiff(&report, key, nil, newContent, options)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	seenAnyChanges := len(report.Entries) > 0
+	seenAnyChanges := false
+	for _, entry := range report.Entries {
+		if entry.ChangeType != "UNCHANGED" {
+			seenAnyChanges = true
+			break
+		}
+	}
 
 	report, err := doSuppress(report, options.SuppressedOutputLineRegex)
+	if err != nil {
+		return nil, err
+	}
+	report.changes = seenAnyChanges
 
-	return seenAnyChanges, &report, err
+	return &report, nil
 }
 
 func doSuppress(report Report, suppressedOutputLineRegex []string) (Report, error) {
@@ -123,7 +218,6 @@ func doSuppress(report Report, suppressedOutputLineRegex []string) (Report, erro
 	filteredReport := Report{
 		findRenames: report.findRenames,
 	}
-	filteredReport.format = report.format
 	filteredReport.Entries = []ReportEntry{}
 
 	var suppressOutputRegexes []*regexp.Regexp
@@ -169,7 +263,8 @@ func doSuppress(report Report, suppressedOutputLineRegex []string) (Report, erro
 			entry.ChangeType = "MODIFY_SUPPRESSED"
 		}
 
-		filteredReport.addEntry(entry.Key, entry.SuppressedKinds, entry.Kind, entry.Context, diffRecords, entry.ChangeType, entry.Structured)
+		entry.Diffs = diffRecords
+		filteredReport.addEntry(entry)
 	}
 
 	return filteredReport, nil
@@ -255,9 +350,24 @@ func contentSearch(report *Report, possiblyRemoved []string, oldIndex map[string
 }
 
 func doDiff(report *Report, key string, oldContent *manifest.MappingResult, newContent *manifest.MappingResult, options *Options) {
+	if err := resourceError(oldContent, newContent); err != nil {
+		addErrorEntry(report, key, oldContent, newContent, err, options)
+		return
+	}
 	if oldContent != nil && newContent != nil && oldContent.Content == newContent.Content {
+		addUnchangedEntry(report, key, oldContent, newContent, options)
 		return
 	}
+	var explanation *Explanation
+	if options.Explain {
+		explanation = explain(key, oldContent, newContent, options)
+	}
+	change := newObjectChange(oldContent, newContent)
+	conflicts := fieldConflicts(change)
+	origins := fieldOrigins(change)
+	immutable := immutableFieldChanges(change)
+	rolls := rollout(change)
+	deprecation := options.apiDeprecation(newContent)
 	switch {
 	case options.ShowSecretsDecoded:
 		decodeSecrets(oldContent, newContent)
@@ -274,45 +384,126 @@ func doDiff(report *Report, key string, oldContent *manifest.MappingResult, newC
 		if newContent != nil {
 			subjectKind = newContent.Kind
 		}
-		if !options.StructuredOutput() && newContent != nil {
+		if options.lineDiffs() && newContent != nil {
 			emptyMapping := &manifest.MappingResult{}
 			diffs = diffMappingResults(emptyMapping, newContent, options.StripTrailingCR)
 		}
 	case newContent == nil:
 		changeType = "REMOVE"
 		subjectKind = oldContent.Kind
-		if !options.StructuredOutput() {
+		if options.lineDiffs() {
 			emptyMapping := &manifest.MappingResult{}
 			diffs = diffMappingResults(oldContent, emptyMapping, options.StripTrailingCR)
 		}
 	default:
 		changeType = "MODIFY"
 		subjectKind = oldContent.Kind
-		if !options.StructuredOutput() {
+		if options.lineDiffs() {
 			diffs = diffMappingResults(oldContent, newContent, options.StripTrailingCR)
-			if actualChanges(diffs) == 0 {
+			if !options.StructuredOutput() && actualChanges(diffs) == 0 {
 				return
 			}
 		}
 	}
 
 	var structured *StructuredEntry
-	if options.StructuredOutput() {
-		entry, err := buildStructuredEntry(key, changeType, subjectKind, options.SuppressedKinds, oldContent, newContent)
+	var changesError string
+	if options.structuredEntries() {
+		entry, err := buildStructuredEntry(key, changeType, subjectKind, options.SuppressedKinds, change)
 		if err != nil {
-			// Log warning and omit field-level changes for this entry
-			// printStructuredReport() will still output a basic entry with name and changeType
-			fmt.Fprintf(os.Stderr, "Warning: failed to build structured entry for %s (kind: %s, changeType: %s): %v\n",
-				key, subjectKind, changeType, err)
+			// omit field-level changes for this entry, printStructuredReport() still outputs a basic entry
+			// with name, changeType and the error
+			changesError = err.Error()
 		} else {
-			if changeType == "MODIFY" && !entry.ChangesSuppressed && len(entry.Changes) == 0 {
+			if options.StructuredOutput() && changeType == "MODIFY" && !entry.ChangesSuppressed && len(entry.Changes) == 0 {
 				return
 			}
 			structured = entry
 		}
 	}
 
-	report.addEntry(key, options.SuppressedKinds, subjectKind, options.OutputContext, diffs, changeType, structured)
+	report.addEntry(ReportEntry{
+		Key:             key,
+		SuppressedKinds: options.SuppressedKinds,
+		Kind:            subjectKind,
+		Context:         options.OutputContext,
+		Diffs:           diffs,
+		ChangeType:      changeType,
+		Structured:      structured,
+		Explanation:     explanation,
+		FieldConflicts:  conflicts,
+		FieldOrigins:    origins,
+		ImmutableFields: immutable,
+		Rollout:         rolls,
+		APIDeprecation:  deprecation,
+		ChangesError:    changesError,
+	})
+}
+
+// resourceError returns the error of the resource, if either side of it could not be parsed or generated.
+func resourceError(oldContent, newContent *manifest.MappingResult) error {
+	for _, content := range []*manifest.MappingResult{newContent, oldContent} {
+		if content != nil && content.Err != nil {
+			return content.Err
+		}
+	}
+	return nil
+}
+
+// addUnchangedEntry reports an unchanged resource with the UNCHANGED change type if its API version is deprecated
+// or removed in Options.KubeVersion, so that the report warns about it like about changed resources.
+func addUnchangedEntry(report *Report, key string, oldContent, newContent *manifest.MappingResult, options *Options) {
+	deprecation := options.apiDeprecation(newContent)
+	if deprecation == nil {
+		return
+	}
+	var structured *StructuredEntry
+	var changesError string
+	if options.structuredEntries() {
+		entry, err := buildStructuredEntry(key, "UNCHANGED", newContent.Kind, options.SuppressedKinds, newObjectChange(oldContent, newContent))
+		if err != nil {
+			changesError = err.Error()
+		}
+		structured = entry
+	}
+	report.addEntry(ReportEntry{
+		Key:             key,
+		SuppressedKinds: options.SuppressedKinds,
+		Kind:            newContent.Kind,
+		Context:         options.OutputContext,
+		ChangeType:      "UNCHANGED",
+		Structured:      structured,
+		APIDeprecation:  deprecation,
+		ChangesError:    changesError,
+	})
+}
+
+// addErrorEntry reports a resource that could not be diffed with the ERROR change type.
+func addErrorEntry(report *Report, key string, oldContent, newContent *manifest.MappingResult, err error, options *Options) {
+	var kind string
+	for _, content := range []*manifest.MappingResult{newContent, oldContent} {
+		if content != nil && content.Kind != "" {
+			kind = content.Kind
+			break
+		}
+	}
+	var structured *StructuredEntry
+	if options.structuredEntries() {
+		structured = &StructuredEntry{Kind: kind, ChangeType: "ERROR", Error: err.Error()}
+		structured.populateMetadata(key)
+		if structured.Name == "" {
+			structured.Name = key
+		}
+	}
+	report.addEntry(ReportEntry{
+		Key:             key,
+		SuppressedKinds: options.SuppressedKinds,
+		Kind:            kind,
+		Context:         options.OutputContext,
+		ChangeType:      "ERROR",
+		Structured:      structured,
+		Error:           err.Error(),
+	})
 }
 
 func preHandleSecrets(old, new *manifest.MappingResult) (v1.Secret, v1.Secret, error, error) {
@@ -455,10 +646,19 @@ func getComment(s string) string {
 	return s[:i+1]
 }
 
+// PrintReleases reindexes the content based on the template names and passes it to Print.
+func PrintReleases(ctx context.Context, oldIndex, newIndex map[string]*manifest.MappingResult, options *Options, to io.Writer) (bool, error) {
+	oldIndex = reIndexForRelease(oldIndex, options)
+	newIndex = reIndexForRelease(newIndex, options)
+	return Print(ctx, oldIndex, newIndex, nil, options, to)
+}
+
 // Releases reindex the content  based on the template names and pass it to Manifests
+//
+// Deprecated: use PrintReleases, which returns errors rather than printing them to stderr.
 func Releases(oldIndex, newIndex map[string]*manifest.MappingResult, options *Options, to io.Writer) bool {
-	oldIndex = reIndexForRelease(oldIndex)
-	newIndex = reIndexForRelease(newIndex)
+	oldIndex = reIndexForRelease(oldIndex, options)
+	newIndex = reIndexForRelease(newIndex, options)
 	return Manifests(oldIndex, newIndex, options, to)
 }
 
@@ -492,25 +692,39 @@ func printDiffRecords(suppressedKinds []string, kind string, context int, diffs
 		}
 	}
 
-	if context >= 0 {
-		distances := calculateDistances(diffs)
-		omitting := false
-		for i, diff := range diffs {
-			if distances[i] > context {
-				if !omitting {
-					_, _ = fmt.Fprintln(to, "...")
-					omitting = true
-				}
-			} else {
-				omitting = false
-				printDiffRecord(diff, to)
-			}
+	for _, diff := range contextRecords(diffs, context) {
+		if diff == nil {
+			_, _ = fmt.Fprintln(to, "...")
+			continue
 		}
-	} else {
-		for _, diff := range diffs {
-			printDiffRecord(diff, to)
+		printDiffRecord(*diff, to)
+	}
+}
+
+// contextRecords returns the records within context lines of a change, all of them if context is negative.
+// Every run of omitted records is replaced by a nil record.
+func contextRecords(diffs []difflib.DiffRecord, context int) []*difflib.DiffRecord {
+	records := make([]*difflib.DiffRecord, 0, len(diffs))
+	if context < 0 {
+		for i := range diffs {
+			records = append(records, &diffs[i])
+		}
+		return records
+	}
+	distances := calculateDistances(diffs)
+	omitting := false
+	for i := range diffs {
+		if distances[i] > context {
+			if !omitting {
+				records = append(records, nil)
+				omitting = true
+			}
+		} else {
+			omitting = false
+			records = append(records, &diffs[i])
 		}
 	}
+	return records
 }
 
 func printDiffRecord(diff difflib.DiffRecord, to io.Writer) {
@@ -566,7 +780,7 @@ func calculateDistances(diffs []difflib.DiffRecord) map[int]int {
 }
 
 // reIndexForRelease based on template names
-func reIndexForRelease(index map[string]*manifest.MappingResult) map[string]*manifest.MappingResult {
+func reIndexForRelease(index map[string]*manifest.MappingResult, options *Options) map[string]*manifest.MappingResult {
 	// sort the index to iterate map in the same order
 	var keys []string
 	for key := range index {
@@ -580,20 +794,45 @@ func reIndexForRelease(index map[string]*manifest.MappingResult) map[string]*man
 	newIndex := make(map[string]*manifest.MappingResult)
 
 	for key := range keys {
-		str := strings.Replace(strings.Split(index[keys[key]].Content, "\n")[0], "# Source: ", "", 1)
+		result := index[keys[key]]
+		firstLine, rest, _ := strings.Cut(result.Content, "\n")
+		source := strings.Replace(firstLine, "# Source: ", "", 1)
+		str := sourceKey(source, options)
+		if str != source {
+			// rewrite the source comment as well, it would otherwise show up as a change
+			rewritten := *result
+			rewritten.Content = "# Source: " + str + "\n" + rest
+			result = &rewritten
+		}
 
 		if _, ok := newIndex[str]; ok {
 			count[str]++
 			str += fmt.Sprintf(" %d", count[str])
-			newIndex[str] = index[keys[key]]
+			newIndex[str] = result
 		} else {
-			newIndex[str] = index[keys[key]]
+			newIndex[str] = result
 			count[str]++
 		}
 	}
 	return newIndex
 }
 
+// sourceKey returns the key a resource rendered from the given source template is compared by.
+func sourceKey(source string, options *Options) string {
+	if options == nil {
+		return source
+	}
+	if mapped, ok := options.SourceMapping[source]; ok {
+		source = mapped
+	}
+	if options.IgnoreChartName {
+		if i := strings.Index(source, "/"); i >= 0 {
+			source = source[i+1:]
+		}
+	}
+	return source
+}
+
 func sortedKeys(manifests map[string]*manifest.MappingResult) []string {
 	var keys []string
 
@@ -605,3 +844,16 @@ func sortedKeys(manifests map[string]*manifest.MappingResult) []string {
 
 	return keys
 }
+
+// failedSources returns the templates of the manifest that rendered documents which cannot be parsed.
+// The objects these templates rendered before are left out of the removed ones: the failing documents
+// most likely still render them, so that reporting them as removed would be wrong.
+func failedSources(manifests map[string]*manifest.MappingResult) map[string]bool {
+	sources := map[string]bool{}
+	for _, content := range manifests {
+		if content.Err != nil && content.Source != "" {
+			sources[content.Source] = true
+		}
+	}
+	return sources
+}
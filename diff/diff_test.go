@@ -2,8 +2,10 @@ package diff
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/aryann/difflib"
@@ -13,6 +15,32 @@ import (
 	"github.com/databus23/helm-diff/v3/manifest"
 )
 
+// parseManifest parses the documents into an index the way helm-diff does, with default as the default namespace.
+func parseManifest(t *testing.T, documents ...string) map[string]*manifest.MappingResult {
+	t.Helper()
+	index := manifest.Parse([]byte(strings.Join(documents, "\n---\n")), "default", false)
+	require.Len(t, index, len(documents))
+	return index
+}
+
+// parseObject parses the document of a single object like parseManifest.
+func parseObject(t *testing.T, document string) *manifest.MappingResult {
+	t.Helper()
+	for _, result := range parseManifest(t, document) {
+		return result
+	}
+	return nil
+}
+
+// indexOf returns the index of parsed objects, by their names.
+func indexOf(results ...*manifest.MappingResult) map[string]*manifest.MappingResult {
+	index := map[string]*manifest.MappingResult{}
+	for _, result := range results {
+		index[result.Name] = result
+	}
+	return index
+}
+
 var text1 = "" +
 	"line1\n" +
 	"line2\n" +
@@ -278,7 +306,7 @@ annotations:
 
 	t.Run("OnChange", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.0, []string{}}
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.0, SuppressedOutputLineRegex: []string{}}
 
 		if changesSeen := Manifests(specBeta, specRelease, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -297,7 +325,7 @@ annotations:
 
 	t.Run("OnChangeWithSuppress", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.0, []string{"apiVersion"}}
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.0, SuppressedOutputLineRegex: []string{"apiVersion"}}
 
 		if changesSeen := Manifests(specBeta, specReleaseSpec, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -316,7 +344,7 @@ annotations:
 
 	t.Run("OnChangeWithSuppressAll", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.0, []string{"apiVersion"}}
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.0, SuppressedOutputLineRegex: []string{"apiVersion"}}
 
 		if changesSeen := Manifests(specBeta, specRelease, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -328,7 +356,7 @@ annotations:
 
 	t.Run("OnChangeRename", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.5, []string{}}
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.5, SuppressedOutputLineRegex: []string{}}
 
 		if changesSeen := Manifests(specReleaseSpec, specReleaseRenamed, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -349,7 +377,7 @@ annotations:
 
 	t.Run("OnChangeRenameAndUpdate", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.5, []string{}}
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.5, SuppressedOutputLineRegex: []string{}}
 
 		if changesSeen := Manifests(specReleaseSpec, specReleaseRenamedAndUpdated, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -371,7 +399,7 @@ annotations:
 
 	t.Run("OnChangeRenameAndAdded", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.5, []string{}}
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.5, SuppressedOutputLineRegex: []string{}}
 
 		if changesSeen := Manifests(specReleaseSpec, specReleaseRenamedAndAdded, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -395,7 +423,7 @@ annotations:
 
 	t.Run("OnChangeRenameAndAddedWithPartialSuppress", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.5, []string{"app: "}}
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.5, SuppressedOutputLineRegex: []string{"app: "}}
 
 		if changesSeen := Manifests(specReleaseSpec, specReleaseRenamedAndAdded, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -418,7 +446,7 @@ annotations:
 
 	t.Run("OnChangeRenameAndRemoved", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.5, []string{}}
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.5, SuppressedOutputLineRegex: []string{}}
 
 		if changesSeen := Manifests(specReleaseRenamedAndAdded, specReleaseSpec, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -442,7 +470,7 @@ annotations:
 
 	t.Run("OnChangeRenameAndRemovedWithPartialSuppress", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.5, []string{"app: "}}
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.5, SuppressedOutputLineRegex: []string{"app: "}}
 
 		if changesSeen := Manifests(specReleaseRenamedAndAdded, specReleaseSpec, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -465,7 +493,7 @@ annotations:
 
 	t.Run("OnNoChange", func(t *testing.T) {
 		var buf2 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.0, []string{}}
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.0, SuppressedOutputLineRegex: []string{}}
 
 		if changesSeen := Manifests(specRelease, specRelease, &diffOptions, &buf2); changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `false` to indicate that it has NOT seen any change(s), but was `true`")
@@ -476,7 +504,7 @@ annotations:
 
 	t.Run("OnChangeRemoved", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.5, []string{}}
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.5, SuppressedOutputLineRegex: []string{}}
 
 		if changesSeen := Manifests(specRelease, nil, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -494,7 +522,7 @@ annotations:
 
 	t.Run("OnChangeRemovedWithResourcePolicyKeep", func(t *testing.T) {
 		var buf2 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.0, []string{}}
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.0, SuppressedOutputLineRegex: []string{}}
 
 		if changesSeen := Manifests(specReleaseKeep, nil, &diffOptions, &buf2); changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `false` to indicate that it has NOT seen any change(s), but was `true`")
@@ -505,7 +533,7 @@ annotations:
 
 	t.Run("OnChangeSimple", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"simple", 10, false, true, false, []string{}, 0.0, []string{}}
+		diffOptions := Options{OutputFormat: "simple", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.0, SuppressedOutputLineRegex: []string{}}
 
 		if changesSeen := Manifests(specBeta, specRelease, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -518,7 +546,7 @@ Plan: 0 to add, 1 to change, 0 to destroy, 0 to change ownership.
 
 	t.Run("OnNoChangeSimple", func(t *testing.T) {
 		var buf2 bytes.Buffer
-		diffOptions := Options{"simple", 10, false, true, false, []string{}, 0.0, []string{}}
+		diffOptions := Options{OutputFormat: "simple", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.0, SuppressedOutputLineRegex: []string{}}
 		if changesSeen := Manifests(specRelease, specRelease, &diffOptions, &buf2); changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `false` to indicate that it has NOT seen any change(s), but was `true`")
 		}
@@ -528,7 +556,7 @@ Plan: 0 to add, 1 to change, 0 to destroy, 0 to change ownership.
 
 	t.Run("OnChangeTemplate", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"template", 10, false, true, false, []string{}, 0.0, []string{}}
+		diffOptions := Options{OutputFormat: "template", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.0, SuppressedOutputLineRegex: []string{}}
 
 		if changesSeen := Manifests(specBeta, specRelease, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -546,7 +574,7 @@ Plan: 0 to add, 1 to change, 0 to destroy, 0 to change ownership.
 
 	t.Run("OnChangeJSON", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"json", 10, false, true, false, []string{}, 0.0, []string{}}
+		diffOptions := Options{OutputFormat: "json", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.0, SuppressedOutputLineRegex: []string{}}
 
 		if changesSeen := Manifests(specBeta, specRelease, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -564,7 +592,7 @@ Plan: 0 to add, 1 to change, 0 to destroy, 0 to change ownership.
 
 	t.Run("OnNoChangeTemplate", func(t *testing.T) {
 		var buf2 bytes.Buffer
-		diffOptions := Options{"template", 10, false, true, false, []string{}, 0.0, []string{}}
+		diffOptions := Options{OutputFormat: "template", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.0, SuppressedOutputLineRegex: []string{}}
 
 		if changesSeen := Manifests(specRelease, specRelease, &diffOptions, &buf2); changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `false` to indicate that it has NOT seen any change(s), but was `true`")
@@ -576,7 +604,7 @@ Plan: 0 to add, 1 to change, 0 to destroy, 0 to change ownership.
 	t.Run("OnChangeCustomTemplate", func(t *testing.T) {
 		var buf1 bytes.Buffer
 		os.Setenv("HELM_DIFF_TPL", "testdata/customTemplate.tpl")
-		diffOptions := Options{"template", 10, false, true, false, []string{}, 0.0, []string{}}
+		diffOptions := Options{OutputFormat: "template", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.0, SuppressedOutputLineRegex: []string{}}
 
 		if changesSeen := Manifests(specBeta, specRelease, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `false` to indicate that it has NOT seen any change(s), but was `true`")
@@ -842,6 +870,7 @@ data:
 		require.NoError(t, json.Unmarshal(buf.Bytes(), &entries))
 		require.Len(t, entries, 1)
 		require.Equal(t, "MODIFY", entries[0].ChangeType)
+		require.Contains(t, entries[0].ChangesError, "convert new manifest")
 	})
 
 	t.Run("InvalidOldManifestYAML", func(t *testing.T) {
@@ -860,6 +889,7 @@ data:
 		require.NoError(t, json.Unmarshal(buf.Bytes(), &entries))
 		require.Len(t, entries, 1)
 		require.Equal(t, "MODIFY", entries[0].ChangeType)
+		require.Contains(t, entries[0].ChangesError, "convert old manifest")
 	})
 
 	t.Run("ArrayDocumentProducesJSONUnmarshalError", func(t *testing.T) {
@@ -884,6 +914,7 @@ data:
 		require.NoError(t, json.Unmarshal(buf.Bytes(), &entries))
 		require.Len(t, entries, 1)
 		require.Equal(t, "ADD", entries[0].ChangeType)
+		require.Contains(t, entries[0].ChangesError, "convert new manifest")
 	})
 }
 
@@ -1134,7 +1165,7 @@ stringData:
 
 	t.Run("OnChangeSecretWithByteData", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, false, false, []string{}, 0.5, []string{}} // NOTE: ShowSecrets = false
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: false, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.5, SuppressedOutputLineRegex: []string{}} // NOTE: ShowSecrets = false
 
 		if changesSeen := Manifests(specSecretWithByteData, specSecretWithByteDataChanged, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -1159,7 +1190,7 @@ stringData:
 
 	t.Run("OnChangeSecretWithStringData", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, false, false, []string{}, 0.5, []string{}} // NOTE: ShowSecrets = false
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: false, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.5, SuppressedOutputLineRegex: []string{}} // NOTE: ShowSecrets = false
 
 		if changesSeen := Manifests(specSecretWithStringData, specSecretWithStringDataChanged, &diffOptions, &buf1); !changesSeen {
 			t.Error("Unexpected return value from Manifests: Expected the return value to be `true` to indicate that it has seen any change(s), but was `false`")
@@ -1284,7 +1315,7 @@ data:
 
 	t.Run("OnChangeOwnershipWithoutSpecChange", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.5, []string{}} // NOTE: ShowSecrets = false
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.5, SuppressedOutputLineRegex: []string{}} // NOTE: ShowSecrets = false
 
 		newOwnedReleases := map[string]OwnershipDiff{
 			"default, foobar, ConfigMap (v1)": {
@@ -1304,7 +1335,7 @@ data:
 
 	t.Run("OnChangeOwnershipWithSpecChange", func(t *testing.T) {
 		var buf1 bytes.Buffer
-		diffOptions := Options{"diff", 10, false, true, false, []string{}, 0.5, []string{}} // NOTE: ShowSecrets = false
+		diffOptions := Options{OutputFormat: "diff", OutputContext: 10, StripTrailingCR: false, ShowSecrets: true, ShowSecretsDecoded: false, SuppressedKinds: []string{}, FindRenames: 0.5, SuppressedOutputLineRegex: []string{}} // NOTE: ShowSecrets = false
 
 		specNew := map[string]*manifest.MappingResult{
 			"default, foobar, ConfigMap (v1)": {
@@ -1796,3 +1827,77 @@ spec:
 		require.Contains(t, buf.String(), "has been added")
 	})
 }
+
+func TestCompare(t *testing.T) {
+	ansi.DisableColors(true)
+	oldIndex := parseManifest(t, deploymentYAML("3", "app:1.0", "ops"))
+	newIndex := parseManifest(t, deploymentYAML("3", "app:2.0", "ops"))
+
+	report, err := Compare(context.Background(), oldIndex, newIndex, &Options{OutputContext: -1})
+	require.NoError(t, err)
+	require.True(t, report.HasChanges())
+
+	var buf bytes.Buffer
+	require.NoError(t, report.Write(&buf, "diff"))
+	require.Contains(t, buf.String(), "-         image: app:1.0\n+         image: app:2.0\n")
+
+	buf.Reset()
+	require.NoError(t, report.Write(&buf, "simple"))
+	require.Contains(t, buf.String(), "Plan: 0 to add, 1 to change, 0 to destroy, 0 to change ownership.\n")
+
+	buf.Reset()
+	require.NoError(t, report.Write(&buf, "structured"))
+	var entries []StructuredEntry
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entries))
+	require.Len(t, entries, 1)
+	require.Equal(t, "spec.template.spec.containers[0]", entries[0].Changes[0].Path)
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := Compare(ctx, oldIndex, newIndex, &Options{})
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("invalid suppression", func(t *testing.T) {
+		_, err := Compare(context.Background(), oldIndex, newIndex, &Options{SuppressedOutputLineRegex: []string{"("}})
+		require.Error(t, err)
+	})
+
+	t.Run("missing custom template", func(t *testing.T) {
+		t.Setenv("HELM_DIFF_TPL", "testdata/missing.tpl")
+		require.ErrorContains(t, report.Write(&buf, "template"), "error loading custom template")
+	})
+
+	t.Run("template entries named by their keys", func(t *testing.T) {
+		buf.Reset()
+		report := &Report{Entries: []ReportEntry{
+			{Key: ", admin, ClusterRole (rbac.authorization.k8s.io)", ChangeType: "ADD"},
+			{Key: "document 2", ChangeType: "ERROR", Error: "invalid"},
+		}}
+		// the default template, whatever HELM_DIFF_TPL other tests set
+		tpl, err := newTemplate("entries").Parse(defaultTemplateReport)
+		require.NoError(t, err)
+		require.NoError(t, templateReportPrinter(tpl)(report, &buf))
+		var templateData []ReportTemplateSpec
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &templateData))
+		require.Len(t, templateData, 2)
+		require.Equal(t, "admin", templateData[0].Name)
+		require.Equal(t, "document 2", templateData[1].Name)
+	})
+
+	t.Run("deprecated API reports errors as entries", func(t *testing.T) {
+		buf.Reset()
+		require.False(t, ManifestsOwnership(oldIndex, newIndex, nil, &Options{SuppressedOutputLineRegex: []string{"("}}, &buf))
+		require.Contains(t, buf.String(), "manifests could not be diffed:")
+		require.NotContains(t, buf.String(), "Error: ")
+
+		buf.Reset()
+		ManifestsOwnership(oldIndex, newIndex, nil, &Options{OutputFormat: "structured", SuppressedOutputLineRegex: []string{"("}}, &buf)
+		var entries []StructuredEntry
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entries))
+		require.Len(t, entries, 1)
+		require.Equal(t, "ERROR", entries[0].ChangeType)
+		require.Contains(t, entries[0].Error, "missing closing )")
+	})
+}
@@ -0,0 +1,152 @@
+package diff
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+// Origins of a change as reported by Explanation.Origin.
+const (
+	OriginChart          = "chart"
+	OriginValues         = "values"
+	OriginChartAndValues = "chart and values"
+)
+
+// Explanation tells where the changes of a report entry come from.
+type Explanation struct {
+	// Source is the template the resource was rendered from.
+	Source string `json:"source,omitempty"`
+	// Subchart is the subchart the template belongs to, empty for templates of the chart itself.
+	// Nested subcharts are joined by slashes.
+	Subchart string `json:"subchart,omitempty"`
+	// Origin is one of OriginChart, OriginValues and OriginChartAndValues, or empty when unknown.
+	Origin string `json:"origin,omitempty"`
+	// ValuesKeys are the values keys whose change caused the diff, if known.
+	ValuesKeys []string `json:"valuesKeys,omitempty"`
+}
+
+// String returns a single line description of the explanation.
+func (e *Explanation) String() string {
+	var b strings.Builder
+	b.WriteString("source ")
+	if e.Source == "" {
+		b.WriteString("unknown")
+	} else {
+		b.WriteString(e.Source)
+	}
+	if e.Subchart != "" {
+		b.WriteString(" of subchart ")
+		b.WriteString(e.Subchart)
+	}
+	if e.Origin != "" {
+		b.WriteString(", changed by the ")
+		b.WriteString(e.Origin)
+	}
+	if len(e.ValuesKeys) > 0 {
+		b.WriteString(" (")
+		b.WriteString(strings.Join(e.ValuesKeys, ", "))
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+// Attribution records which resources change because of a new chart and which because of new values.
+// It is keyed like the indexes passed to Manifests.
+type Attribution struct {
+	// Chart holds the resources that render differently with the new chart and the old values.
+	Chart map[string]bool
+	// Values holds the resources that render differently with the new values,
+	// mapped to the values keys responsible for the difference, if known.
+	Values map[string][]string
+}
+
+// Attribute builds an Attribution from renders of the new chart.
+// current is the deployed release, withOldValues and withNewValues the new chart rendered with the
+// values of the release and with the new values. byValuesKey optionally holds, for each changed values key,
+// the new chart rendered with the values of the release and only that key changed.
+func Attribute(current, withOldValues, withNewValues map[string]*manifest.MappingResult, byValuesKey map[string]map[string]*manifest.MappingResult) *Attribution {
+	a := &Attribution{Chart: map[string]bool{}, Values: map[string][]string{}}
+	for _, key := range changedKeys(current, withOldValues) {
+		a.Chart[key] = true
+	}
+	for _, key := range changedKeys(withOldValues, withNewValues) {
+		a.Values[key] = nil
+	}
+
+	valuesKeys := make([]string, 0, len(byValuesKey))
+	for valuesKey := range byValuesKey {
+		valuesKeys = append(valuesKeys, valuesKey)
+	}
+	sort.Strings(valuesKeys)
+	for _, valuesKey := range valuesKeys {
+		for _, key := range changedKeys(withOldValues, byValuesKey[valuesKey]) {
+			if _, ok := a.Values[key]; ok {
+				a.Values[key] = append(a.Values[key], valuesKey)
+			}
+		}
+	}
+	return a
+}
+
+// changedKeys returns the keys of the resources that are missing from one of the indexes or differ between them.
+func changedKeys(a, b map[string]*manifest.MappingResult) []string {
+	var keys []string
+	for key, resultA := range a {
+		if resultB, ok := b[key]; !ok || resultA.Content != resultB.Content {
+			keys = append(keys, key)
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// explain returns the explanation of the changes of the resource with the given key.
+func explain(key string, oldContent, newContent *manifest.MappingResult, options *Options) *Explanation {
+	e := &Explanation{}
+	for _, content := range []*manifest.MappingResult{newContent, oldContent} {
+		if content == nil {
+			continue
+		}
+		if source, ok := strings.CutPrefix(strings.TrimSuffix(getComment(content.Content), "\n"), "# Source: "); ok {
+			e.Source = source
+			e.Subchart = subchart(source)
+			break
+		}
+	}
+
+	if a := options.Attribution; a != nil {
+		valuesKeys, byValues := a.Values[key]
+		switch {
+		case a.Chart[key] && byValues:
+			e.Origin = OriginChartAndValues
+		case a.Chart[key]:
+			e.Origin = OriginChart
+		case byValues:
+			e.Origin = OriginValues
+		}
+		e.ValuesKeys = valuesKeys
+	}
+	return e
+}
+
+// subchart returns the subchart a template path like parent/charts/sub/templates/x.yaml belongs to.
+func subchart(source string) string {
+	parts := strings.Split(source, "/")
+	var subcharts []string
+	for i := 1; i < len(parts)-1; i++ {
+		if parts[i] == "charts" {
+			subcharts = append(subcharts, parts[i+1])
+			i++
+		}
+		if parts[i] == "templates" {
+			break
+		}
+	}
+	return strings.Join(subcharts, "/")
+}
@@ -0,0 +1,98 @@
+package diff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mgutz/ansi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+func sourcedYAML(name, source, data string) string {
+	return "# Source: " + source + "\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: " + name + "\ndata:\n  key: " + data + "\n"
+}
+
+func TestSubchart(t *testing.T) {
+	for source, expected := range map[string]string{
+		"app/templates/cm.yaml":                          "",
+		"app/charts/redis/templates/cm.yaml":             "redis",
+		"app/charts/redis/charts/common/templates/x.yml": "redis/common",
+		"app/templates/charts/cm.yaml":                   "",
+		"":                                               "",
+	} {
+		require.Equal(t, expected, subchart(source), source)
+	}
+}
+
+func TestAttribute(t *testing.T) {
+	current := indexOf(
+		parseObject(t, sourcedYAML("chart", "app/templates/chart.yaml", "v1")),
+		parseObject(t, sourcedYAML("values", "app/templates/values.yaml", "v1")),
+		parseObject(t, sourcedYAML("both", "app/templates/both.yaml", "v1")),
+		parseObject(t, sourcedYAML("removed", "app/templates/removed.yaml", "v1")),
+	)
+	withOldValues := indexOf(
+		parseObject(t, sourcedYAML("chart", "app/templates/chart.yaml", "v2")),
+		parseObject(t, sourcedYAML("values", "app/templates/values.yaml", "v1")),
+		parseObject(t, sourcedYAML("both", "app/templates/both.yaml", "v2")),
+	)
+	withNewValues := indexOf(
+		parseObject(t, sourcedYAML("chart", "app/templates/chart.yaml", "v2")),
+		parseObject(t, sourcedYAML("values", "app/templates/values.yaml", "v3")),
+		parseObject(t, sourcedYAML("both", "app/templates/both.yaml", "v3")),
+		parseObject(t, sourcedYAML("added", "app/charts/sub/templates/added.yaml", "v1")),
+	)
+	byValuesKey := map[string]map[string]*manifest.MappingResult{
+		"image.tag": indexOf(
+			parseObject(t, sourcedYAML("chart", "app/templates/chart.yaml", "v2")),
+			parseObject(t, sourcedYAML("values", "app/templates/values.yaml", "v3")),
+			parseObject(t, sourcedYAML("both", "app/templates/both.yaml", "v3")),
+		),
+		"sub.enabled": indexOf(
+			parseObject(t, sourcedYAML("chart", "app/templates/chart.yaml", "v2")),
+			parseObject(t, sourcedYAML("values", "app/templates/values.yaml", "v1")),
+			parseObject(t, sourcedYAML("both", "app/templates/both.yaml", "v3")),
+			parseObject(t, sourcedYAML("added", "app/charts/sub/templates/added.yaml", "v1")),
+		),
+	}
+
+	a := Attribute(current, withOldValues, withNewValues, byValuesKey)
+	require.Equal(t, map[string]bool{
+		"default, chart, ConfigMap (v1)":   true,
+		"default, both, ConfigMap (v1)":    true,
+		"default, removed, ConfigMap (v1)": true,
+	}, a.Chart)
+	require.Equal(t, map[string][]string{
+		"default, values, ConfigMap (v1)": {"image.tag"},
+		"default, both, ConfigMap (v1)":   {"image.tag", "sub.enabled"},
+		"default, added, ConfigMap (v1)":  {"sub.enabled"},
+	}, a.Values)
+
+	ansi.DisableColors(true)
+	var buf bytes.Buffer
+	changes := Manifests(current, withNewValues, &Options{OutputFormat: "simple", OutputContext: -1, Explain: true, Attribution: a}, &buf)
+	require.True(t, changes)
+	require.Equal(t, `default, both, ConfigMap (v1) to be changed.
+  source app/templates/both.yaml, changed by the chart and values (image.tag, sub.enabled)
+default, chart, ConfigMap (v1) to be changed.
+  source app/templates/chart.yaml, changed by the chart
+default, values, ConfigMap (v1) to be changed.
+  source app/templates/values.yaml, changed by the values (image.tag)
+default, removed, ConfigMap (v1) to be removed.
+  source app/templates/removed.yaml, changed by the chart
+default, added, ConfigMap (v1) to be added.
+  source app/charts/sub/templates/added.yaml of subchart sub, changed by the values (sub.enabled)
+Plan: 1 to add, 3 to change, 1 to destroy, 0 to change ownership.
+`, buf.String())
+}
+
+func TestExplainWithoutOption(t *testing.T) {
+	oldIndex := indexOf(parseObject(t, sourcedYAML("cm", "app/charts/sub/templates/cm.yaml", "v1")))
+	newIndex := indexOf(parseObject(t, sourcedYAML("cm", "app/charts/sub/templates/cm.yaml", "v2")))
+
+	var buf bytes.Buffer
+	Manifests(oldIndex, newIndex, &Options{OutputFormat: "json", OutputContext: -1}, &buf)
+	require.NotContains(t, buf.String(), "explanation")
+}
@@ -0,0 +1,110 @@
+package diff
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+// Origins of a changed field of a three-way merge as reported by FieldOrigin.Origin.
+const (
+	// FieldOriginChart is a field the new chart changes.
+	FieldOriginChart = "chart change"
+	// FieldOriginRevertsDrift is a field changed in the cluster that the upgrade sets back to the chart's value.
+	FieldOriginRevertsDrift = "reverts live drift"
+	// FieldOriginDriftPreserved is a field changed in the cluster that the upgrade keeps.
+	FieldOriginDriftPreserved = "live drift preserved"
+)
+
+// FieldOrigin tells where the change of a field of a three-way merge comes from.
+type FieldOrigin struct {
+	// Path is the path of the field, list items given by their index.
+	Path   string `json:"path"`
+	Origin string `json:"origin"`
+}
+
+// String returns a single line description of the origin.
+func (o FieldOrigin) String() string {
+	return o.Path + ": " + o.Origin
+}
+
+// fieldOrigins labels the changed fields of a live object by origin, comparing the live object,
+// the result of the upgrade and the object of the deployed release manifest.
+// Fields only set in the live object, mostly defaulted by the API server, do not count as drift.
+func fieldOrigins(change *objectChange) []FieldOrigin {
+	if change.oldContent == nil || change.newContent == nil || change.oldContent.Original == "" {
+		return nil
+	}
+	liveObj, resultObj := change.objects()
+	if liveObj == nil {
+		return nil
+	}
+	originalJSON, originalObj, err := manifestToJSON(&manifest.MappingResult{Content: change.oldContent.Original})
+	if err != nil || originalJSON == nil {
+		return nil
+	}
+	liveJSON := change.oldJSON
+
+	changes, err := change.fieldChanges()
+	if err != nil {
+		return nil
+	}
+	var origins []FieldOrigin
+	changed := make([]string, 0, len(changes))
+	for _, change := range changes {
+		path := changePath(change)
+		changed = append(changed, path)
+		origin := FieldOriginChart
+		original := valueAt(originalObj, change.tokens)
+		drifted := !reflect.DeepEqual(original, valueAt(liveObj, change.tokens))
+		if drifted && reflect.DeepEqual(original, valueAt(resultObj, change.tokens)) {
+			origin = FieldOriginRevertsDrift
+		}
+		origins = append(origins, FieldOrigin{Path: path, Origin: origin})
+	}
+
+	drifts, err := calculateFieldChanges(originalJSON, liveJSON)
+	if err != nil {
+		return origins
+	}
+	for _, drift := range drifts {
+		if drift.Change == "add" {
+			continue
+		}
+		path := changePath(drift)
+		if overlapsAny(path, changed) {
+			continue
+		}
+		origins = append(origins, FieldOrigin{Path: path, Origin: FieldOriginDriftPreserved})
+	}
+	return origins
+}
+
+// valueAt returns the value at the path of keys and list indexes in the object, nil if it is not set.
+func valueAt(node interface{}, tokens []string) interface{} {
+	for _, token := range tokens {
+		switch typed := node.(type) {
+		case map[string]interface{}:
+			node = typed[token]
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i >= len(typed) {
+				return nil
+			}
+			node = typed[i]
+		default:
+			return nil
+		}
+	}
+	return node
+}
+
+func overlapsAny(path string, paths []string) bool {
+	for _, p := range paths {
+		if overlaps(path, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+// liveDeployment returns the live object of a three-way merge with the deployed release manifest as original.
+func liveDeployment(live, original *manifest.MappingResult) *manifest.MappingResult {
+	live.Original = original.Content
+	return live
+}
+
+func TestFieldOrigins(t *testing.T) {
+	original := parseObject(t, deploymentYAML("3", "app:1.0", "ops"))
+
+	t.Run("chart change", func(t *testing.T) {
+		live := liveDeployment(parseObject(t, deploymentYAML("3", "app:1.0", "ops")), original)
+		require.Equal(t, []FieldOrigin{
+			{Path: "spec.template.spec.containers[0].image", Origin: FieldOriginChart},
+		}, fieldOrigins(newObjectChange(live, parseObject(t, deploymentYAML("3", "app:2.0", "ops")))))
+	})
+
+	t.Run("reverted and preserved drift", func(t *testing.T) {
+		live := liveDeployment(parseObject(t, deploymentYAML("5", "app:1.0", "edited")), original)
+		require.Equal(t, []FieldOrigin{
+			{Path: "spec.replicas", Origin: FieldOriginRevertsDrift},
+			{Path: "spec.template.spec.containers[0].image", Origin: FieldOriginChart},
+			{Path: "metadata.annotations.owner", Origin: FieldOriginDriftPreserved},
+		}, fieldOrigins(newObjectChange(live, parseObject(t, deploymentYAML("3", "app:2.0", "edited")))))
+	})
+
+	t.Run("chart change over drift", func(t *testing.T) {
+		live := liveDeployment(parseObject(t, deploymentYAML("5", "app:1.0", "ops")), original)
+		require.Equal(t, []FieldOrigin{
+			{Path: "spec.replicas", Origin: FieldOriginChart},
+		}, fieldOrigins(newObjectChange(live, parseObject(t, deploymentYAML("4", "app:1.0", "ops")))))
+	})
+
+	t.Run("fields defaulted in the cluster are no drift", func(t *testing.T) {
+		live := liveDeployment(parseObject(t, deploymentYAML("3", "app:1.0", "ops")+"  revisionHistoryLimit: 10\n"), original)
+		newContent := parseObject(t, deploymentYAML("3", "app:2.0", "ops")+"  revisionHistoryLimit: 10\n")
+		require.Equal(t, []FieldOrigin{
+			{Path: "spec.template.spec.containers[0].image", Origin: FieldOriginChart},
+		}, fieldOrigins(newObjectChange(live, newContent)))
+	})
+
+	t.Run("without the original", func(t *testing.T) {
+		require.Empty(t, fieldOrigins(newObjectChange(parseObject(t, deploymentYAML("5", "app:1.0", "ops")), parseObject(t, deploymentYAML("3", "app:1.0", "ops")))))
+	})
+}
+
+func TestValueAt(t *testing.T) {
+	obj := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"image": "app:1.0"}},
+		},
+	}
+	require.Equal(t, "app:1.0", valueAt(obj, []string{"spec", "containers", "0", "image"}))
+	require.Nil(t, valueAt(obj, []string{"spec", "containers", "1", "image"}))
+	require.Nil(t, valueAt(obj, []string{"spec", "containers", "0", "image", "tag"}))
+	require.Nil(t, valueAt(obj, []string{"metadata", "name"}))
+}
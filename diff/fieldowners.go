@@ -0,0 +1,142 @@
+package diff
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// FieldConflict is a changed field of a resource owned by other field managers than Helm in the cluster.
+type FieldConflict struct {
+	// Path is the path of the changed field, list items given by their index.
+	Path string `json:"path"`
+	// Managers are the other field managers owning the field, a field below or a field above it.
+	Managers []FieldManager `json:"managers"`
+	// FailsServerSideApply is set when the dry-run server-side apply of the upgrade conflicts on the field,
+	// so that the upgrade fails without forcing conflicts. See manifest.MappingResult.ApplyConflicts.
+	FailsServerSideApply bool `json:"failsServerSideApply,omitempty"`
+	// RevertedBy are the managers known as controllers, which may revert the change.
+	RevertedBy []string `json:"revertedBy,omitempty"`
+}
+
+// FieldManager is a field manager of the managedFields of an object.
+type FieldManager struct {
+	Name string `json:"name"`
+	// Operation is Apply or Update.
+	Operation string `json:"operation,omitempty"`
+}
+
+// Flagged tells whether the conflict makes the upgrade fail or the change not stick.
+func (c FieldConflict) Flagged() bool {
+	return c.FailsServerSideApply || len(c.RevertedBy) > 0
+}
+
+// String returns a single line description of the conflict.
+func (c FieldConflict) String() string {
+	managers := make([]string, 0, len(c.Managers))
+	for _, m := range c.Managers {
+		managers = append(managers, m.Name+" ("+m.Operation+")")
+	}
+	s := c.Path + " is owned by " + strings.Join(managers, ", ")
+	if c.FailsServerSideApply {
+		s += ", conflicts with the server-side apply"
+	}
+	if len(c.RevertedBy) > 0 {
+		s += ", may be reverted by " + strings.Join(c.RevertedBy, ", ")
+	}
+	return s
+}
+
+// fieldConflicts returns the changed fields of a resource that other field managers own in the live object.
+func fieldConflicts(change *objectChange) []FieldConflict {
+	oldContent := change.oldContent
+	if oldContent == nil || change.newContent == nil || len(oldContent.FieldOwners) == 0 {
+		return nil
+	}
+	if oldObj, _ := change.objects(); oldObj == nil {
+		return nil
+	}
+	changes, err := change.fieldChanges()
+	if err != nil {
+		return nil
+	}
+
+	var conflicts []FieldConflict
+	for _, change := range changes {
+		path := changePath(change)
+		conflict := FieldConflict{Path: path}
+		seen := map[FieldManager]bool{}
+		for _, owner := range oldContent.FieldOwners {
+			if !overlaps(path, formatPath(owner.Path)) {
+				continue
+			}
+			m := FieldManager{Name: owner.Manager, Operation: owner.Operation}
+			if seen[m] {
+				continue
+			}
+			seen[m] = true
+			conflict.Managers = append(conflict.Managers, m)
+		}
+		if len(conflict.Managers) == 0 {
+			continue
+		}
+		sort.Slice(conflict.Managers, func(i, j int) bool {
+			return conflict.Managers[i].Name < conflict.Managers[j].Name
+		})
+		conflict.RevertedBy = managerNames(conflict.Managers, isController)
+		for _, applyConflict := range oldContent.ApplyConflicts {
+			if overlaps(path, formatPath(applyConflict.Path)) {
+				conflict.FailsServerSideApply = true
+			}
+		}
+		conflicts = append(conflicts, conflict)
+	}
+	return conflicts
+}
+
+// managerNames returns the sorted names of the managers matching the predicate, each name once.
+func managerNames(managers []FieldManager, matches func(FieldManager) bool) []string {
+	var names []string
+	for _, m := range managers {
+		if matches(m) && !slices.Contains(names, m.Name) {
+			names = append(names, m.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// changePath returns the full path of the changed field.
+func changePath(change FieldChange) string {
+	switch {
+	case change.Path == "":
+		return change.Field
+	case isArrayIndex(change.Field):
+		return change.Path + "[" + change.Field + "]"
+	default:
+		return change.Path + "." + change.Field
+	}
+}
+
+// overlaps tells whether one of the paths is the other one or a field below it.
+func overlaps(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return a == b || strings.HasPrefix(b, a+".") || strings.HasPrefix(b, a+"[")
+}
+
+// controllerManagers are the field managers of well-known controllers updating objects on their own,
+// like the HPA controller of kube-controller-manager scaling Deployments.
+var controllerManagers = map[string]bool{
+	"kube-controller-manager": true,
+	"kube-scheduler":          true,
+	"cluster-autoscaler":      true,
+	"vpa-updater":             true,
+}
+
+// isController tells whether the field manager is a well-known controller, rather than
+// an ordinary API client or a user running kubectl.
+func isController(m FieldManager) bool {
+	return controllerManagers[m.Name]
+}
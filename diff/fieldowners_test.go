@@ -0,0 +1,84 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+func deploymentYAML(replicas, image, annotation string) string {
+	return "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n  annotations:\n    owner: " + annotation +
+		"\nspec:\n  replicas: " + replicas + "\n  template:\n    spec:\n      containers:\n      - name: app\n        image: " + image + "\n"
+}
+
+// withOwners returns the live object with the fields owned by other field managers.
+func withOwners(live *manifest.MappingResult, owners ...manifest.FieldOwner) *manifest.MappingResult {
+	live.FieldOwners = owners
+	return live
+}
+
+var (
+	hpaOwner     = manifest.FieldOwner{Manager: "kube-controller-manager", Operation: "Update", Path: []string{"spec", "replicas"}}
+	kubectlOwner = manifest.FieldOwner{Manager: "kubectl-annotate", Operation: "Update", Path: []string{"metadata", "annotations", "owner"}}
+	argoOwner    = manifest.FieldOwner{Manager: "argocd-controller", Operation: "Apply", Path: []string{"spec", "template", "spec", "containers", "0"}}
+)
+
+func TestFieldConflicts(t *testing.T) {
+	live := withOwners(parseObject(t, deploymentYAML("3", "app:1.0", "ops")), hpaOwner, kubectlOwner, argoOwner)
+
+	t.Run("client-side apply", func(t *testing.T) {
+		conflicts := fieldConflicts(newObjectChange(live, parseObject(t, deploymentYAML("1", "app:2.0", "dev"))))
+		require.Equal(t, []FieldConflict{
+			{Path: "metadata.annotations.owner", Managers: []FieldManager{{Name: "kubectl-annotate", Operation: "Update"}}},
+			{Path: "spec.replicas", Managers: []FieldManager{{Name: "kube-controller-manager", Operation: "Update"}}, RevertedBy: []string{"kube-controller-manager"}},
+			{Path: "spec.template.spec.containers[0].image", Managers: []FieldManager{{Name: "argocd-controller", Operation: "Apply"}}},
+		}, conflicts)
+		require.False(t, conflicts[0].Flagged())
+		require.True(t, conflicts[1].Flagged())
+		require.False(t, conflicts[2].Flagged())
+	})
+
+	t.Run("server-side apply conflicts", func(t *testing.T) {
+		conflicted := withOwners(parseObject(t, deploymentYAML("3", "app:1.0", "ops")), hpaOwner, kubectlOwner, argoOwner)
+		conflicted.ApplyConflicts = []manifest.FieldOwner{{Manager: "argocd-controller", Path: []string{"spec", "template", "spec", "containers", "0", "image"}}}
+		conflicts := fieldConflicts(newObjectChange(conflicted, parseObject(t, deploymentYAML("1", "app:2.0", "ops"))))
+		require.Equal(t, []FieldConflict{
+			{Path: "spec.replicas", Managers: []FieldManager{{Name: "kube-controller-manager", Operation: "Update"}}, RevertedBy: []string{"kube-controller-manager"}},
+			{Path: "spec.template.spec.containers[0].image", Managers: []FieldManager{{Name: "argocd-controller", Operation: "Apply"}}, FailsServerSideApply: true},
+		}, conflicts)
+		require.True(t, conflicts[1].Flagged())
+	})
+
+	t.Run("controllers managing a field twice", func(t *testing.T) {
+		apply := manifest.FieldOwner{Manager: "kube-controller-manager", Operation: "Apply", Path: []string{"spec", "replicas"}}
+		conflicts := fieldConflicts(newObjectChange(withOwners(parseObject(t, deploymentYAML("3", "app:1.0", "ops")), hpaOwner, apply), parseObject(t, deploymentYAML("1", "app:1.0", "ops"))))
+		require.Equal(t, []string{"kube-controller-manager"}, conflicts[0].RevertedBy)
+	})
+
+	t.Run("ordinary API clients", func(t *testing.T) {
+		client := manifest.FieldOwner{Manager: "deploy-bot", Operation: "Update", Path: []string{"spec", "replicas"}}
+		conflicts := fieldConflicts(newObjectChange(withOwners(parseObject(t, deploymentYAML("3", "app:1.0", "ops")), client), parseObject(t, deploymentYAML("1", "app:1.0", "ops"))))
+		require.Equal(t, []FieldConflict{
+			{Path: "spec.replicas", Managers: []FieldManager{{Name: "deploy-bot", Operation: "Update"}}},
+		}, conflicts)
+		require.False(t, conflicts[0].Flagged())
+	})
+
+	t.Run("unowned changes", func(t *testing.T) {
+		require.Empty(t, fieldConflicts(newObjectChange(withOwners(parseObject(t, deploymentYAML("3", "app:1.0", "ops")), hpaOwner), parseObject(t, deploymentYAML("3", "app:2.0", "ops")))))
+		require.Empty(t, fieldConflicts(newObjectChange(parseObject(t, deploymentYAML("3", "app:1.0", "ops")), parseObject(t, deploymentYAML("1", "app:1.0", "ops")))))
+		require.Empty(t, fieldConflicts(newObjectChange(nil, parseObject(t, deploymentYAML("1", "app:1.0", "ops")))))
+	})
+}
+
+func TestFieldConflictString(t *testing.T) {
+	c := FieldConflict{
+		Path:                 "spec.replicas",
+		Managers:             []FieldManager{{Name: "kube-controller-manager", Operation: "Update"}, {Name: "ops", Operation: "Apply"}},
+		FailsServerSideApply: true,
+		RevertedBy:           []string{"kube-controller-manager"},
+	}
+	require.Equal(t, "spec.replicas is owned by kube-controller-manager (Update), ops (Apply), conflicts with the server-side apply, may be reverted by kube-controller-manager", c.String())
+}
@@ -0,0 +1,131 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formatter writes a report in an output format. Formatters should stop when ctx is done.
+//
+// Formatters of formats registered with RegisterFormat get reports with both the line diffs and the
+// structured entries, like the reports of Compare.
+type Formatter interface {
+	Format(ctx context.Context, r *Report, w io.Writer) error
+}
+
+// FormatterFunc adapts a function to a Formatter.
+type FormatterFunc func(ctx context.Context, r *Report, w io.Writer) error
+
+// Format calls f(ctx, r, w).
+func (f FormatterFunc) Format(ctx context.Context, r *Report, w io.Writer) error {
+	return f(ctx, r, w)
+}
+
+// externalFormatPrefix is the prefix of the executables on PATH providing output formats,
+// e.g. helm-diff-format-ticket for --output ticket.
+const externalFormatPrefix = "helm-diff-format-"
+
+// externalFormatWaitDelay is how long an external formatter is waited for once it exited or was killed,
+// so that processes it started cannot keep Format from returning.
+const externalFormatWaitDelay = time.Second
+
+// externalFormatName matches the format names that are looked up as executables,
+// which keeps names like "../bin/sh" from running arbitrary paths.
+var externalFormatName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]Formatter{
+		"diff":       builtinFormat(setupDiffReport),
+		"simple":     builtinFormat(setupSimpleReport),
+		"template":   builtinFormat(setupTemplateReport),
+		"json":       builtinFormat(setupJSONReport),
+		"structured": builtinFormat(setupStructuredReport),
+		"dyff":       builtinFormat(setupDyffReport),
+		"markdown":   builtinFormat(setupMarkdownReport),
+		"html":       builtinFormat(setupHTMLReport),
+	}
+)
+
+// RegisterFormat makes a formatter available as the output format name, e.g. for --output.
+// It panics when name is empty, formatter is nil or the format is already registered,
+// so that it is best called from init functions.
+func RegisterFormat(name string, formatter Formatter) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if name == "" {
+		panic("diff: RegisterFormat with an empty name")
+	}
+	if formatter == nil {
+		panic("diff: RegisterFormat formatter is nil for " + name)
+	}
+	if _, dup := formats[name]; dup {
+		panic("diff: RegisterFormat called twice for " + name)
+	}
+	formats[name] = formatter
+}
+
+// lookupFormat returns the formatter of the registered format, else the one of the helm-diff-format-<name>
+// executable on PATH, else the one of the diff format.
+func lookupFormat(name string) Formatter {
+	formatsMu.RLock()
+	formatter, ok := formats[name]
+	fallback := formats["diff"]
+	formatsMu.RUnlock()
+	if ok {
+		return formatter
+	}
+	if externalFormatName.MatchString(name) {
+		if path, err := exec.LookPath(externalFormatPrefix + name); err == nil {
+			return externalFormat(path)
+		}
+	}
+	return fallback
+}
+
+// builtinFormat sets up a copy of the report for one of the output formats of this package.
+type builtinFormat func(r *Report) error
+
+func (setup builtinFormat) Format(_ context.Context, r *Report, w io.Writer) error {
+	report := *r
+	if err := setup(&report); err != nil {
+		return err
+	}
+	return report.format.output(&report, w)
+}
+
+// externalFormat is the path of an executable that reads the report as printed by the structured
+// output format from stdin and writes it in its own format to stdout. It is killed when ctx is done.
+// What it writes to stderr is the message of the error when it fails.
+type externalFormat string
+
+func (path externalFormat) Format(ctx context.Context, r *Report, w io.Writer) error {
+	var plan bytes.Buffer
+	if err := printStructuredReport(r, &plan); err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, string(path))
+	cmd.WaitDelay = externalFormatWaitDelay
+	cmd.Stdin = &plan
+	cmd.Stdout = w
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("formatter %s failed: %w: %s", path, err, msg)
+		}
+		return fmt.Errorf("formatter %s failed: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterFormat(t *testing.T) {
+	RegisterFormat("test-keys", FormatterFunc(func(_ context.Context, r *Report, w io.Writer) error {
+		for _, entry := range r.Entries {
+			_, _ = fmt.Fprintf(w, "%s %s diffs=%t structured=%t\n", entry.ChangeType, entry.Key, len(entry.Diffs) > 0, entry.Structured != nil)
+		}
+		return nil
+	}))
+	t.Cleanup(func() {
+		formatsMu.Lock()
+		delete(formats, "test-keys")
+		formatsMu.Unlock()
+	})
+
+	oldIndex := indexOf(parseObject(t, deploymentYAML("3", "app:1.0", "ops")))
+	newIndex := indexOf(parseObject(t, deploymentYAML("3", "app:2.0", "ops")))
+
+	var buf bytes.Buffer
+	changes, err := Print(context.Background(), oldIndex, newIndex, nil, &Options{OutputFormat: "test-keys", OutputContext: -1}, &buf)
+	require.NoError(t, err)
+	require.True(t, changes)
+	require.Equal(t, "MODIFY default, app, Deployment (apps) diffs=true structured=true\n", buf.String())
+
+	require.Panics(t, func() { RegisterFormat("test-keys", FormatterFunc(nil)) })
+	require.Panics(t, func() { RegisterFormat("diff", FormatterFunc(nil)) })
+	require.Panics(t, func() { RegisterFormat("", FormatterFunc(nil)) })
+	require.Panics(t, func() { RegisterFormat("test-nil", nil) })
+}
+
+func TestExternalFormat(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("formatter test script needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho ticket\ncat\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "helm-diff-format-ticket"), []byte(script), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "helm-diff-format-broken"), []byte("#!/bin/sh\necho invalid report >&2\nexit 1\n"), 0o755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	oldIndex := indexOf(parseObject(t, deploymentYAML("3", "app:1.0", "ops")))
+	newIndex := indexOf(parseObject(t, deploymentYAML("3", "app:2.0", "ops")))
+	report, err := Compare(context.Background(), oldIndex, newIndex, &Options{OutputContext: -1})
+	require.NoError(t, err)
+
+	var structured bytes.Buffer
+	require.NoError(t, report.Write(&structured, "structured"))
+	var buf bytes.Buffer
+	require.NoError(t, report.Write(&buf, "ticket"))
+	require.Equal(t, "ticket\n"+structured.String(), buf.String())
+
+	require.ErrorContains(t, report.Write(&buf, "broken"), "helm-diff-format-broken failed: exit status 1: invalid report")
+
+	t.Run("canceled", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "helm-diff-format-hang"), []byte("#!/bin/sh\nexec sleep 60\n"), 0o755))
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		require.ErrorIs(t, report.WriteContext(ctx, &buf, "hang"), context.DeadlineExceeded)
+		require.Less(t, time.Since(start), 10*time.Second)
+	})
+
+	t.Run("unknown formats are written as diff", func(t *testing.T) {
+		var unknown, diff bytes.Buffer
+		require.NoError(t, report.Write(&unknown, "missing"))
+		require.NoError(t, report.Write(&diff, "diff"))
+		require.Equal(t, diff.String(), unknown.String())
+	})
+
+	t.Run("names are not paths", func(t *testing.T) {
+		require.IsType(t, builtinFormat(nil), lookupFormat("../"+filepath.Base(dir)+"/helm-diff-format-ticket"))
+	})
+}
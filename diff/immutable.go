@@ -0,0 +1,103 @@
+package diff
+
+import (
+	"sort"
+	"strings"
+)
+
+type groupKind struct {
+	group string
+	kind  string
+}
+
+// immutableFields are the fields the API server rejects updates of, by group and kind.
+// Changing them makes helm upgrade fail unless the object is deleted and recreated.
+var immutableFields = map[groupKind][]string{
+	{"apps", "Deployment"}:  {"spec.selector"},
+	{"apps", "ReplicaSet"}:  {"spec.selector"},
+	{"apps", "DaemonSet"}:   {"spec.selector"},
+	{"apps", "StatefulSet"}: {"spec.selector", "spec.serviceName", "spec.podManagementPolicy", "spec.volumeClaimTemplates"},
+	{"batch", "Job"}:        {"spec.selector", "spec.template", "spec.completionMode"},
+	{"", "Service"}:         {"spec.clusterIP", "spec.clusterIPs"},
+	{"", "PersistentVolumeClaim"}: {
+		"spec.storageClassName", "spec.accessModes", "spec.volumeName", "spec.volumeMode", "spec.selector",
+		"spec.dataSource", "spec.dataSourceRef",
+	},
+	{"storage.k8s.io", "StorageClass"}:                  {"provisioner", "parameters", "reclaimPolicy", "volumeBindingMode"},
+	{"rbac.authorization.k8s.io", "RoleBinding"}:        {"roleRef"},
+	{"rbac.authorization.k8s.io", "ClusterRoleBinding"}: {"roleRef"},
+}
+
+// immutableDataFields are the fields of Secrets and ConfigMaps that cannot change once they are marked immutable.
+var immutableDataFields = []string{"data", "binaryData", "stringData"}
+
+// immutableKinds are the kinds that can have immutable fields, checked before their manifests are parsed.
+var immutableKinds = func() map[string]bool {
+	kinds := map[string]bool{"Secret": true, "ConfigMap": true}
+	for gk := range immutableFields {
+		kinds[gk.kind] = true
+	}
+	return kinds
+}()
+
+// immutableFieldChanges returns the immutable fields the change of a resource touches, sorted.
+func immutableFieldChanges(change *objectChange) []string {
+	if change.oldContent == nil || change.newContent == nil || !immutableKinds[change.kind()] {
+		return nil
+	}
+	oldObj, newObj := change.objects()
+	if oldObj == nil {
+		return nil
+	}
+
+	// objects paired by rename detection are replaced rather than updated
+	if objectName(oldObj) != objectName(newObj) {
+		return nil
+	}
+
+	gk := objectGroupKind(newObj)
+	fields := immutableFields[gk]
+	if immutable, _ := oldObj["immutable"].(bool); immutable && gk.group == "" && (gk.kind == "Secret" || gk.kind == "ConfigMap") {
+		fields = append(append([]string{}, fields...), immutableDataFields...)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	changes, err := change.fieldChanges()
+	if err != nil {
+		return nil
+	}
+	var changed []string
+	for _, field := range fields {
+		for _, change := range changes {
+			if overlaps(field, changePath(change)) {
+				changed = append(changed, field)
+				break
+			}
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func objectGroupKind(obj map[string]interface{}) groupKind {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	group, _, found := strings.Cut(apiVersion, "/")
+	if !found {
+		group = ""
+	}
+	return groupKind{group, kind}
+}
+
+func objectName(obj map[string]interface{}) string {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+	return name
+}
+
+// immutableWarning returns the warning of a change of an immutable field.
+func immutableWarning(field string) string {
+	return field + " is immutable, the upgrade fails unless the object is recreated"
+}
@@ -0,0 +1,73 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImmutableFieldChanges(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		old, new string
+		expected []string
+	}{
+		{
+			name:     "deployment selector",
+			old:      "apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 1\n  selector:\n    matchLabels:\n      app: a\n",
+			new:      "apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 2\n  selector:\n    matchLabels:\n      app: b\n",
+			expected: []string{"spec.selector"},
+		},
+		{
+			name: "deployment replicas",
+			old:  "apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 1\n",
+			new:  "apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 2\n",
+		},
+		{
+			name:     "statefulset volume claim templates and service name",
+			old:      "apiVersion: apps/v1\nkind: StatefulSet\nspec:\n  serviceName: a\n  volumeClaimTemplates:\n  - spec:\n      resources:\n        requests:\n          storage: 1Gi\n",
+			new:      "apiVersion: apps/v1\nkind: StatefulSet\nspec:\n  serviceName: b\n  volumeClaimTemplates:\n  - spec:\n      resources:\n        requests:\n          storage: 2Gi\n",
+			expected: []string{"spec.serviceName", "spec.volumeClaimTemplates"},
+		},
+		{
+			name:     "job template",
+			old:      "apiVersion: batch/v1\nkind: Job\nspec:\n  template:\n    spec:\n      containers:\n      - image: a\n",
+			new:      "apiVersion: batch/v1\nkind: Job\nspec:\n  template:\n    spec:\n      containers:\n      - image: b\n",
+			expected: []string{"spec.template"},
+		},
+		{
+			name:     "service cluster IP",
+			old:      "apiVersion: v1\nkind: Service\nspec:\n  clusterIP: 10.0.0.1\n",
+			new:      "apiVersion: v1\nkind: Service\nspec:\n  clusterIP: 10.0.0.2\n",
+			expected: []string{"spec.clusterIP"},
+		},
+		{
+			name:     "pvc storage class",
+			old:      "apiVersion: v1\nkind: PersistentVolumeClaim\nspec:\n  storageClassName: standard\n",
+			new:      "apiVersion: v1\nkind: PersistentVolumeClaim\nspec:\n  storageClassName: fast\n",
+			expected: []string{"spec.storageClassName"},
+		},
+		{
+			name:     "immutable configmap",
+			old:      "apiVersion: v1\nkind: ConfigMap\nimmutable: true\ndata:\n  key: a\n",
+			new:      "apiVersion: v1\nkind: ConfigMap\nimmutable: true\ndata:\n  key: b\n",
+			expected: []string{"data"},
+		},
+		{
+			name: "mutable configmap",
+			old:  "apiVersion: v1\nkind: ConfigMap\ndata:\n  key: a\n",
+			new:  "apiVersion: v1\nkind: ConfigMap\ndata:\n  key: b\n",
+		},
+		{
+			name: "same kind of another group",
+			old:  "apiVersion: example.com/v1\nkind: Deployment\nspec:\n  selector: a\n",
+			new:  "apiVersion: example.com/v1\nkind: Deployment\nspec:\n  selector: b\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, immutableFieldChanges(newObjectChange(parseObject(t, tc.old), parseObject(t, tc.new))))
+		})
+	}
+
+	require.Nil(t, immutableFieldChanges(newObjectChange(nil, parseObject(t, "apiVersion: v1\nkind: Service\n"))))
+}
@@ -0,0 +1,488 @@
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mgutz/ansi"
+	"golang.org/x/term"
+)
+
+// defaultInteractiveContext is the number of context lines shown around changes
+// while the diff is folded and no --context was given.
+const defaultInteractiveContext = 3
+
+const browserHelp = "j/k select  PgUp/PgDn scroll  f fold  s suppress kind  / search  n/N next/prev match  q quit"
+
+// changeOrder is the order in which the groups of change types are listed.
+var changeOrder = map[string]int{
+	"ADD":               0,
+	"MODIFY":            1,
+	"MODIFY_SUPPRESSED": 2,
+	"REMOVE":            3,
+	"OWNERSHIP":         4,
+	"ERROR":             5,
+	"UNCHANGED":         6,
+}
+
+var changeLabels = map[string]ChangeStyle{
+	"ADD":               {color: "green", message: "added"},
+	"MODIFY":            {color: "yellow", message: "changed"},
+	"MODIFY_SUPPRESSED": {color: "blue+h", message: "changed, empty after suppression"},
+	"REMOVE":            {color: "red", message: "removed"},
+	"OWNERSHIP":         {color: "magenta", message: "changed ownership"},
+	"ERROR":             {color: "red", message: "could not be diffed"},
+	"UNCHANGED":         {color: "yellow", message: "unchanged"},
+}
+
+// browser holds the state of the interactive report browser.
+// It is kept apart from the terminal handling so that it can be driven by tests.
+type browser struct {
+	rows       []browserRow
+	selected   int
+	listScroll int
+	diffScroll int
+	unfolded   bool
+	suppressed map[string]bool
+	query      string
+	input      string
+	searching  bool
+	message    string
+	width      int
+	height     int
+}
+
+// browserRow is a line of the entry list, either a group header or an entry.
+type browserRow struct {
+	header string
+	name   string
+	entry  *ReportEntry
+}
+
+// interactiveTerminal returns the terminal to browse the report in, if both
+// stdin and the output are terminals.
+func interactiveTerminal(to io.Writer) (*os.File, bool) {
+	out, ok := to.(*os.File)
+	if !ok || os.Getenv("TERM") == "dumb" {
+		return nil, false
+	}
+	return out, term.IsTerminal(int(out.Fd())) && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+func newBrowser(r *Report) *browser {
+	b := &browser{suppressed: map[string]bool{}, width: 80, height: 24}
+
+	entries := make([]*ReportEntry, len(r.Entries))
+	specs := make(map[*ReportEntry]ReportTemplateSpec, len(r.Entries))
+	for i := range r.Entries {
+		entry := &r.Entries[i]
+		entries[i] = entry
+		spec := ReportTemplateSpec{}
+		if err := spec.loadFromKey(entry.Key); err != nil {
+			spec = ReportTemplateSpec{Name: entry.Key, Kind: entry.Kind}
+		}
+		specs[entry] = spec
+		for _, kind := range entry.SuppressedKinds {
+			b.suppressed[kind] = true
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if changeOrder[a.ChangeType] != changeOrder[b.ChangeType] {
+			return changeOrder[a.ChangeType] < changeOrder[b.ChangeType]
+		}
+		if specs[a].Kind != specs[b].Kind {
+			return specs[a].Kind < specs[b].Kind
+		}
+		if specs[a].Namespace != specs[b].Namespace {
+			return specs[a].Namespace < specs[b].Namespace
+		}
+		return a.Key < b.Key
+	})
+
+	var group string
+	for _, entry := range entries {
+		spec := specs[entry]
+		header := changeLabels[entry.ChangeType].message
+		if spec.Kind != "" {
+			header += " " + spec.Kind
+		}
+		if spec.Namespace != "" {
+			header += " in " + spec.Namespace
+		}
+		if header != group {
+			group = header
+			b.rows = append(b.rows, browserRow{header: ansi.Color(header, changeLabels[entry.ChangeType].color)})
+		}
+		b.rows = append(b.rows, browserRow{name: spec.Name, entry: entry})
+	}
+
+	b.selected = b.step(-1, 1)
+	return b
+}
+
+// browse shows the report in an interactive browser on the given terminal until the user quits.
+func (r *Report) browse(in, out *os.File) error {
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = term.Restore(int(in.Fd()), state)
+	}()
+
+	// switch to the alternate screen and hide the cursor while browsing
+	_, _ = io.WriteString(out, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		_, _ = io.WriteString(out, "\x1b[?25h\x1b[?1049l")
+	}()
+
+	b := newBrowser(r)
+	keys := bufio.NewReader(in)
+	for {
+		if width, height, err := term.GetSize(int(out.Fd())); err == nil {
+			b.width, b.height = width, height
+		}
+		if _, err := io.WriteString(out, "\x1b[H"+strings.Join(b.view(), "\r\n")); err != nil {
+			return err
+		}
+		key, err := readKey(keys)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b.handleKey(key) {
+			return nil
+		}
+	}
+}
+
+// readKey reads a single key press, translating escape sequences to key names.
+func readKey(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch c {
+	case 0x03:
+		return "ctrl-c", nil
+	case 0x04:
+		return "ctrl-d", nil
+	case 0x15:
+		return "ctrl-u", nil
+	case '\r', '\n':
+		return "enter", nil
+	case 0x7f, 0x08:
+		return "backspace", nil
+	case 0x1b:
+		if r.Buffered() == 0 {
+			return "esc", nil
+		}
+		var seq []byte
+		for {
+			c, err := r.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			seq = append(seq, c)
+			if len(seq) > 1 && c >= 0x40 && c <= 0x7e {
+				break
+			}
+		}
+		switch string(seq) {
+		case "[A", "OA":
+			return "up", nil
+		case "[B", "OB":
+			return "down", nil
+		case "[5~":
+			return "pgup", nil
+		case "[6~":
+			return "pgdown", nil
+		case "[H", "OH", "[1~", "[7~":
+			return "home", nil
+		case "[F", "OF", "[4~", "[8~":
+			return "end", nil
+		}
+		return "", nil
+	}
+	return string(c), nil
+}
+
+// handleKey updates the browser state for a key press and returns true when the browser should quit.
+func (b *browser) handleKey(key string) bool {
+	if b.searching {
+		switch key {
+		case "enter":
+			b.searching = false
+			b.query = b.input
+			b.findMatch(1, true)
+		case "esc", "ctrl-c":
+			b.searching = false
+		case "backspace":
+			if b.input != "" {
+				b.input = b.input[:len(b.input)-1]
+			}
+		default:
+			if len(key) == 1 && key[0] >= 0x20 {
+				b.input += key
+			}
+		}
+		return false
+	}
+
+	b.message = ""
+	page := b.paneHeight() / 2
+	switch key {
+	case "q", "ctrl-c":
+		return true
+	case "j", "down":
+		b.selectRow(b.step(b.selected, 1))
+	case "k", "up":
+		b.selectRow(b.step(b.selected, -1))
+	case "g", "home":
+		b.selectRow(b.step(-1, 1))
+	case "G", "end":
+		b.selectRow(b.step(len(b.rows), -1))
+	case "pgdown", "ctrl-d", " ":
+		b.scrollDiff(page)
+	case "pgup", "ctrl-u":
+		b.scrollDiff(-page)
+	case "f":
+		b.unfolded = !b.unfolded
+		b.diffScroll = 0
+	case "s":
+		if entry := b.entry(); entry != nil && entry.Kind != "" {
+			b.suppressed[entry.Kind] = !b.suppressed[entry.Kind]
+			b.diffScroll = 0
+		}
+	case "/":
+		b.searching = true
+		b.input = ""
+	case "n":
+		b.findMatch(1, false)
+	case "N":
+		b.findMatch(-1, false)
+	}
+	return false
+}
+
+// step returns the index of the next entry row from the given row in the given direction,
+// or the given row if there is none.
+func (b *browser) step(from, direction int) int {
+	for i := from + direction; i >= 0 && i < len(b.rows); i += direction {
+		if b.rows[i].entry != nil {
+			return i
+		}
+	}
+	return from
+}
+
+func (b *browser) selectRow(row int) {
+	if row >= 0 && row < len(b.rows) {
+		b.selected = row
+		b.diffScroll = 0
+	}
+}
+
+func (b *browser) entry() *ReportEntry {
+	if b.selected < 0 || b.selected >= len(b.rows) {
+		return nil
+	}
+	return b.rows[b.selected].entry
+}
+
+func (b *browser) scrollDiff(lines int) {
+	b.diffScroll += lines
+	if last := len(b.diffLines()) - b.paneHeight(); b.diffScroll > last {
+		b.diffScroll = last
+	}
+	if b.diffScroll < 0 {
+		b.diffScroll = 0
+	}
+}
+
+// findMatch selects the next entry in the given direction whose name or diff contains the query.
+// The current entry is considered as well when includeCurrent is set.
+func (b *browser) findMatch(direction int, includeCurrent bool) {
+	if b.query == "" {
+		return
+	}
+	start := b.selected
+	if !includeCurrent {
+		start += direction
+	}
+	for n := 0; n < len(b.rows); n++ {
+		i := ((start+n*direction)%len(b.rows) + len(b.rows)) % len(b.rows)
+		if b.rows[i].entry != nil && b.matches(b.rows[i].entry) {
+			b.selectRow(i)
+			for line, text := range b.diffLines() {
+				if strings.Contains(text, b.query) {
+					b.diffScroll = line
+					b.scrollDiff(0)
+					break
+				}
+			}
+			return
+		}
+	}
+	b.message = fmt.Sprintf("Pattern not found: %s", b.query)
+}
+
+func (b *browser) matches(entry *ReportEntry) bool {
+	if strings.Contains(entry.Key, b.query) {
+		return true
+	}
+	for _, record := range entry.Diffs {
+		if strings.Contains(record.Payload, b.query) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffLines renders the diff of the selected entry.
+func (b *browser) diffLines() []string {
+	entry := b.entry()
+	if entry == nil {
+		return nil
+	}
+
+	var suppressedKinds []string
+	if b.suppressed[entry.Kind] {
+		suppressedKinds = []string{entry.Kind}
+	}
+	context := -1
+	if !b.unfolded {
+		context = entry.Context
+		if context < 0 {
+			context = defaultInteractiveContext
+		}
+	}
+
+	var buf bytes.Buffer
+	_, _ = fmt.Fprintln(&buf, ansi.Color(entry.Key+" "+changeLabels[entry.ChangeType].message, changeLabels[entry.ChangeType].color))
+	printEntryNotes(*entry, &buf)
+	printDiffRecords(suppressedKinds, entry.Kind, context, entry.Diffs, &buf)
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func (b *browser) paneHeight() int {
+	if b.height < 3 {
+		return 1
+	}
+	return b.height - 2
+}
+
+// view renders the whole screen as exactly height lines of width columns.
+func (b *browser) view() []string {
+	height := b.paneHeight()
+	listWidth := b.width * 2 / 5
+	if listWidth < 20 {
+		listWidth = 20
+	}
+	diffWidth := b.width - listWidth - 3
+	if diffWidth < 1 {
+		diffWidth = 1
+	}
+
+	if b.selected < b.listScroll {
+		b.listScroll = b.selected
+	}
+	if b.selected >= b.listScroll+height {
+		b.listScroll = b.selected - height + 1
+	}
+	// keep the group header of the selected entry visible when it is at the top
+	if b.listScroll == b.selected && b.selected > 0 && b.rows[b.selected-1].entry == nil {
+		b.listScroll--
+	}
+
+	diffLines := b.diffLines()
+	fold := "folded"
+	if b.unfolded {
+		fold = "unfolded"
+	}
+
+	lines := make([]string, 0, b.height)
+	lines = append(lines, fitWidth(fmt.Sprintf("\x1b[7m helm diff: %d changes, %s \x1b[0m", b.entryCount(), fold), b.width))
+	for i := 0; i < height; i++ {
+		var left, right string
+		if row := b.listScroll + i; row < len(b.rows) {
+			switch {
+			case b.rows[row].entry == nil:
+				left = b.rows[row].header
+			case row == b.selected:
+				left = "\x1b[7m  " + b.rows[row].name + "\x1b[0m"
+			default:
+				left = "  " + b.rows[row].name
+			}
+		}
+		if line := b.diffScroll + i; line < len(diffLines) {
+			right = diffLines[line]
+		}
+		lines = append(lines, fitWidth(left, listWidth)+" | "+fitWidth(right, diffWidth))
+	}
+
+	status := browserHelp
+	switch {
+	case b.searching:
+		status = "/" + b.input
+	case b.message != "":
+		status = b.message
+	}
+	lines = append(lines, fitWidth(status, b.width))
+	return lines[:b.height]
+}
+
+func (b *browser) entryCount() int {
+	count := 0
+	for _, row := range b.rows {
+		if row.entry != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// fitWidth truncates or pads s to exactly width visible columns, leaving ANSI escape sequences intact.
+func fitWidth(s string, width int) string {
+	s = strings.ReplaceAll(s, "\t", "    ")
+
+	var out strings.Builder
+	visible := 0
+	escaped := false
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == 0x1b {
+			escaped = true
+			// copy the escape sequence up to its final byte, e.g. the m of \x1b[31m
+			j := i + 1
+			for j+1 < len(runes) {
+				j++
+				if runes[j] >= 0x40 && runes[j] <= 0x7e {
+					break
+				}
+			}
+			out.WriteString(string(runes[i : j+1]))
+			i = j
+			continue
+		}
+		if visible == width {
+			continue
+		}
+		out.WriteRune(runes[i])
+		visible++
+	}
+	if escaped {
+		out.WriteString("\x1b[0m")
+	}
+	out.WriteString(strings.Repeat(" ", width-visible))
+	return out.String()
+}
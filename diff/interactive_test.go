@@ -0,0 +1,211 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mgutz/ansi"
+	"github.com/stretchr/testify/require"
+)
+
+func browserYAML(namespace, name, kind, body string) string {
+	return fmt.Sprintf("apiVersion: v1\nkind: %s\nmetadata:\n  name: %s\n  namespace: %s\n%s", kind, name, namespace, body)
+}
+
+func newTestBrowser(t *testing.T) *browser {
+	t.Helper()
+	ansi.DisableColors(true)
+
+	var lines []string
+	for i := 0; i < 40; i++ {
+		lines = append(lines, fmt.Sprintf("  line%d: %d", i, i))
+	}
+	oldBody := "data:\n" + strings.Join(lines, "\n") + "\n"
+	lines[20] = "  line20: changed"
+	newBody := "data:\n" + strings.Join(lines, "\n") + "\n"
+
+	oldIndex := parseManifest(t,
+		browserYAML("default", "config", "ConfigMap", oldBody),
+		browserYAML("default", "removed", "ConfigMap", ""),
+		browserYAML("default", "token", "Secret", "stringData:\n  key: old\n"),
+	)
+	newIndex := parseManifest(t,
+		browserYAML("default", "config", "ConfigMap", newBody),
+		browserYAML("other", "added", "ConfigMap", ""),
+		browserYAML("default", "token", "Secret", "stringData:\n  key: new\n"),
+	)
+
+	options := &Options{OutputFormat: "diff", OutputContext: -1, ShowSecrets: true, SuppressedKinds: []string{"Secret"}}
+	report, err := generateReport(context.Background(), oldIndex, newIndex, nil, options)
+	require.NoError(t, err)
+	return newBrowser(report)
+}
+
+func TestBrowserGroupsEntries(t *testing.T) {
+	b := newTestBrowser(t)
+
+	var rows []string
+	for _, row := range b.rows {
+		if row.entry == nil {
+			rows = append(rows, row.header)
+		} else {
+			rows = append(rows, "  "+row.name)
+		}
+	}
+	require.Equal(t, []string{
+		"added ConfigMap in other",
+		"  added",
+		"changed ConfigMap in default",
+		"  config",
+		"changed Secret in default",
+		"  token",
+		"removed ConfigMap in default",
+		"  removed",
+	}, rows)
+	require.Equal(t, 1, b.selected)
+	require.True(t, b.suppressed["Secret"])
+}
+
+func TestBrowserNavigation(t *testing.T) {
+	b := newTestBrowser(t)
+
+	require.False(t, b.handleKey("j"))
+	require.Equal(t, 3, b.selected)
+	b.handleKey("down")
+	require.Equal(t, 5, b.selected)
+	b.handleKey("k")
+	require.Equal(t, 3, b.selected)
+	b.handleKey("G")
+	require.Equal(t, 7, b.selected)
+	b.handleKey("j")
+	require.Equal(t, 7, b.selected)
+	b.handleKey("home")
+	require.Equal(t, 1, b.selected)
+	b.handleKey("up")
+	require.Equal(t, 1, b.selected)
+
+	require.True(t, b.handleKey("q"))
+	require.True(t, b.handleKey("ctrl-c"))
+}
+
+func TestBrowserFoldAndScroll(t *testing.T) {
+	b := newTestBrowser(t)
+	b.height = 10
+	b.handleKey("j")
+
+	folded := b.diffLines()
+	b.handleKey("f")
+	unfolded := b.diffLines()
+	require.Less(t, len(folded), len(unfolded))
+	require.Contains(t, strings.Join(unfolded, "\n"), "line0: 0")
+	require.NotContains(t, strings.Join(folded, "\n"), "line0: 0")
+
+	b.handleKey("pgdown")
+	require.Equal(t, 4, b.diffScroll)
+	b.handleKey("end")
+	require.Equal(t, 0, b.diffScroll)
+
+	b.handleKey("g")
+	b.handleKey("j")
+	for i := 0; i < 100; i++ {
+		b.handleKey("pgdown")
+	}
+	require.Equal(t, len(b.diffLines())-b.paneHeight(), b.diffScroll)
+	b.handleKey("pgup")
+	require.Equal(t, len(b.diffLines())-b.paneHeight()-4, b.diffScroll)
+}
+
+func TestBrowserToggleSuppression(t *testing.T) {
+	b := newTestBrowser(t)
+	b.handleKey("j")
+	b.handleKey("j")
+	require.Equal(t, "token", b.rows[b.selected].name)
+
+	require.Contains(t, strings.Join(b.diffLines(), "\n"), "Changes suppressed on sensitive content")
+	b.handleKey("s")
+	require.False(t, b.suppressed["Secret"])
+	require.Contains(t, strings.Join(b.diffLines(), "\n"), "key: new")
+	b.handleKey("s")
+	require.Contains(t, strings.Join(b.diffLines(), "\n"), "Changes suppressed on sensitive content")
+}
+
+func TestBrowserSearch(t *testing.T) {
+	b := newTestBrowser(t)
+
+	for _, key := range []string{"/", "r", "e", "x", "backspace", "m", "o", "v", "e", "enter"} {
+		b.handleKey(key)
+	}
+	require.False(t, b.searching)
+	require.Equal(t, "remove", b.query)
+	require.Equal(t, "removed", b.rows[b.selected].name)
+
+	for _, key := range []string{"/", "C", "o", "n", "f", "i", "g", "M", "a", "p", "enter"} {
+		b.handleKey(key)
+	}
+	require.Equal(t, "removed", b.rows[b.selected].name)
+	b.handleKey("n")
+	require.Equal(t, "added", b.rows[b.selected].name)
+	b.handleKey("n")
+	require.Equal(t, "config", b.rows[b.selected].name)
+	b.handleKey("N")
+	require.Equal(t, "added", b.rows[b.selected].name)
+	b.handleKey("N")
+	require.Equal(t, "removed", b.rows[b.selected].name)
+
+	for _, key := range []string{"/", "n", "o", "p", "e", "enter"} {
+		b.handleKey(key)
+	}
+	require.Equal(t, "removed", b.rows[b.selected].name)
+	require.Equal(t, "Pattern not found: nope", b.view()[b.height-1][:len("Pattern not found: nope")])
+
+	b.handleKey("/")
+	b.handleKey("x")
+	b.handleKey("esc")
+	require.False(t, b.searching)
+	require.Equal(t, "nope", b.query)
+}
+
+func TestBrowserView(t *testing.T) {
+	b := newTestBrowser(t)
+	b.width, b.height = 60, 6
+
+	lines := b.view()
+	require.Len(t, lines, 6)
+	require.Contains(t, lines[0], "helm diff: 4 changes, folded")
+	for _, line := range lines[1:] {
+		require.Equal(t, 60, len([]rune(stripANSI(line))))
+	}
+
+	b.handleKey("G")
+	lines = b.view()
+	require.Contains(t, lines[len(lines)-3], "removed ConfigMap")
+	require.Contains(t, lines[len(lines)-2], "removed")
+}
+
+func TestFitWidth(t *testing.T) {
+	require.Equal(t, "abc  ", fitWidth("abc", 5))
+	require.Equal(t, "abcde", fitWidth("abcdefgh", 5))
+	require.Equal(t, "\x1b[31mab\x1b[0m\x1b[0m", fitWidth("\x1b[31mabcd\x1b[0m", 2))
+	require.Equal(t, "a    b   ", fitWidth("a\tb", 9))
+	require.Equal(t, "äöü ", fitWidth("äöü", 4))
+}
+
+func stripANSI(s string) string {
+	var out strings.Builder
+	escaped := false
+	for _, r := range s {
+		switch {
+		case r == 0x1b:
+			escaped = true
+		case escaped:
+			if r >= 0x40 && r <= 0x7e && r != '[' {
+				escaped = false
+			}
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,123 @@
+package diff
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"slices"
+
+	"github.com/aryann/difflib"
+)
+
+// setup report for markdown output, e.g. for comments on pull requests
+func setupMarkdownReport(r *Report) error {
+	r.format.output = printMarkdownReport
+	r.format.changestyles = markupChangeStyles()
+	return nil
+}
+
+// setup report for html output
+func setupHTMLReport(r *Report) error {
+	r.format.output = printHTMLReport
+	r.format.changestyles = markupChangeStyles()
+	return nil
+}
+
+// markupChangeStyles are the change styles of the markdown and html outputs, whose headers end without a colon.
+func markupChangeStyles() map[string]ChangeStyle {
+	return map[string]ChangeStyle{
+		"ADD":               {color: "green", message: "has been added"},
+		"REMOVE":            {color: "red", message: "has been removed"},
+		"MODIFY":            {color: "yellow", message: "has changed"},
+		"OWNERSHIP":         {color: "magenta", message: "changed ownership"},
+		"MODIFY_SUPPRESSED": {color: "blue", message: "has changed, but diff is empty after suppression"},
+		"ERROR":             {color: "red", message: "could not be diffed"},
+		"UNCHANGED":         {color: "yellow", message: "is unchanged"},
+	}
+}
+
+// print report for markdown output
+func printMarkdownReport(r *Report, to io.Writer) error {
+	for _, line := range r.summary() {
+		_, _ = fmt.Fprintf(to, "%s\n\n", line)
+	}
+	for _, entry := range r.Entries {
+		_, _ = fmt.Fprintf(to, "### `%s` %s\n\n", entry.Key, r.format.changestyles[entry.ChangeType].message)
+		if notes := entryNotes(entry); len(notes) > 0 {
+			for _, note := range notes {
+				_, _ = fmt.Fprintf(to, "- %s\n", note.text)
+			}
+			_, _ = fmt.Fprintln(to)
+		}
+		if slices.Contains(entry.SuppressedKinds, entry.Kind) {
+			_, _ = fmt.Fprintf(to, "Changes suppressed on sensitive content of type %s\n\n", entry.Kind)
+			continue
+		}
+		if len(entry.Diffs) == 0 {
+			continue
+		}
+		_, _ = fmt.Fprintln(to, "```diff")
+		for _, record := range contextRecords(entry.Diffs, entry.Context) {
+			_, _ = fmt.Fprintln(to, markupLine(record))
+		}
+		_, _ = fmt.Fprint(to, "```\n\n")
+	}
+	return nil
+}
+
+// print report for html output
+func printHTMLReport(r *Report, to io.Writer) error {
+	_, _ = fmt.Fprintln(to, `<div class="helm-diff">`)
+	for _, line := range r.summary() {
+		_, _ = fmt.Fprintf(to, "<p>%s</p>\n", html.EscapeString(line))
+	}
+	for _, entry := range r.Entries {
+		style := r.format.changestyles[entry.ChangeType]
+		_, _ = fmt.Fprintf(to, "<h3><code>%s</code> <span style=\"color: %s\">%s</span></h3>\n", html.EscapeString(entry.Key), style.color, style.message)
+		if notes := entryNotes(entry); len(notes) > 0 {
+			_, _ = fmt.Fprintln(to, "<ul>")
+			for _, note := range notes {
+				_, _ = fmt.Fprintf(to, "<li style=\"color: %s\">%s</li>\n", note.color, html.EscapeString(note.text))
+			}
+			_, _ = fmt.Fprintln(to, "</ul>")
+		}
+		if slices.Contains(entry.SuppressedKinds, entry.Kind) {
+			_, _ = fmt.Fprintf(to, "<p>Changes suppressed on sensitive content of type %s</p>\n", html.EscapeString(entry.Kind))
+			continue
+		}
+		if len(entry.Diffs) == 0 {
+			continue
+		}
+		_, _ = fmt.Fprint(to, "<pre><code>")
+		for _, record := range contextRecords(entry.Diffs, entry.Context) {
+			line := html.EscapeString(markupLine(record))
+			switch {
+			case record == nil:
+			case record.Delta == difflib.RightOnly:
+				line = `<span style="color: green">` + line + "</span>"
+			case record.Delta == difflib.LeftOnly:
+				line = `<span style="color: red">` + line + "</span>"
+			}
+			_, _ = fmt.Fprintln(to, line)
+		}
+		_, _ = fmt.Fprintln(to, "</code></pre>")
+	}
+	_, _ = fmt.Fprintln(to, "</div>")
+	return nil
+}
+
+// markupLine returns the line of a record of contextRecords in unified diff notation.
+func markupLine(record *difflib.DiffRecord) string {
+	switch {
+	case record == nil:
+		return "..."
+	case record.Delta == difflib.RightOnly:
+		return "+ " + record.Payload
+	case record.Delta == difflib.LeftOnly:
+		return "- " + record.Payload
+	case record.Payload == "":
+		return ""
+	default:
+		return "  " + record.Payload
+	}
+}
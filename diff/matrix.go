@@ -0,0 +1,128 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+// ReleaseMatrix summarizes which resources differ between a baseline release
+// and any number of other releases.
+type ReleaseMatrix struct {
+	Baseline  string             `json:"baseline"`
+	Releases  []string           `json:"releases"`
+	Resources []ReleaseMatrixRow `json:"resources"`
+}
+
+// ReleaseMatrixRow holds the change type of a single resource per compared release.
+// Releases in which the resource is identical to the baseline are omitted from Changes.
+type ReleaseMatrixRow struct {
+	Key     string            `json:"key"`
+	Changes map[string]string `json:"changes"`
+}
+
+var matrixSymbols = map[string]string{
+	"ADD":               "+",
+	"REMOVE":            "-",
+	"MODIFY":            "~",
+	"MODIFY_SUPPRESSED": "~",
+	"ERROR":             "!",
+}
+
+// ReleasesMatrix compares every index in others against the baseline index.
+// Like Releases, resources are keyed by their source template so that objects
+// rendered from the same template line up across releases.
+func ReleasesMatrix(baselineName string, baseline map[string]*manifest.MappingResult, names []string, others []map[string]*manifest.MappingResult, options *Options) (*ReleaseMatrix, error) {
+	if len(names) != len(others) {
+		return nil, fmt.Errorf("got %d release names for %d releases", len(names), len(others))
+	}
+
+	// The matrix only needs the change types, never the rendered diffs or field changes.
+	matrixOptions := *options
+	matrixOptions.OutputFormat = "simple"
+	matrixOptions.KubeVersion = ""
+
+	rows := make(map[string]map[string]string)
+	for i, other := range others {
+		report, err := generateReport(context.Background(), reIndexForRelease(copyIndex(baseline), options), reIndexForRelease(copyIndex(other), options), nil, &matrixOptions)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range report.Entries {
+			if rows[entry.Key] == nil {
+				rows[entry.Key] = make(map[string]string)
+			}
+			rows[entry.Key][names[i]] = entry.ChangeType
+		}
+	}
+
+	matrix := &ReleaseMatrix{
+		Baseline:  baselineName,
+		Releases:  names,
+		Resources: make([]ReleaseMatrixRow, 0, len(rows)),
+	}
+	keys := make([]string, 0, len(rows))
+	for key := range rows {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		matrix.Resources = append(matrix.Resources, ReleaseMatrixRow{Key: key, Changes: rows[key]})
+	}
+
+	return matrix, nil
+}
+
+// HasChanges returns true when at least one release differs from the baseline.
+func (m *ReleaseMatrix) HasChanges() bool {
+	return len(m.Resources) > 0
+}
+
+// Print writes the matrix as a table, or as JSON when the structured output is requested.
+func (m *ReleaseMatrix) Print(options *Options, to io.Writer) error {
+	if options.StructuredOutput() {
+		encoder := json.NewEncoder(to)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(m)
+	}
+
+	w := tabwriter.NewWriter(to, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "RESOURCE\t%s (baseline)", m.Baseline)
+	for _, name := range m.Releases {
+		_, _ = fmt.Fprintf(w, "\t%s", name)
+	}
+	_, _ = fmt.Fprintln(w)
+	for _, row := range m.Resources {
+		_, _ = fmt.Fprintf(w, "%s\t", row.Key)
+		for _, name := range m.Releases {
+			symbol := "="
+			if change, ok := row.Changes[name]; ok {
+				symbol = matrixSymbols[change]
+			}
+			_, _ = fmt.Fprintf(w, "\t%s", symbol)
+		}
+		_, _ = fmt.Fprintln(w)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(to, "Legend: = identical, ~ changed, + only in release, - only in baseline")
+	return err
+}
+
+// copyIndex returns a shallow copy of every MappingResult in index.
+// generateReport redacts or decodes secrets in place, so an index that is
+// compared more than once must not be shared between comparisons.
+func copyIndex(index map[string]*manifest.MappingResult) map[string]*manifest.MappingResult {
+	copied := make(map[string]*manifest.MappingResult, len(index))
+	for key, result := range index {
+		c := *result
+		copied[key] = &c
+	}
+	return copied
+}
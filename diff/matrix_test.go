@@ -0,0 +1,150 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+func matrixIndex(namespace string, contents ...string) map[string]*manifest.MappingResult {
+	index := make(map[string]*manifest.MappingResult)
+	for _, content := range contents {
+		result := manifest.Parse([]byte(content), namespace, false)
+		for key, value := range result {
+			index[key] = value
+		}
+	}
+	return index
+}
+
+func TestReleasesMatrix(t *testing.T) {
+	configMap := func(namespace, value string) string {
+		return `# Source: app/templates/cm.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+  namespace: ` + namespace + `
+data:
+  key: ` + value + `
+`
+	}
+	service := func(namespace string) string {
+		return `# Source: app/templates/svc.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  namespace: ` + namespace + `
+`
+	}
+
+	prod := matrixIndex("prod", configMap("prod", "a"), service("prod"))
+	stage := matrixIndex("stage", configMap("stage", "b"), service("stage"))
+	dev := matrixIndex("dev", configMap("dev", "a"))
+
+	options := &Options{OutputFormat: "diff", OutputContext: -1}
+	matrix, err := ReleasesMatrix("prod/app", prod, []string{"stage/app", "dev/app"}, []map[string]*manifest.MappingResult{stage, dev}, options)
+	require.NoError(t, err)
+	require.True(t, matrix.HasChanges())
+
+	// The namespaces differ between releases, so every resource line changes.
+	require.Equal(t, []ReleaseMatrixRow{
+		{Key: "app/templates/cm.yaml", Changes: map[string]string{"stage/app": "MODIFY", "dev/app": "MODIFY"}},
+		{Key: "app/templates/svc.yaml", Changes: map[string]string{"stage/app": "MODIFY", "dev/app": "REMOVE"}},
+	}, matrix.Resources)
+
+	t.Run("identical releases", func(t *testing.T) {
+		matrix, err := ReleasesMatrix("prod/app", prod, []string{"prod/app-copy"}, []map[string]*manifest.MappingResult{matrixIndex("prod", configMap("prod", "a"), service("prod"))}, options)
+		require.NoError(t, err)
+		require.False(t, matrix.HasChanges())
+	})
+
+	t.Run("table output", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, matrix.Print(options, &buf))
+		require.Equal(t, ""+
+			"RESOURCE                prod/app (baseline)  stage/app  dev/app\n"+
+			"app/templates/cm.yaml                        ~          ~\n"+
+			"app/templates/svc.yaml                       ~          -\n"+
+			"Legend: = identical, ~ changed, + only in release, - only in baseline\n", buf.String())
+	})
+
+	t.Run("structured output", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, matrix.Print(&Options{OutputFormat: "structured"}, &buf))
+		var decoded ReleaseMatrix
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		require.Equal(t, *matrix, decoded)
+	})
+
+	t.Run("secrets are not redacted twice", func(t *testing.T) {
+		secret := `# Source: app/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+data:
+  password: cGFzc3dvcmQ=
+`
+		baseline := matrixIndex("prod", secret)
+		matrix, err := ReleasesMatrix("prod/app", baseline, []string{"a", "b"}, []map[string]*manifest.MappingResult{matrixIndex("prod", secret), matrixIndex("prod", secret)}, options)
+		require.NoError(t, err)
+		require.False(t, matrix.HasChanges())
+	})
+}
+
+func TestReleasesAcrossCharts(t *testing.T) {
+	fork := matrixIndex("default", `# Source: fork/templates/deploy.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 1
+`, `# Source: fork/templates/svc.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+`)
+	upstream := matrixIndex("default", `# Source: upstream/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 2
+`, `# Source: upstream/templates/svc.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+`)
+
+	t.Run("without chart name", func(t *testing.T) {
+		options := &Options{OutputFormat: "simple", OutputContext: -1, IgnoreChartName: true}
+		matrix, err := ReleasesMatrix("fork", fork, []string{"upstream"}, []map[string]*manifest.MappingResult{upstream}, options)
+		require.NoError(t, err)
+		require.Equal(t, []ReleaseMatrixRow{
+			{Key: "templates/deploy.yaml", Changes: map[string]string{"upstream": "REMOVE"}},
+			{Key: "templates/deployment.yaml", Changes: map[string]string{"upstream": "ADD"}},
+		}, matrix.Resources)
+	})
+
+	t.Run("with source mapping", func(t *testing.T) {
+		options := &Options{
+			OutputFormat:    "simple",
+			OutputContext:   -1,
+			IgnoreChartName: true,
+			SourceMapping:   map[string]string{"fork/templates/deploy.yaml": "upstream/templates/deployment.yaml"},
+		}
+		var buf bytes.Buffer
+		require.True(t, Releases(copyIndex(fork), copyIndex(upstream), options, &buf))
+		require.Equal(t, "templates/deployment.yaml to be changed.\nPlan: 0 to add, 1 to change, 0 to destroy, 0 to change ownership.\n", buf.String())
+	})
+}
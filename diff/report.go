@@ -1,15 +1,16 @@
 package diff
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"strings"
 	"text/template"
 
 	"github.com/aryann/difflib"
@@ -22,24 +23,38 @@ import (
 type Report struct {
 	format      ReportFormat
 	Entries     []ReportEntry
-	mode        string
 	findRenames float32
+	// changes tells whether the diff found changes, including the ones whose diff is empty after suppression.
+	changes bool
 }
 
 // ReportEntry to store changes between releases
 type ReportEntry struct {
-	Key             string
-	SuppressedKinds []string
-	Kind            string
-	Context         int
-	Diffs           []difflib.DiffRecord
-	ChangeType      string
-	Structured      *StructuredEntry
+	Key             string               `json:"key"`
+	SuppressedKinds []string             `json:"suppressedKinds,omitempty"`
+	Kind            string               `json:"kind,omitempty"`
+	Context         int                  `json:"context"`
+	Diffs           []difflib.DiffRecord `json:"diffs,omitempty"`
+	ChangeType      string               `json:"changeType"`
+	Structured      *StructuredEntry     `json:"structured,omitempty"`
+	Explanation     *Explanation         `json:"explanation,omitempty"`
+	FieldConflicts  []FieldConflict      `json:"fieldConflicts,omitempty"`
+	FieldOrigins    []FieldOrigin        `json:"fieldOrigins,omitempty"`
+	// ImmutableFields are the changed fields that the API server rejects updates of.
+	ImmutableFields []string `json:"immutableFields,omitempty"`
+	// Rollout is set when the change of a workload rolls its pods.
+	Rollout *Rollout `json:"rollout,omitempty"`
+	// APIDeprecation is set when the new manifest uses an API version deprecated or removed in Options.KubeVersion.
+	APIDeprecation *APIDeprecation `json:"apiDeprecation,omitempty"`
+	// Error is the reason why the resource could not be diffed, for the ERROR change type.
+	Error string `json:"error,omitempty"`
+	// ChangesError is the reason why the structured entry could not be built, whose field-level changes are then missing.
+	ChangesError string `json:"changesError,omitempty"`
 }
 
 // ReportFormat to the context to make a changes report
 type ReportFormat struct {
-	output       func(r *Report, to io.Writer)
+	output       func(r *Report, to io.Writer) error
 	changestyles map[string]ChangeStyle
 }
 
@@ -56,37 +71,39 @@ type ReportTemplateSpec struct {
 	Kind      string
 	API       string
 	Change    string
+	// Explanation is only set with --explain.
+	Explanation *Explanation
+	// FieldConflicts is only set with --show-field-owners.
+	FieldConflicts []FieldConflict
+	// FieldOrigins is only set with --show-field-origins.
+	FieldOrigins []FieldOrigin
+	// ImmutableFields are the changed fields that the API server rejects updates of.
+	ImmutableFields []string
+	// Rollout is set when the change of a workload rolls its pods.
+	Rollout *Rollout
+	// APIDeprecation is only set with a Kubernetes version to check API versions against.
+	APIDeprecation *APIDeprecation
+	// Error is only set for the ERROR change type.
+	Error string
 }
 
-// setupReportFormat: process output argument.
-func (r *Report) setupReportFormat(format string) {
-	r.mode = format
-	switch format {
-	case "simple":
-		setupSimpleReport(r)
-	case "template":
-		setupTemplateReport(r)
-	case "json":
-		setupJSONReport(r)
-	case "structured":
-		setupStructuredReport(r)
-	case "dyff":
-		setupDyffReport(r)
-	default:
-		setupDiffReport(r)
-	}
-}
-
-func setupDyffReport(r *Report) {
+func setupDyffReport(r *Report) error {
 	r.format.output = printDyffReport
+	return nil
 }
 
-func printDyffReport(r *Report, to io.Writer) {
-	currentFile, _ := os.CreateTemp("", "existing-values")
+func printDyffReport(r *Report, to io.Writer) error {
+	currentFile, err := os.CreateTemp("", "existing-values")
+	if err != nil {
+		return err
+	}
 	defer func() {
 		_ = os.Remove(currentFile.Name())
 	}()
-	newFile, _ := os.CreateTemp("", "new-values")
+	newFile, err := os.CreateTemp("", "new-values")
+	if err != nil {
+		return err
+	}
 	defer func() {
 		_ = os.Remove(newFile.Name())
 	}()
@@ -109,7 +126,10 @@ func printDyffReport(r *Report, to io.Writer) {
 	_ = currentFile.Close()
 	_ = newFile.Close()
 
-	currentInputFile, newInputFile, _ := ytbx.LoadFiles(currentFile.Name(), newFile.Name())
+	currentInputFile, newInputFile, err := ytbx.LoadFiles(currentFile.Name(), newFile.Name())
+	if err != nil {
+		return fmt.Errorf("unable to load the dyff input: %w", err)
+	}
 
 	var compareOptions []dyff.CompareOption
 	compareOptions = append(compareOptions,
@@ -119,41 +139,90 @@ func printDyffReport(r *Report, to io.Writer) {
 	if r.findRenames > 0 {
 		compareOptions = append(compareOptions, dyff.DetectRenames(true))
 	}
-	report, _ := dyff.CompareInputFiles(currentInputFile, newInputFile, compareOptions...)
+	report, err := dyff.CompareInputFiles(currentInputFile, newInputFile, compareOptions...)
+	if err != nil {
+		return fmt.Errorf("unable to compare with dyff: %w", err)
+	}
 	reportWriter := &dyff.HumanReport{
 		Report:               report,
 		OmitHeader:           true,
 		MinorChangeThreshold: 0.1,
 	}
-	_ = reportWriter.WriteReport(to)
+	if err := reportWriter.WriteReport(to); err != nil {
+		return err
+	}
+
+	// dyff reports changes by document path, list the explanations and warnings of the entries below
+	for _, entry := range r.Entries {
+		if entry.Error != "" {
+			_, _ = fmt.Fprintf(to, "%s: could not be diffed: %s\n", entry.Key, entry.Error)
+		}
+		if entry.Explanation != nil {
+			_, _ = fmt.Fprintf(to, "%s: %s\n", entry.Key, entry.Explanation)
+		}
+		if entry.Rollout != nil {
+			_, _ = fmt.Fprintf(to, "%s: %s\n", entry.Key, entry.Rollout)
+		}
+		if entry.APIDeprecation != nil {
+			_, _ = fmt.Fprintf(to, "%s: %s\n", entry.Key, entry.APIDeprecation)
+		}
+		for _, field := range entry.ImmutableFields {
+			_, _ = fmt.Fprintf(to, "%s: %s\n", entry.Key, immutableWarning(field))
+		}
+		for _, c := range entry.FieldConflicts {
+			_, _ = fmt.Fprintf(to, "%s: %s\n", entry.Key, c)
+		}
+		for _, o := range entry.FieldOrigins {
+			_, _ = fmt.Fprintf(to, "%s: %s\n", entry.Key, o)
+		}
+	}
+	return nil
 }
 
 // addEntry: stores diff changes.
-func (r *Report) addEntry(key string, suppressedKinds []string, kind string, context int, diffs []difflib.DiffRecord, changeType string, structured *StructuredEntry) {
-	entry := ReportEntry{
-		key,
-		suppressedKinds,
-		kind,
-		context,
-		diffs,
-		changeType,
-		structured,
-	}
+func (r *Report) addEntry(entry ReportEntry) {
 	r.Entries = append(r.Entries, entry)
 }
 
-// print: prints entries added to the report.
-func (r *Report) print(to io.Writer) {
-	r.format.output(r, to)
+// Write writes the report in the output format, like "diff", "simple", "json", "structured", "template", "dyff",
+// "markdown", "html", a format registered with RegisterFormat or the one of a helm-diff-format-<name> executable.
+// Unknown formats are written as "diff".
+// Reports of Compare can be written in every format.
+func (r *Report) Write(w io.Writer, format string) error {
+	return r.WriteContext(context.Background(), w, format)
+}
+
+// WriteContext is Write with a context, which stops the formatters like external ones when it is done.
+func (r *Report) WriteContext(ctx context.Context, w io.Writer, format string) error {
+	ew := &errWriter{w: w}
+	if err := lookupFormat(format).Format(ctx, r, ew); err != nil {
+		return err
+	}
+	return ew.err
 }
 
-// clean: needed for testing
-func (r *Report) clean() {
-	r.Entries = nil
+// HasChanges tells whether the diff found changes, even if their diff is empty after suppressing output lines.
+func (r *Report) HasChanges() bool {
+	return r.changes
+}
+
+// errWriter remembers the first error writing to w, so that printers don't need to check every write.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.w.Write(p)
+	e.err = err
+	return n, err
 }
 
 // setup report for default output: diff
-func setupDiffReport(r *Report) {
+func setupDiffReport(r *Report) error {
 	r.format.output = printDiffReport
 	r.format.changestyles = make(map[string]ChangeStyle)
 	r.format.changestyles["ADD"] = ChangeStyle{color: "green", message: "has been added:"}
@@ -161,23 +230,87 @@ func setupDiffReport(r *Report) {
 	r.format.changestyles["MODIFY"] = ChangeStyle{color: "yellow", message: "has changed:"}
 	r.format.changestyles["OWNERSHIP"] = ChangeStyle{color: "magenta", message: "changed ownership:"}
 	r.format.changestyles["MODIFY_SUPPRESSED"] = ChangeStyle{color: "blue+h", message: "has changed, but diff is empty after suppression."}
+	r.format.changestyles["ERROR"] = ChangeStyle{color: "red", message: "could not be diffed:"}
+	r.format.changestyles["UNCHANGED"] = ChangeStyle{color: "yellow", message: "is unchanged:"}
+	return nil
 }
 
 // print report for default output: diff
-func printDiffReport(r *Report, to io.Writer) {
+func printDiffReport(r *Report, to io.Writer) error {
 	for _, entry := range r.Entries {
-		_, _ = fmt.Fprintf(
-			to,
-			ansi.Color("%s %s", r.format.changestyles[entry.ChangeType].color)+"\n",
-			entry.Key,
-			r.format.changestyles[entry.ChangeType].message,
-		)
-		printDiffRecords(entry.SuppressedKinds, entry.Kind, entry.Context, entry.Diffs, to)
+		printDiffEntry(r, entry, to)
+	}
+	return nil
+}
+
+// printDiffEntry prints the header, the notes and the line diff of an entry.
+func printDiffEntry(r *Report, entry ReportEntry, to io.Writer) {
+	_, _ = fmt.Fprintf(
+		to,
+		ansi.Color("%s %s", r.format.changestyles[entry.ChangeType].color)+"\n",
+		entry.Key,
+		r.format.changestyles[entry.ChangeType].message,
+	)
+	printEntryNotes(entry, to)
+	printDiffRecords(entry.SuppressedKinds, entry.Kind, entry.Context, entry.Diffs, to)
+}
+
+// entryNote is a line below the header of an entry, like its error, its explanation or a warning.
+// Flagged notes, which make the upgrade fail or get reverted, start with "! ".
+type entryNote struct {
+	text  string
+	color string
+}
+
+// entryNotes returns the error, the explanation and the warnings of an entry, in the order they are printed.
+func entryNotes(entry ReportEntry) []entryNote {
+	var notes []entryNote
+	if entry.Error != "" {
+		for _, line := range strings.Split(entry.Error, "\n") {
+			notes = append(notes, entryNote{line, "red"})
+		}
+	}
+	if entry.Explanation != nil {
+		notes = append(notes, entryNote{entry.Explanation.String(), "cyan"})
+	}
+	// the rollout of a workload, if its change rolls pods
+	if entry.Rollout != nil {
+		notes = append(notes, entryNote{entry.Rollout.String(), "yellow"})
+	}
+	// removed API versions are flagged, deprecated ones are not
+	switch {
+	case entry.APIDeprecation == nil:
+	case entry.APIDeprecation.Removed:
+		notes = append(notes, entryNote{"! " + entry.APIDeprecation.String(), "red"})
+	default:
+		notes = append(notes, entryNote{entry.APIDeprecation.String(), "yellow"})
+	}
+	for _, field := range entry.ImmutableFields {
+		notes = append(notes, entryNote{"! " + immutableWarning(field), "red"})
+	}
+	// conflicts failing the upgrade or likely reverted by a controller are flagged
+	for _, c := range entry.FieldConflicts {
+		if c.Flagged() {
+			notes = append(notes, entryNote{"! " + c.String(), "red"})
+			continue
+		}
+		notes = append(notes, entryNote{c.String(), "cyan"})
+	}
+	for _, o := range entry.FieldOrigins {
+		notes = append(notes, entryNote{o.String(), "cyan"})
+	}
+	return notes
+}
+
+// printEntryNotes prints the error, the explanation and the warnings of an entry below its header.
+func printEntryNotes(entry ReportEntry, to io.Writer) {
+	for _, note := range entryNotes(entry) {
+		_, _ = fmt.Fprintln(to, ansi.Color("  "+note.text, note.color))
 	}
 }
 
 // setup report for simple output.
-func setupSimpleReport(r *Report) {
+func setupSimpleReport(r *Report) error {
 	r.format.output = printSimpleReport
 	r.format.changestyles = make(map[string]ChangeStyle)
 	r.format.changestyles["ADD"] = ChangeStyle{color: "green", message: "to be added."}
@@ -185,25 +318,71 @@ func setupSimpleReport(r *Report) {
 	r.format.changestyles["MODIFY"] = ChangeStyle{color: "yellow", message: "to be changed."}
 	r.format.changestyles["OWNERSHIP"] = ChangeStyle{color: "magenta", message: "to change ownership."}
 	r.format.changestyles["MODIFY_SUPPRESSED"] = ChangeStyle{color: "blue+h", message: "has changed, but diff is empty after suppression."}
+	r.format.changestyles["ERROR"] = ChangeStyle{color: "red", message: "could not be diffed:"}
+	r.format.changestyles["UNCHANGED"] = ChangeStyle{color: "yellow", message: "is unchanged:"}
+	return nil
 }
 
 // print report for simple output
-func printSimpleReport(r *Report, to io.Writer) {
-	summary := map[string]int{
-		"ADD":               0,
-		"REMOVE":            0,
-		"MODIFY":            0,
-		"OWNERSHIP":         0,
-		"MODIFY_SUPPRESSED": 0,
+func printSimpleReport(r *Report, to io.Writer) error {
+	var summary changeSummary
+	for _, entry := range r.Entries {
+		printSimpleEntry(r, entry, to)
+		summary.add(entry)
+	}
+	for _, line := range summary.lines() {
+		_, _ = fmt.Fprintln(to, line)
+	}
+	return nil
+}
+
+// printSimpleEntry prints the header and the notes of an entry.
+func printSimpleEntry(r *Report, entry ReportEntry, to io.Writer) {
+	_, _ = fmt.Fprintf(to, ansi.Color("%s %s", r.format.changestyles[entry.ChangeType].color)+"\n",
+		entry.Key,
+		r.format.changestyles[entry.ChangeType].message,
+	)
+	printEntryNotes(entry, to)
+}
+
+// changeSummary counts entries by change type.
+type changeSummary struct {
+	changes  map[string]int
+	rollouts int
+}
+
+func (s *changeSummary) add(entry ReportEntry) {
+	if s.changes == nil {
+		s.changes = map[string]int{}
 	}
+	s.changes[entry.ChangeType]++
+	if entry.Rollout != nil {
+		s.rollouts++
+	}
+}
+
+// lines returns the lines summing up the entries by change type.
+func (s *changeSummary) lines() []string {
+	lines := []string{fmt.Sprintf("Plan: %d to add, %d to change, %d to destroy, %d to change ownership.", s.changes["ADD"], s.changes["MODIFY"], s.changes["REMOVE"], s.changes["OWNERSHIP"])}
+	if s.rollouts > 0 {
+		lines = append(lines, fmt.Sprintf("Rollouts: %d workloads will roll out pods.", s.rollouts))
+	}
+	if s.changes["ERROR"] > 0 {
+		lines = append(lines, fmt.Sprintf("Errors: %d resources could not be diffed.", s.changes["ERROR"]))
+	}
+	if s.changes["UNCHANGED"] > 0 {
+		lines = append(lines, fmt.Sprintf("Deprecated APIs: %d unchanged resources use deprecated or removed API versions.", s.changes["UNCHANGED"]))
+	}
+	return lines
+}
+
+// summary returns the lines summing up the entries of the report by change type.
+func (r *Report) summary() []string {
+	var summary changeSummary
 	for _, entry := range r.Entries {
-		_, _ = fmt.Fprintf(to, ansi.Color("%s %s", r.format.changestyles[entry.ChangeType].color)+"\n",
-			entry.Key,
-			r.format.changestyles[entry.ChangeType].message,
-		)
-		summary[entry.ChangeType]++
+		summary.add(entry)
 	}
-	_, _ = fmt.Fprintf(to, "Plan: %d to add, %d to change, %d to destroy, %d to change ownership.\n", summary["ADD"], summary["MODIFY"], summary["REMOVE"], summary["OWNERSHIP"])
+	return summary.lines()
 }
 
 func newTemplate(name string) *template.Template {
@@ -212,16 +391,20 @@ func newTemplate(name string) *template.Template {
 		"last": func(x int, a interface{}) bool {
 			return x == reflect.ValueOf(a).Len()-1
 		},
+		"toJson": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
 	}
 
 	return template.New(name).Funcs(funcsMap)
 }
 
 // setup report for json output
-func setupJSONReport(r *Report) {
+func setupJSONReport(r *Report) error {
 	t, err := newTemplate("entries").Parse(defaultTemplateReport)
 	if err != nil {
-		log.Fatalf("Error loading default template: %v", err)
+		return fmt.Errorf("error loading default template: %w", err)
 	}
 
 	r.format.output = templateReportPrinter(t)
@@ -231,10 +414,13 @@ func setupJSONReport(r *Report) {
 	r.format.changestyles["MODIFY"] = ChangeStyle{color: "yellow", message: ""}
 	r.format.changestyles["OWNERSHIP"] = ChangeStyle{color: "magenta", message: ""}
 	r.format.changestyles["MODIFY_SUPPRESSED"] = ChangeStyle{color: "blue+h", message: ""}
+	r.format.changestyles["ERROR"] = ChangeStyle{color: "red", message: ""}
+	r.format.changestyles["UNCHANGED"] = ChangeStyle{color: "yellow", message: ""}
+	return nil
 }
 
 // setup report for template output
-func setupTemplateReport(r *Report) {
+func setupTemplateReport(r *Report) error {
 	var tpl *template.Template
 
 	{
@@ -242,15 +428,14 @@ func setupTemplateReport(r *Report) {
 		if present {
 			t, err := newTemplate(filepath.Base(tplFile)).ParseFiles(tplFile)
 			if err != nil {
-				fmt.Println(err)
-				log.Fatalf("Error loading custom template")
+				return fmt.Errorf("error loading custom template: %w", err)
 			}
 			tpl = t
 		} else {
 			// Render
 			t, err := newTemplate("entries").Parse(defaultTemplateReport)
 			if err != nil {
-				log.Fatalf("Error loading default template")
+				return fmt.Errorf("error loading default template: %w", err)
 			}
 			tpl = t
 		}
@@ -263,39 +448,62 @@ func setupTemplateReport(r *Report) {
 	r.format.changestyles["MODIFY"] = ChangeStyle{color: "yellow", message: ""}
 	r.format.changestyles["OWNERSHIP"] = ChangeStyle{color: "magenta", message: ""}
 	r.format.changestyles["MODIFY_SUPPRESSED"] = ChangeStyle{color: "blue+h", message: ""}
+	r.format.changestyles["ERROR"] = ChangeStyle{color: "red", message: ""}
+	r.format.changestyles["UNCHANGED"] = ChangeStyle{color: "yellow", message: ""}
+	return nil
 }
 
-func setupStructuredReport(r *Report) {
+func setupStructuredReport(r *Report) error {
 	r.format.output = printStructuredReport
+	return nil
 }
 
-func printStructuredReport(r *Report, to io.Writer) {
+func printStructuredReport(r *Report, to io.Writer) error {
 	entries := make([]StructuredEntry, 0, len(r.Entries))
 	for _, entry := range r.Entries {
-		if entry.Structured != nil {
-			structuredCopy := *entry.Structured
-			if structuredCopy.ChangeType == "" {
-				structuredCopy.ChangeType = entry.ChangeType
-			}
-			entries = append(entries, structuredCopy)
-			continue
-		}
-		entries = append(entries, StructuredEntry{
-			Name:       entry.Key,
-			ChangeType: entry.ChangeType,
-		})
+		entries = append(entries, structuredEntry(entry))
 	}
 	encoder := json.NewEncoder(to)
 	encoder.SetIndent("", "  ")
 	if err := encoder.Encode(entries); err != nil {
-		log.Printf("Error encoding structured diff output: %v\n", err)
+		return fmt.Errorf("error encoding structured diff output: %w", err)
+	}
+	return nil
+}
+
+// structuredEntry returns the structured entry of a report entry, or a basic one if none could be built.
+func structuredEntry(entry ReportEntry) StructuredEntry {
+	if entry.Structured != nil {
+		structuredCopy := *entry.Structured
+		if structuredCopy.ChangeType == "" {
+			structuredCopy.ChangeType = entry.ChangeType
+		}
+		structuredCopy.Explanation = entry.Explanation
+		structuredCopy.FieldConflicts = entry.FieldConflicts
+		structuredCopy.FieldOrigins = entry.FieldOrigins
+		structuredCopy.ImmutableFields = entry.ImmutableFields
+		structuredCopy.Rollout = entry.Rollout
+		structuredCopy.APIDeprecation = entry.APIDeprecation
+		return structuredCopy
+	}
+	return StructuredEntry{
+		Name:            entry.Key,
+		ChangeType:      entry.ChangeType,
+		Explanation:     entry.Explanation,
+		FieldConflicts:  entry.FieldConflicts,
+		FieldOrigins:    entry.FieldOrigins,
+		ImmutableFields: entry.ImmutableFields,
+		Rollout:         entry.Rollout,
+		APIDeprecation:  entry.APIDeprecation,
+		Error:           entry.Error,
+		ChangesError:    entry.ChangesError,
 	}
 }
 
 // report with template output will only have access to ReportTemplateSpec.
 // This function reverts parsedMetadata.String()
 func (t *ReportTemplateSpec) loadFromKey(key string) error {
-	pattern := regexp.MustCompile(`(?P<namespace>[a-z0-9-]+), (?P<name>[a-z0-9.-]+), (?P<kind>\w+) \((?P<api>[^)]+)\)`)
+	pattern := regexp.MustCompile(`(?P<namespace>[a-z0-9-]*), (?P<name>[a-z0-9.-]+), (?P<kind>\w+) \((?P<api>[^)]+)\)`)
 	matches := pattern.FindStringSubmatch(key)
 	if len(matches) > 1 {
 		t.Namespace = matches[1]
@@ -308,22 +516,31 @@ func (t *ReportTemplateSpec) loadFromKey(key string) error {
 }
 
 // load and print report for template output
-func templateReportPrinter(t *template.Template) func(r *Report, to io.Writer) {
-	return func(r *Report, to io.Writer) {
+func templateReportPrinter(t *template.Template) func(r *Report, to io.Writer) error {
+	return func(r *Report, to io.Writer) error {
 		var templateDataArray []ReportTemplateSpec
 
 		for _, entry := range r.Entries {
 			templateData := ReportTemplateSpec{}
-			err := templateData.loadFromKey(entry.Key)
-			if err != nil {
-				log.Println("error processing report entry")
-			} else {
-				templateData.Change = entry.ChangeType
-				templateDataArray = append(templateDataArray, templateData)
+			if err := templateData.loadFromKey(entry.Key); err != nil {
+				// keys without metadata, like those of documents that cannot be parsed, name the entry
+				templateData.Name = entry.Key
 			}
+			templateData.Change = entry.ChangeType
+			templateData.Explanation = entry.Explanation
+			templateData.FieldConflicts = entry.FieldConflicts
+			templateData.FieldOrigins = entry.FieldOrigins
+			templateData.ImmutableFields = entry.ImmutableFields
+			templateData.Rollout = entry.Rollout
+			templateData.APIDeprecation = entry.APIDeprecation
+			templateData.Error = entry.Error
+			templateDataArray = append(templateDataArray, templateData)
 		}
 
-		_ = t.Execute(to, templateDataArray)
+		if err := t.Execute(to, templateDataArray); err != nil {
+			return fmt.Errorf("error executing template: %w", err)
+		}
 		_, _ = to.Write([]byte("\n"))
+		return nil
 	}
 }
@@ -2,10 +2,16 @@ package diff
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/aryann/difflib"
+	"github.com/mgutz/ansi"
 	"github.com/stretchr/testify/require"
+
+	"github.com/databus23/helm-diff/v3/manifest"
 )
 
 func TestLoadFromKey(t *testing.T) {
@@ -22,6 +28,11 @@ func TestLoadFromKey(t *testing.T) {
 			Kind:      "CustomResourceDefinition",
 			API:       "apiextensions.k8s.io",
 		},
+		", admin, ClusterRole (rbac.authorization.k8s.io)": {
+			Name: "admin",
+			Kind: "ClusterRole",
+			API:  "rbac.authorization.k8s.io",
+		},
 		"default, my-cert, Certificate (cert-manager.io/v1)": {
 			Namespace: "default",
 			Name:      "my-cert",
@@ -58,7 +69,7 @@ func TestPrintDyffReport(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	printDyffReport(report, &buf)
+	require.NoError(t, printDyffReport(report, &buf))
 
 	output := buf.String()
 	require.NotEmpty(t, output)
@@ -96,7 +107,7 @@ func TestPrintDyffReportWithAddAndRemove(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	printDyffReport(report, &buf)
+	require.NoError(t, printDyffReport(report, &buf))
 
 	output := buf.String()
 	require.NotEmpty(t, output)
@@ -153,11 +164,11 @@ func TestPrintDyffReportAddRemoveDiffersFromModify(t *testing.T) {
 	}
 
 	var addRemoveBuf bytes.Buffer
-	printDyffReport(addRemoveReport, &addRemoveBuf)
+	require.NoError(t, printDyffReport(addRemoveReport, &addRemoveBuf))
 	addRemoveOutput := addRemoveBuf.String()
 
 	var modifyBuf bytes.Buffer
-	printDyffReport(modifyReport, &modifyBuf)
+	require.NoError(t, printDyffReport(modifyReport, &modifyBuf))
 	modifyOutput := modifyBuf.String()
 
 	require.NotEqual(t, addRemoveOutput, modifyOutput,
@@ -197,7 +208,7 @@ func TestPrintDyffReportRenameDetectionEnabledWithFindRenames(t *testing.T) {
 	}
 
 	var noRenameBuf bytes.Buffer
-	printDyffReport(&Report{findRenames: 0, Entries: entries}, &noRenameBuf)
+	require.NoError(t, printDyffReport(&Report{findRenames: 0, Entries: entries}, &noRenameBuf))
 	noRenameOutput := noRenameBuf.String()
 
 	require.Contains(t, noRenameOutput, "one document removed",
@@ -206,7 +217,7 @@ func TestPrintDyffReportRenameDetectionEnabledWithFindRenames(t *testing.T) {
 		"Without findRenames, dyff should report a separate document addition")
 
 	var withRenameBuf bytes.Buffer
-	printDyffReport(&Report{findRenames: 1.0, Entries: entries}, &withRenameBuf)
+	require.NoError(t, printDyffReport(&Report{findRenames: 1.0, Entries: entries}, &withRenameBuf))
 	withRenameOutput := withRenameBuf.String()
 
 	require.NotContains(t, withRenameOutput, "one document removed",
@@ -221,8 +232,181 @@ func TestPrintDyffReportEmpty(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	printDyffReport(report, &buf)
+	require.NoError(t, printDyffReport(report, &buf))
 
 	output := buf.String()
 	require.Equal(t, "\n", output)
 }
+
+func TestErrorEntries(t *testing.T) {
+	ansi.DisableColors(true)
+	broken := &manifest.MappingResult{Name: "document 2", Content: "kind: [", Err: errors.New("yaml: line 1: did not find expected node content")}
+	oldIndex := indexOf(parseObject(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\ndata:\n  key: a\n"))
+	newIndex := indexOf(parseObject(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\ndata:\n  key: b\n"))
+	newIndex[broken.Name] = broken
+
+	t.Run("diff", func(t *testing.T) {
+		var buf bytes.Buffer
+		Manifests(oldIndex, newIndex, &Options{OutputFormat: "diff", OutputContext: -1}, &buf)
+		require.Contains(t, buf.String(), "default, app, ConfigMap (v1) has changed:")
+		require.Contains(t, buf.String(), "document 2 could not be diffed:\n  yaml: line 1: did not find expected node content\n")
+	})
+
+	t.Run("simple", func(t *testing.T) {
+		var buf bytes.Buffer
+		Manifests(oldIndex, newIndex, &Options{OutputFormat: "simple", OutputContext: -1}, &buf)
+		require.Contains(t, buf.String(), "Errors: 1 resources could not be diffed.\n")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		Manifests(oldIndex, newIndex, &Options{OutputFormat: "json", OutputContext: -1}, &buf)
+		var entries []struct {
+			Name   string
+			Change string
+			Error  string
+		}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entries))
+		require.Len(t, entries, 2)
+		require.Equal(t, "ERROR", entries[1].Change)
+		require.Equal(t, "document 2", entries[1].Name)
+		require.Equal(t, broken.Err.Error(), entries[1].Error)
+	})
+
+	t.Run("structured", func(t *testing.T) {
+		var buf bytes.Buffer
+		Manifests(oldIndex, newIndex, &Options{OutputFormat: "structured", OutputContext: -1}, &buf)
+		var entries []StructuredEntry
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &entries))
+		require.Len(t, entries, 2)
+		require.Equal(t, "ERROR", entries[1].ChangeType)
+		require.Equal(t, broken.Err.Error(), entries[1].Error)
+	})
+}
+
+// TestEntryNotesOutputFormats checks that the notes of the entries, like rollouts or immutable fields,
+// are written in every output format.
+func TestEntryNotesOutputFormats(t *testing.T) {
+	ansi.DisableColors(true)
+	three := 3
+
+	for _, tc := range []struct {
+		name     string
+		old, new *manifest.MappingResult
+		options  Options
+		key      string
+		// notes are the lines of the entry in the diff and simple output, warnings starting with "! "
+		notes []string
+		// summary is the line of the notes in the summary of the simple output
+		summary string
+		// expected are the notes of the entry in the json and structured output
+		expected StructuredEntry
+	}{
+		{
+			name:    "API deprecation",
+			old:     parseObject(t, pdbYAML("policy/v1beta1", "1")),
+			new:     parseObject(t, pdbYAML("policy/v1beta1", "2")),
+			options: Options{KubeVersion: "1.25"},
+			key:     "default, app, PodDisruptionBudget (policy)",
+			notes:   []string{"! policy/v1beta1 PodDisruptionBudget removed in 1.25, use policy/v1"},
+			expected: StructuredEntry{APIDeprecation: &APIDeprecation{
+				APIVersion: "policy/v1beta1", Kind: "PodDisruptionBudget", DeprecatedIn: "1.21", RemovedIn: "1.25", Removed: true, Replacement: "policy/v1",
+			}},
+		},
+		{
+			name:     "explanation",
+			old:      parseObject(t, sourcedYAML("cm", "app/charts/sub/templates/cm.yaml", "v1")),
+			new:      parseObject(t, sourcedYAML("cm", "app/charts/sub/templates/cm.yaml", "v2")),
+			options:  Options{Explain: true},
+			key:      "default, cm, ConfigMap (v1)",
+			notes:    []string{"source app/charts/sub/templates/cm.yaml of subchart sub"},
+			expected: StructuredEntry{Explanation: &Explanation{Source: "app/charts/sub/templates/cm.yaml", Subchart: "sub"}},
+		},
+		{
+			name:    "field origins",
+			old:     liveDeployment(parseObject(t, deploymentYAML("5", "app:1.0", "ops")), parseObject(t, deploymentYAML("3", "app:1.0", "ops"))),
+			new:     parseObject(t, deploymentYAML("3", "app:2.0", "ops")),
+			key:     "default, app, Deployment (apps)",
+			notes:   []string{"will roll out 3 replicas", "spec.replicas: reverts live drift", "spec.template.spec.containers[0].image: chart change"},
+			summary: "Rollouts: 1 workloads will roll out pods.",
+			expected: StructuredEntry{
+				Rollout: &Rollout{Replicas: &three},
+				FieldOrigins: []FieldOrigin{
+					{Path: "spec.replicas", Origin: FieldOriginRevertsDrift},
+					{Path: "spec.template.spec.containers[0].image", Origin: FieldOriginChart},
+				},
+			},
+		},
+		{
+			name: "field conflicts",
+			old:  withOwners(parseObject(t, deploymentYAML("3", "app:1.0", "ops")), hpaOwner, kubectlOwner),
+			new:  parseObject(t, deploymentYAML("1", "app:1.0", "dev")),
+			key:  "default, app, Deployment (apps)",
+			notes: []string{
+				"metadata.annotations.owner is owned by kubectl-annotate (Update)",
+				"! spec.replicas is owned by kube-controller-manager (Update), may be reverted by kube-controller-manager",
+			},
+			expected: StructuredEntry{FieldConflicts: []FieldConflict{
+				{Path: "metadata.annotations.owner", Managers: []FieldManager{{Name: "kubectl-annotate", Operation: "Update"}}},
+				{Path: "spec.replicas", Managers: []FieldManager{{Name: "kube-controller-manager", Operation: "Update"}}, RevertedBy: []string{"kube-controller-manager"}},
+			}},
+		},
+		{
+			name:     "immutable fields",
+			old:      parseObject(t, "apiVersion: v1\nkind: Service\nmetadata:\n  name: app\nspec:\n  clusterIP: 10.0.0.1\n"),
+			new:      parseObject(t, "apiVersion: v1\nkind: Service\nmetadata:\n  name: app\nspec:\n  clusterIP: 10.0.0.2\n"),
+			key:      "default, app, Service (v1)",
+			notes:    []string{"! spec.clusterIP is immutable, the upgrade fails unless the object is recreated"},
+			expected: StructuredEntry{ImmutableFields: []string{"spec.clusterIP"}},
+		},
+		{
+			name:     "rollout",
+			old:      parseObject(t, deploymentYAML("3", "app:1.0", "ops")),
+			new:      parseObject(t, deploymentYAML("3", "app:2.0", "ops")),
+			key:      "default, app, Deployment (apps)",
+			notes:    []string{"will roll out 3 replicas"},
+			summary:  "Rollouts: 1 workloads will roll out pods.",
+			expected: StructuredEntry{Rollout: &Rollout{Replicas: &three}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			write := func(format string) string {
+				options := tc.options
+				options.OutputFormat = format
+				options.OutputContext = -1
+				var buf bytes.Buffer
+				Manifests(indexOf(tc.old), indexOf(tc.new), &options, &buf)
+				return buf.String()
+			}
+			lines := "  " + strings.Join(tc.notes, "\n  ") + "\n"
+
+			require.Contains(t, write("diff"), tc.key+" has changed:\n"+lines)
+
+			simple := write("simple")
+			require.Contains(t, simple, tc.key+" to be changed.\n"+lines)
+			if tc.summary != "" {
+				require.Contains(t, simple, "\n"+tc.summary+"\n")
+			}
+
+			dyff := write("dyff")
+			for _, note := range tc.notes {
+				require.Contains(t, dyff, tc.key+": "+strings.TrimPrefix(note, "! ")+"\n")
+			}
+
+			// the json output carries the notes under the keys of the structured output
+			for _, format := range []string{"json", "structured"} {
+				var entries []StructuredEntry
+				require.NoError(t, json.Unmarshal([]byte(write(format)), &entries), format)
+				require.Len(t, entries, 1, format)
+				require.Equal(t, tc.expected, StructuredEntry{
+					Explanation:     entries[0].Explanation,
+					FieldConflicts:  entries[0].FieldConflicts,
+					FieldOrigins:    entries[0].FieldOrigins,
+					ImmutableFields: entries[0].ImmutableFields,
+					Rollout:         entries[0].Rollout,
+					APIDeprecation:  entries[0].APIDeprecation,
+				}, format)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package diff
+
+import "fmt"
+
+// rolloutWorkloads are the workloads that replace their pods when their pod template changes.
+var rolloutWorkloads = map[groupKind]bool{
+	{"apps", "Deployment"}:  true,
+	{"apps", "StatefulSet"}: true,
+	{"apps", "DaemonSet"}:   true,
+}
+
+// rolloutKinds are the kinds of rolloutWorkloads, checked before their manifests are parsed.
+var rolloutKinds = map[string]bool{"Deployment": true, "StatefulSet": true, "DaemonSet": true}
+
+// Rollout marks a change of a workload that rolls its pods.
+type Rollout struct {
+	// Replicas is the number of pods replaced. It is nil if the number is unknown: for DaemonSets, and for
+	// workloads that leave their replicas to the cluster, e.g. to a HorizontalPodAutoscaler.
+	Replicas *int `json:"replicas,omitempty"`
+	// EveryNode is set for DaemonSets, which replace the pod of every node they run on.
+	EveryNode bool `json:"everyNode,omitempty"`
+}
+
+func (r Rollout) String() string {
+	switch {
+	case r.EveryNode:
+		return "will roll out the pods on every node"
+	case r.Replicas == nil:
+		return "will roll out all replicas"
+	case *r.Replicas == 1:
+		return "will roll out 1 replica"
+	default:
+		return fmt.Sprintf("will roll out %d replicas", *r.Replicas)
+	}
+}
+
+// rollout returns the rollout the change of a workload triggers, or nil if the change does not restart any pod.
+// Only changes of spec.template roll pods; changes of the replicas, the strategy or the metadata of the workload itself do not.
+// Neither do paused Deployments and workloads with the OnDelete update strategy, which leave replacing the pods to the user.
+func rollout(change *objectChange) *Rollout {
+	if change.oldContent == nil || change.newContent == nil || !rolloutKinds[change.kind()] {
+		return nil
+	}
+	oldObj, newObj := change.objects()
+	if oldObj == nil {
+		return nil
+	}
+	gk := objectGroupKind(newObj)
+	if !rolloutWorkloads[gk] || objectName(oldObj) != objectName(newObj) {
+		return nil
+	}
+	if valueAt(newObj, []string{"spec", "paused"}) == true ||
+		valueAt(newObj, []string{"spec", "updateStrategy", "type"}) == "OnDelete" {
+		return nil
+	}
+
+	changes, err := change.fieldChanges()
+	if err != nil {
+		return nil
+	}
+	for _, change := range changes {
+		if overlaps("spec.template", changePath(change)) {
+			if gk.kind == "DaemonSet" {
+				return &Rollout{EveryNode: true}
+			}
+			return &Rollout{Replicas: rolloutReplicas(newObj)}
+		}
+	}
+	return nil
+}
+
+// rolloutReplicas returns the replicas of a workload after the change, or nil if its manifest does not set them.
+// Such workloads leave the replicas to the cluster, e.g. to a HorizontalPodAutoscaler, so that their number is unknown.
+func rolloutReplicas(newObj map[string]interface{}) *int {
+	replicas, ok := valueAt(newObj, []string{"spec", "replicas"}).(float64)
+	if !ok {
+		return nil
+	}
+	n := int(replicas)
+	return &n
+}
@@ -0,0 +1,77 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollout(t *testing.T) {
+	replicas := func(n int) *Rollout { return &Rollout{Replicas: &n} }
+
+	for _, tc := range []struct {
+		name     string
+		old, new string
+		expected *Rollout
+	}{
+		{
+			name:     "deployment image",
+			old:      "apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 3\n  template:\n    spec:\n      containers:\n      - image: a\n",
+			new:      "apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 3\n  template:\n    spec:\n      containers:\n      - image: b\n",
+			expected: replicas(3),
+		},
+		{
+			name:     "deployment pod annotation and scale",
+			old:      "apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 3\n  template:\n    metadata:\n      annotations:\n        checksum/config: a\n",
+			new:      "apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 5\n  template:\n    metadata:\n      annotations:\n        checksum/config: b\n",
+			expected: replicas(5),
+		},
+		{
+			name: "deployment replicas, strategy and labels",
+			old:  "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  labels:\n    team: a\nspec:\n  replicas: 3\n  strategy:\n    type: Recreate\n",
+			new:  "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  labels:\n    team: b\nspec:\n  replicas: 5\n  strategy:\n    type: RollingUpdate\n",
+		},
+		{
+			name:     "statefulset without replicas",
+			old:      "apiVersion: apps/v1\nkind: StatefulSet\nspec:\n  template:\n    spec:\n      containers:\n      - image: a\n",
+			new:      "apiVersion: apps/v1\nkind: StatefulSet\nspec:\n  template:\n    spec:\n      containers:\n      - image: b\n",
+			expected: &Rollout{},
+		},
+		{
+			name: "statefulset updated on delete",
+			old:  "apiVersion: apps/v1\nkind: StatefulSet\nspec:\n  replicas: 3\n  updateStrategy:\n    type: OnDelete\n  template:\n    spec:\n      containers:\n      - image: a\n",
+			new:  "apiVersion: apps/v1\nkind: StatefulSet\nspec:\n  replicas: 3\n  updateStrategy:\n    type: OnDelete\n  template:\n    spec:\n      containers:\n      - image: b\n",
+		},
+		{
+			name: "paused deployment",
+			old:  "apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 3\n  paused: true\n  template:\n    spec:\n      containers:\n      - image: a\n",
+			new:  "apiVersion: apps/v1\nkind: Deployment\nspec:\n  replicas: 3\n  paused: true\n  template:\n    spec:\n      containers:\n      - image: b\n",
+		},
+		{
+			name:     "daemonset",
+			old:      "apiVersion: apps/v1\nkind: DaemonSet\nspec:\n  template:\n    spec:\n      containers:\n      - image: a\n",
+			new:      "apiVersion: apps/v1\nkind: DaemonSet\nspec:\n  template:\n    spec:\n      containers:\n      - image: b\n",
+			expected: &Rollout{EveryNode: true},
+		},
+		{
+			name: "job",
+			old:  "apiVersion: batch/v1\nkind: Job\nspec:\n  template:\n    spec:\n      containers:\n      - image: a\n",
+			new:  "apiVersion: batch/v1\nkind: Job\nspec:\n  template:\n    spec:\n      containers:\n      - image: b\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, rollout(newObjectChange(parseObject(t, tc.old), parseObject(t, tc.new))))
+		})
+	}
+
+	require.Nil(t, rollout(newObjectChange(nil, parseObject(t, "apiVersion: apps/v1\nkind: Deployment\n"))))
+	require.Nil(t, rollout(newObjectChange(parseObject(t, deploymentYAML("3", "app:1.0", "ops")), parseObject(t, deploymentYAML("5", "app:1.0", "ops")))))
+}
+
+func TestRolloutString(t *testing.T) {
+	one, three := 1, 3
+	require.Equal(t, "will roll out 1 replica", Rollout{Replicas: &one}.String())
+	require.Equal(t, "will roll out 3 replicas", Rollout{Replicas: &three}.String())
+	require.Equal(t, "will roll out all replicas", Rollout{}.String())
+	require.Equal(t, "will roll out the pods on every node", Rollout{EveryNode: true}.String())
+}
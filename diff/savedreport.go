@@ -0,0 +1,63 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// savedReportVersion is the version of the format of saved reports, raised when older reports cannot be loaded anymore.
+const savedReportVersion = 1
+
+// savedReport is the serialized form of a Report.
+type savedReport struct {
+	Version     int           `json:"version"`
+	FindRenames float32       `json:"findRenames,omitempty"`
+	Changes     bool          `json:"changes"`
+	Entries     []ReportEntry `json:"entries"`
+}
+
+// Save serializes the report with all its entries, their diffs and structured entries.
+// LoadReport restores it to be written in any output format without computing the diff again.
+func (r *Report) Save(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(savedReport{
+		Version:     savedReportVersion,
+		FindRenames: r.findRenames,
+		Changes:     r.changes,
+		Entries:     r.Entries,
+	})
+}
+
+// LoadReport restores a report serialized by Report.Save.
+func LoadReport(rd io.Reader) (*Report, error) {
+	var saved savedReport
+	if err := json.NewDecoder(rd).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("unable to decode the report: %w", err)
+	}
+	if saved.Version != savedReportVersion {
+		return nil, fmt.Errorf("unsupported report version %d, expected %d", saved.Version, savedReportVersion)
+	}
+	return &Report{Entries: saved.Entries, findRenames: saved.FindRenames, changes: saved.Changes}, nil
+}
+
+// Show writes the report in the output format of the options, or browses it with Options.Interactive
+// when to is a terminal.
+func (r *Report) Show(ctx context.Context, to io.Writer, options *Options) error {
+	if options.Interactive && len(r.Entries) > 0 {
+		if out, ok := interactiveTerminal(to); ok {
+			if err := r.browse(os.Stdin, out); err != nil {
+				return fmt.Errorf("unable to browse the report: %w", err)
+			}
+			return nil
+		}
+	}
+
+	if err := r.WriteContext(ctx, to, options.OutputFormat); err != nil {
+		return fmt.Errorf("unable to print the report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mgutz/ansi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveAndLoadReport(t *testing.T) {
+	ansi.DisableColors(true)
+	oldIndex := indexOf(parseObject(t, deploymentYAML("3", "app:1.0", "ops")))
+	newIndex := indexOf(parseObject(t, deploymentYAML("3", "app:2.0", "ops")))
+
+	report, err := Compare(context.Background(), oldIndex, newIndex, &Options{OutputContext: 2})
+	require.NoError(t, err)
+
+	var saved bytes.Buffer
+	require.NoError(t, report.Save(&saved))
+	loaded, err := LoadReport(&saved)
+	require.NoError(t, err)
+	require.True(t, loaded.HasChanges())
+
+	for _, format := range []string{"diff", "simple", "json", "structured", "markdown", "html"} {
+		t.Run(format, func(t *testing.T) {
+			var expected, actual bytes.Buffer
+			require.NoError(t, report.Write(&expected, format))
+			require.NoError(t, loaded.Write(&actual, format))
+			require.Equal(t, expected.String(), actual.String())
+		})
+	}
+
+	t.Run("unsupported version", func(t *testing.T) {
+		_, err := LoadReport(strings.NewReader(`{"version": 0, "entries": []}`))
+		require.ErrorContains(t, err, "unsupported report version 0")
+	})
+}
+
+func TestMarkupReports(t *testing.T) {
+	oldIndex := indexOf(parseObject(t, deploymentYAML("3", "app:1.0", "ops")))
+	newIndex := indexOf(parseObject(t, deploymentYAML("3", "app:2.0", "ops")))
+	report, err := Compare(context.Background(), oldIndex, newIndex, &Options{OutputContext: 1})
+	require.NoError(t, err)
+
+	t.Run("markdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, report.Write(&buf, "markdown"))
+		require.Equal(t, "Plan: 0 to add, 1 to change, 0 to destroy, 0 to change ownership.\n\n"+
+			"Rollouts: 1 workloads will roll out pods.\n\n"+
+			"### `default, app, Deployment (apps)` has changed\n\n"+
+			"- will roll out 3 replicas\n\n"+
+			"```diff\n"+
+			"...\n"+
+			"        - name: app\n"+
+			"-         image: app:1.0\n"+
+			"+         image: app:2.0\n"+
+			"```\n\n", buf.String())
+	})
+
+	t.Run("html", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, report.Write(&buf, "html"))
+		require.Contains(t, buf.String(), "<h3><code>default, app, Deployment (apps)</code> <span style=\"color: yellow\">has changed</span></h3>\n")
+		require.Contains(t, buf.String(), "<li style=\"color: yellow\">will roll out 3 replicas</li>\n")
+		require.Contains(t, buf.String(), "<span style=\"color: red\">-         image: app:1.0</span>\n<span style=\"color: green\">+         image: app:2.0</span>\n")
+	})
+}
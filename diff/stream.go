@@ -0,0 +1,194 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+// streamSetups are the output formats Stream writes entry by entry.
+var streamSetups = map[string]func(r *Report) error{
+	"diff":       setupDiffReport,
+	"simple":     setupSimpleReport,
+	"structured": setupStructuredReport,
+}
+
+// Stream diffs the manifests of two stores like Print, but loads, diffs and writes one resource at a time,
+// so that only the names and hashes of the resources are held in memory. Resources whose content hashes
+// are equal are not loaded at all.
+// It writes the diff, simple and structured output formats only, and does not look for renamed resources.
+func Stream(ctx context.Context, oldStore, newStore *manifest.Store, options *Options, to io.Writer) (bool, error) {
+	if options.FindRenames > 0 {
+		return false, errors.New("renamed resources cannot be searched for when streaming the diff")
+	}
+	format := options.OutputFormat
+	if format == "" {
+		format = "diff"
+	}
+	setup, ok := streamSetups[format]
+	if !ok {
+		return false, fmt.Errorf("the %s output format cannot be streamed", format)
+	}
+
+	s := &streamWriter{format: format, to: &errWriter{w: to}, options: options}
+	if err := setup(&s.report); err != nil {
+		return false, err
+	}
+
+	var removed []string
+	failed := failedSources(newStore.Failed())
+	for _, key := range oldStore.Keys() {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		switch {
+		case newStore.Has(key):
+			if err := s.diff(key, oldStore, newStore); err != nil {
+				return false, err
+			}
+		case oldStore.Err(key) != nil:
+			if err := s.diff(key, oldStore, nil); err != nil {
+				return false, err
+			}
+		case !failed[oldStore.Source(key)]:
+			removed = append(removed, key)
+		}
+	}
+
+	var added []string
+	for _, key := range newStore.Keys() {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		if oldStore.Has(key) {
+			continue
+		}
+		if newStore.Err(key) != nil {
+			if err := s.diff(key, nil, newStore); err != nil {
+				return false, err
+			}
+			continue
+		}
+		added = append(added, key)
+	}
+
+	for _, key := range removed {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		if oldStore.ResourcePolicy(key) == "keep" {
+			continue
+		}
+		if err := s.diff(key, oldStore, nil); err != nil {
+			return false, err
+		}
+	}
+
+	for _, key := range added {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		if err := s.diff(key, nil, newStore); err != nil {
+			return false, err
+		}
+	}
+
+	if err := s.close(); err != nil {
+		return false, err
+	}
+	return s.changes, nil
+}
+
+// streamWriter writes the entries of a report as they are diffed.
+type streamWriter struct {
+	format  string
+	to      *errWriter
+	options *Options
+	// report is set up for the output format and holds no entries.
+	report  Report
+	written int
+	summary changeSummary
+	changes bool
+}
+
+// diff loads the resource from the stores it is in, nil for the side it is missing on, diffs it and writes its entries.
+func (s *streamWriter) diff(key string, oldStore, newStore *manifest.Store) error {
+	if oldStore != nil && newStore != nil && oldStore.Err(key) == nil && newStore.Err(key) == nil {
+		oldHash, _ := oldStore.Hash(key)
+		newHash, _ := newStore.Hash(key)
+		if oldHash == newHash {
+			return nil
+		}
+	}
+
+	var oldContent, newContent *manifest.MappingResult
+	var err error
+	if oldStore != nil {
+		if oldContent, err = oldStore.Load(key); err != nil {
+			return err
+		}
+	}
+	if newStore != nil {
+		if newContent, err = newStore.Load(key); err != nil {
+			return err
+		}
+	}
+
+	var report Report
+	doDiff(&report, key, oldContent, newContent, s.options)
+	if len(report.Entries) == 0 {
+		return nil
+	}
+	s.changes = true
+	report, err = doSuppress(report, s.options.SuppressedOutputLineRegex)
+	if err != nil {
+		return err
+	}
+	return s.write(report.Entries)
+}
+
+func (s *streamWriter) write(entries []ReportEntry) error {
+	for _, entry := range entries {
+		switch s.format {
+		case "structured":
+			data, err := json.MarshalIndent(structuredEntry(entry), "  ", "  ")
+			if err != nil {
+				return fmt.Errorf("error encoding structured diff output: %w", err)
+			}
+			separator := ",\n  "
+			if s.written == 0 {
+				separator = "[\n  "
+			}
+			_, _ = io.WriteString(s.to, separator)
+			_, _ = s.to.Write(data)
+		case "simple":
+			printSimpleEntry(&s.report, entry, s.to)
+		default:
+			printDiffEntry(&s.report, entry, s.to)
+		}
+		s.summary.add(entry)
+		s.written++
+	}
+	return s.to.err
+}
+
+// close writes what follows the entries, like the closing bracket of the structured output.
+func (s *streamWriter) close() error {
+	switch s.format {
+	case "structured":
+		if s.written == 0 {
+			_, _ = io.WriteString(s.to, "[]\n")
+		} else {
+			_, _ = io.WriteString(s.to, "\n]\n")
+		}
+	case "simple":
+		for _, line := range s.summary.lines() {
+			_, _ = fmt.Fprintln(s.to, line)
+		}
+	}
+	return s.to.err
+}
@@ -0,0 +1,137 @@
+package diff
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mgutz/ansi"
+	"github.com/stretchr/testify/require"
+
+	"github.com/databus23/helm-diff/v3/manifest"
+)
+
+const streamOldManifest = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: changed
+data:
+  key: old
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unchanged
+data:
+  key: value
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: removed
+data:
+  key: value
+---
+# Source: app/templates/broken.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: rendered
+data:
+  key: value
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: kept
+  annotations:
+    helm.sh/resource-policy: keep
+data:
+  key: value
+`
+
+const streamNewManifest = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: changed
+data:
+  key: new
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unchanged
+data:
+  key: value
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: added
+data:
+  key: value
+---
+# Source: app/templates/broken.yaml
+kind: [broken
+`
+
+func TestStream(t *testing.T) {
+	ansi.DisableColors(true)
+	parseOptions := manifest.ParseOptions{DefaultNamespace: "default"}
+
+	for _, format := range []string{"diff", "simple", "structured"} {
+		t.Run(format, func(t *testing.T) {
+			options := &Options{OutputFormat: format, OutputContext: 2}
+
+			oldIndex, err := manifest.ParseWithOptions([]byte(streamOldManifest), parseOptions)
+			require.NoError(t, err)
+			newIndex, err := manifest.ParseWithOptions([]byte(streamNewManifest), parseOptions)
+			require.NoError(t, err)
+			var printed bytes.Buffer
+			printedChanges, err := Print(context.Background(), oldIndex, newIndex, nil, options, &printed)
+			require.NoError(t, err)
+
+			oldStore, err := manifest.NewStore(strings.NewReader(streamOldManifest), t.TempDir(), parseOptions)
+			require.NoError(t, err)
+			defer func() { require.NoError(t, oldStore.Close()) }()
+			newStore, err := manifest.NewStore(strings.NewReader(streamNewManifest), t.TempDir(), parseOptions)
+			require.NoError(t, err)
+			defer func() { require.NoError(t, newStore.Close()) }()
+			var streamed bytes.Buffer
+			streamedChanges, err := Stream(context.Background(), oldStore, newStore, options, &streamed)
+			require.NoError(t, err)
+
+			require.Equal(t, printed.String(), streamed.String())
+			require.Equal(t, printedChanges, streamedChanges)
+			require.Contains(t, streamed.String(), "changed")
+			require.Contains(t, streamed.String(), "removed")
+			require.NotContains(t, streamed.String(), "kept")
+			// not removed, but rendered by the template whose new document cannot be parsed
+			require.NotContains(t, streamed.String(), "rendered")
+		})
+	}
+
+	t.Run("no changes", func(t *testing.T) {
+		store, err := manifest.NewStore(strings.NewReader(streamOldManifest), t.TempDir(), parseOptions)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, store.Close()) }()
+		var buf bytes.Buffer
+		changes, err := Stream(context.Background(), store, store, &Options{OutputFormat: "structured"}, &buf)
+		require.NoError(t, err)
+		require.False(t, changes)
+		require.Equal(t, "[]\n", buf.String())
+	})
+
+	t.Run("unsupported options", func(t *testing.T) {
+		store, err := manifest.NewStore(strings.NewReader(""), t.TempDir(), parseOptions)
+		require.NoError(t, err)
+		defer func() { require.NoError(t, store.Close()) }()
+		_, err = Stream(context.Background(), store, store, &Options{OutputFormat: "json"}, &bytes.Buffer{})
+		require.ErrorContains(t, err, "the json output format cannot be streamed")
+		_, err = Stream(context.Background(), store, store, &Options{FindRenames: 0.5}, &bytes.Buffer{})
+		require.Error(t, err)
+	})
+}
@@ -17,14 +17,26 @@ import (
 
 // StructuredEntry captures machine-readable diff information for a resource.
 type StructuredEntry struct {
-	APIVersion        string         `json:"apiVersion,omitempty"`
-	Kind              string         `json:"kind,omitempty"`
-	Namespace         string         `json:"namespace,omitempty"`
-	Name              string         `json:"name,omitempty"`
-	ChangeType        string         `json:"changeType,omitempty"`
-	ResourceStatus    ResourceStatus `json:"resourceStatus"`
-	Changes           []FieldChange  `json:"changes,omitempty"`
-	ChangesSuppressed bool           `json:"changesSuppressed,omitempty"`
+	APIVersion        string          `json:"apiVersion,omitempty"`
+	Kind              string          `json:"kind,omitempty"`
+	Namespace         string          `json:"namespace,omitempty"`
+	Name              string          `json:"name,omitempty"`
+	ChangeType        string          `json:"changeType,omitempty"`
+	ResourceStatus    ResourceStatus  `json:"resourceStatus"`
+	Changes           []FieldChange   `json:"changes,omitempty"`
+	ChangesSuppressed bool            `json:"changesSuppressed,omitempty"`
+	Explanation       *Explanation    `json:"explanation,omitempty"`
+	FieldConflicts    []FieldConflict `json:"fieldConflicts,omitempty"`
+	FieldOrigins      []FieldOrigin   `json:"fieldOrigins,omitempty"`
+	ImmutableFields   []string        `json:"immutableFields,omitempty"`
+	// Rollout is set when the change of a workload rolls its pods.
+	Rollout *Rollout `json:"rollout,omitempty"`
+	// APIDeprecation is set when the new manifest uses an API version deprecated or removed in the target Kubernetes version.
+	APIDeprecation *APIDeprecation `json:"apiDeprecation,omitempty"`
+	// Error is the reason why the resource could not be diffed, for the ERROR change type.
+	Error string `json:"error,omitempty"`
+	// ChangesError is the reason why the field-level changes could not be computed, which are then missing.
+	ChangesError string `json:"changesError,omitempty"`
 }
 
 // ResourceStatus indicates whether manifests existed before or after the diff.
@@ -40,37 +52,34 @@ type FieldChange struct {
 	Change   string      `json:"change"`
 	OldValue interface{} `json:"oldValue,omitempty"`
 	NewValue interface{} `json:"newValue,omitempty"`
+	// tokens is the path of the field split into keys and list indexes.
+	tokens []string
 }
 
-func buildStructuredEntry(key, changeType, kind string, suppressedKinds []string, oldContent, newContent *manifest.MappingResult) (*StructuredEntry, error) {
+func buildStructuredEntry(key, changeType, kind string, suppressedKinds []string, change *objectChange) (*StructuredEntry, error) {
 	entry := &StructuredEntry{
 		ChangeType: changeType,
 		ResourceStatus: ResourceStatus{
-			OldExists: manifestExists(oldContent),
-			NewExists: manifestExists(newContent),
+			OldExists: manifestExists(change.oldContent),
+			NewExists: manifestExists(change.newContent),
 		},
 	}
 
 	isSuppressed := containsKind(suppressedKinds, kind)
 	entry.ChangesSuppressed = isSuppressed
 
-	oldJSON, oldObj, err := manifestToJSON(oldContent)
-	if err != nil {
-		return nil, fmt.Errorf("convert old manifest: %w", err)
-	}
-	newJSON, newObj, err := manifestToJSON(newContent)
-	if err != nil {
-		return nil, fmt.Errorf("convert new manifest: %w", err)
+	if err := change.parse(); err != nil {
+		return nil, err
 	}
 
-	entry.populateMetadata(key, oldObj, newObj)
+	entry.populateMetadata(key, change.oldObj, change.newObj)
 
 	if isSuppressed {
 		return entry, nil
 	}
 
-	if changeType == "MODIFY" && oldJSON != nil && newJSON != nil {
-		changes, err := calculateFieldChanges(oldJSON, newJSON)
+	if changeType == "MODIFY" && change.oldJSON != nil && change.newJSON != nil {
+		changes, err := change.fieldChanges()
 		if err != nil {
 			return nil, err
 		}
@@ -80,6 +89,82 @@ func buildStructuredEntry(key, changeType, kind string, suppressedKinds []string
 	return entry, nil
 }
 
+// objectChange is the change of a resource. Its manifests are converted to JSON and compared field by field
+// at most once, and only when the structured entry or one of the checks of the change needs it.
+type objectChange struct {
+	oldContent, newContent *manifest.MappingResult
+
+	parsed           bool
+	oldText, newText string
+	oldJSON, newJSON []byte
+	oldObj, newObj   map[string]interface{}
+	err              error
+
+	compared   bool
+	changes    []FieldChange
+	changesErr error
+}
+
+func newObjectChange(oldContent, newContent *manifest.MappingResult) *objectChange {
+	return &objectChange{oldContent: oldContent, newContent: newContent}
+}
+
+// kind returns the kind of the resource, as parsed from its manifests.
+func (c *objectChange) kind() string {
+	for _, content := range []*manifest.MappingResult{c.newContent, c.oldContent} {
+		if content != nil {
+			return content.Kind
+		}
+	}
+	return ""
+}
+
+// parse converts the manifests to JSON, nil for a missing side. They are converted again if their content
+// changed since, like Secrets after redaction.
+func (c *objectChange) parse() error {
+	oldText, newText := mappingContent(c.oldContent), mappingContent(c.newContent)
+	if c.parsed && oldText == c.oldText && newText == c.newText {
+		return c.err
+	}
+	c.parsed, c.compared = true, false
+	c.oldText, c.newText = oldText, newText
+	if c.oldJSON, c.oldObj, c.err = manifestToJSON(c.oldContent); c.err != nil {
+		c.err = fmt.Errorf("convert old manifest: %w", c.err)
+		return c.err
+	}
+	if c.newJSON, c.newObj, c.err = manifestToJSON(c.newContent); c.err != nil {
+		c.err = fmt.Errorf("convert new manifest: %w", c.err)
+	}
+	return c.err
+}
+
+// objects returns the objects of both manifests, or nils if either is missing or cannot be converted.
+func (c *objectChange) objects() (map[string]interface{}, map[string]interface{}) {
+	if c.parse() != nil || c.oldObj == nil || c.newObj == nil {
+		return nil, nil
+	}
+	return c.oldObj, c.newObj
+}
+
+// fieldChanges returns the changed fields between the manifests, which must both exist.
+func (c *objectChange) fieldChanges() ([]FieldChange, error) {
+	if err := c.parse(); err != nil {
+		return nil, err
+	}
+	if !c.compared {
+		c.compared = true
+		c.changes, c.changesErr = calculateFieldChanges(c.oldJSON, c.newJSON)
+	}
+	return c.changes, c.changesErr
+}
+
+func mappingContent(m *manifest.MappingResult) string {
+	if m == nil {
+		return ""
+	}
+	return m.Content
+}
+
 func manifestExists(m *manifest.MappingResult) bool {
 	return m != nil && strings.TrimSpace(m.Content) != ""
 }
@@ -221,8 +306,9 @@ func walkPatch(changes *[]FieldChange, tokens []string, patchNode, oldNode, newN
 	default:
 		path, field := splitTokens(tokens)
 		change := FieldChange{
-			Path:  path,
-			Field: field,
+			Path:   path,
+			Field:  field,
+			tokens: append([]string(nil), tokens...),
 		}
 
 		if patchNode == nil {
@@ -280,6 +366,7 @@ func diffArrayNodes(changes *[]FieldChange, tokens []string, oldNode, newNode in
 					Change:   "replace",
 					OldValue: oldVal,
 					NewValue: newVal,
+					tokens:   append([]string(nil), next...),
 				})
 				continue
 			}
@@ -295,6 +382,7 @@ func diffArrayNodes(changes *[]FieldChange, tokens []string, oldNode, newNode in
 					Change:   "replace",
 					OldValue: oldVal,
 					NewValue: newVal,
+					tokens:   append([]string(nil), next...),
 				})
 				continue
 			}
@@ -308,6 +396,7 @@ func diffArrayNodes(changes *[]FieldChange, tokens []string, oldNode, newNode in
 				Field:    field,
 				Change:   "remove",
 				OldValue: oldVal,
+				tokens:   append([]string(nil), next...),
 			})
 		case newVal != nil:
 			path, field := splitTokens(next)
@@ -316,6 +405,7 @@ func diffArrayNodes(changes *[]FieldChange, tokens []string, oldNode, newNode in
 				Field:    field,
 				Change:   "add",
 				NewValue: newVal,
+				tokens:   append([]string(nil), next...),
 			})
 		}
 	}
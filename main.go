@@ -13,7 +13,7 @@ import (
 )
 
 func main() {
-	if err := cmd.New().Execute(); err != nil {
+	if err := cmd.Execute(); err != nil {
 		var cmdErr cmd.Error
 		switch {
 		case errors.As(err, &cmdErr):
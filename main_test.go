@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -34,6 +37,8 @@ func setupHelmDiffTest(t *testing.T) *helmDiffTestHelper {
 	}
 	h.helmBin, h.helmBinSet = os.LookupEnv("HELM_BIN")
 	os.Setenv("HELM_BIN", os.Args[0])
+	t.Setenv("HELM_DRIVER", "memory")
+	t.Setenv("HELM_MEMORY_DRIVER_DATA", "testdata/releases.yaml")
 
 	return h
 }
@@ -80,6 +85,14 @@ func TestHelmDiffRevisionWithKubeContext(t *testing.T) {
 	require.NoError(t, cmd.New().Execute())
 }
 
+func TestHelmDiffRevisionSelectorWithKubeContext(t *testing.T) {
+	h := setupHelmDiffTest(t)
+	defer h.cleanup()
+
+	os.Args = []string{"helm-diff", "revision", "--kube-context", "test-context", "test-release", "previous"}
+	require.NoError(t, cmd.New().Execute())
+}
+
 func TestHelmDiffRollbackWithKubeContext(t *testing.T) {
 	h := setupHelmDiffTest(t)
 	defer h.cleanup()
@@ -96,6 +109,38 @@ func TestHelmDiffReleaseWithKubeContext(t *testing.T) {
 	require.NoError(t, cmd.New().Execute())
 }
 
+func TestHelmDiffExplain(t *testing.T) {
+	h := setupHelmDiffTest(t)
+	defer h.cleanup()
+
+	os.Args = []string{"helm-diff", "upgrade", "--explain", "--kube-context", "test-context", "--set", "image.tag=2.0", "test-release", "test/testdata/test-chart"}
+	require.NoError(t, cmd.New().Execute())
+}
+
+func TestHelmDiffBatch(t *testing.T) {
+	h := setupHelmDiffTest(t)
+	defer h.cleanup()
+
+	spec := filepath.Join(t.TempDir(), "releases.yaml")
+	require.NoError(t, os.WriteFile(spec, []byte(`flags: [--kube-context, test-context]
+releases:
+- release: test-release
+  chart: test/testdata/test-chart
+  values: [test/testdata/test-values.yaml]
+- release: missing-release
+  chart: test/testdata/test-chart
+`), 0644))
+
+	var out bytes.Buffer
+	os.Args = []string{"helm-diff", "batch", "-f", spec}
+	c := cmd.New()
+	c.SetOut(&out)
+	c.SetErr(io.Discard)
+	require.EqualError(t, c.Execute(), "failed to diff 1 of 2 releases")
+	require.Contains(t, out.String(), "=== test-release ===\n\n=== missing-release ===\n")
+	require.Contains(t, out.String(), "Summary: 2 releases, 0 with changes, 1 without changes, 1 failed\n")
+}
+
 const (
 	env      = "BECOME_FAKE_HELM"
 	envValue = "1"
@@ -114,78 +159,25 @@ var helmSubcmdStubs = []fakeHelmSubcmd{
 		cmd:    []string{"version"},
 		stdout: `version.BuildInfo{Version:"v3.1.0-rc.1", GitCommit:"12345", GitTreeState:"clean", GoVersion:"go1.20.12"}`,
 	},
-	{
-		cmd:  []string{"get", "manifest"},
-		args: []string{"test-release"},
-		stdout: `---
-# Source: test-chart/templates/cm.yaml
-`,
-	},
 	{
 		cmd:  []string{"template"},
 		args: []string{"test-release", "test/testdata/test-chart", "--values", "test/testdata/test-values.yaml", "--validate", "--is-upgrade"},
 	},
-	{
-		cmd:  []string{"get", "hooks"},
-		args: []string{"test-release"},
-	},
-	{
-		cmd:  []string{"get", "manifest"},
-		args: []string{"test-release", "--kube-context", "test-context"},
-		stdout: `---
-# Source: test-chart/templates/cm.yaml
-`,
-	},
 	{
 		cmd:  []string{"template"},
 		args: []string{"test-release", "test/testdata/test-chart", "--kube-context", "test-context", "--values", "test/testdata/test-values.yaml", "--validate", "--is-upgrade"},
 	},
-	{
-		cmd:  []string{"get", "hooks"},
-		args: []string{"test-release", "--kube-context", "test-context"},
-	},
-	{
-		cmd:  []string{"get", "values"},
-		args: []string{"test-release", "--output", "yaml", "--all", "--kube-context", "test-context"},
-	},
-	{
-		cmd:  []string{"get", "values"},
-		args: []string{"test-release", "--output", "yaml", "--all", "--namespace", "*", "--kube-context", "test-context"},
-	},
 	{
 		cmd:  []string{"template"},
 		args: []string{"test-release", "test/testdata/test-chart", "--kube-context", "test-context", "--values", "*", "--values", "test/testdata/test-values.yaml", "--validate", "--is-upgrade"},
 	},
 	{
-		cmd:  []string{"get", "manifest"},
-		args: []string{"test-release", "--revision", "2", "--kube-context", "test-context"},
-		stdout: `---
-# Source: test-chart/templates/cm.yaml
-`,
-	},
-	{
-		cmd:  []string{"get", "manifest"},
-		args: []string{"test-release1", "--kube-context", "test-context"},
-		stdout: `---
-# Source: test-chart/templates/cm.yaml
-`,
-	},
-	{
-		cmd:    []string{"get", "all"},
-		args:   []string{"test-release1", "--template", "*", "--kube-context", "test-context"},
-		stdout: `test-chart`,
-	},
-	{
-		cmd:  []string{"get", "manifest"},
-		args: []string{"test-release2", "--kube-context", "test-context"},
-		stdout: `---
-# Source: test-chart/templates/cm.yaml
-`,
+		cmd:  []string{"template"},
+		args: []string{"test-release", "test/testdata/test-chart", "--kube-context", "test-context", "--set", "image.tag=2.0", "--validate", "--is-upgrade"},
 	},
 	{
-		cmd:    []string{"get", "all"},
-		args:   []string{"test-release2", "--template", "*", "--kube-context", "test-context"},
-		stdout: `test-chart`,
+		cmd:  []string{"template"},
+		args: []string{"test-release", "test/testdata/test-chart", "--kube-context", "test-context", "--values", "*", "--validate", "--is-upgrade"},
 	},
 }
 
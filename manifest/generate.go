@@ -2,8 +2,11 @@ package manifest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 
 	jsonpatch "github.com/evanphx/json-patch/v5"
 	jsoniter "github.com/json-iterator/go"
@@ -11,6 +14,8 @@ import (
 	"helm.sh/helm/v4/pkg/kube"
 	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
@@ -23,7 +28,64 @@ const (
 	Helm3TestHook        = "test"
 )
 
+// helmFieldManager is the field manager the helm CLI applies objects with.
+const helmFieldManager = "helm"
+
+// GenerateOptions control how Generate computes the target objects of the resources that exist in the cluster.
+type GenerateOptions struct {
+	// ServerSideApply computes the target objects with a dry-run server-side apply of the rendered objects,
+	// the way Helm v4 upgrades with --server-side, instead of a three-way strategic merge patch.
+	// Fields owned by other field managers are then kept or removed exactly like the upgrade would.
+	ServerSideApply bool
+	// ForceConflicts forces the conflicts of the server-side apply with other field managers, like helm upgrade
+	// --force-conflicts. Without it, the objects whose apply conflicts fail like the upgrade would,
+	// unless ApplyConflicts is set.
+	ForceConflicts bool
+	// Concurrency is the maximum number of objects fetched and patched at the same time. Defaults to 1.
+	Concurrency int
+	// FieldManager is the field manager of the server-side apply. Defaults to the one of the helm CLI.
+	FieldManager string
+	// FieldOwners, if not nil, is filled with the fields of the live objects owned by other field managers
+	// than FieldManager, by the names Parse gives the objects with DefaultNamespace as the default namespace.
+	FieldOwners map[string][]FieldOwner
+	// ApplyConflicts, if not nil, is filled with the fields of the live objects whose server-side apply conflicts
+	// with other field managers, by the names Parse gives the objects with DefaultNamespace as the default namespace.
+	// The target objects of the conflicting applies are then computed forcing the conflicts, instead of failing.
+	ApplyConflicts map[string][]FieldOwner
+	// Originals, if not nil, is filled with the objects of the original manifest that exist in the cluster,
+	// by the names Parse gives the objects with DefaultNamespace as the default namespace.
+	Originals map[string]string
+	// ResourceErrors, if not nil, is filled with the errors of the objects that cannot be fetched or patched,
+	// by the names Parse gives the objects with DefaultNamespace as the default namespace.
+	// The objects are left out of both manifests instead of failing the whole generation.
+	ResourceErrors   map[string]error
+	DefaultNamespace string
+}
+
+func (o GenerateOptions) fieldManager() string {
+	if o.FieldManager != "" {
+		return o.FieldManager
+	}
+	if kube.ManagedFieldsManager != "" {
+		return kube.ManagedFieldsManager
+	}
+	return helmFieldManager
+}
+
+// Generate returns the current and the target manifests of a three-way merge
+// between the original manifest, the live objects and the target manifest.
 func Generate(actionConfig *action.Configuration, originalManifest, targetManifest []byte) ([]byte, []byte, error) {
+	return GenerateWithOptions(actionConfig, originalManifest, targetManifest, GenerateOptions{})
+}
+
+// GenerateWithOptions is Generate with options.
+func GenerateWithOptions(actionConfig *action.Configuration, originalManifest, targetManifest []byte, opts GenerateOptions) ([]byte, []byte, error) {
+	return GenerateWithContext(context.Background(), actionConfig, originalManifest, targetManifest, opts)
+}
+
+// GenerateWithContext is GenerateWithOptions that stops fetching and patching objects once ctx is done,
+// returning the error of ctx.
+func GenerateWithContext(ctx context.Context, actionConfig *action.Configuration, originalManifest, targetManifest []byte, opts GenerateOptions) ([]byte, []byte, error) {
 	var err error
 	original, err := actionConfig.KubeClient.Build(bytes.NewBuffer(originalManifest), false)
 	if err != nil {
@@ -59,7 +121,10 @@ func Generate(actionConfig *action.Configuration, originalManifest, targetManife
 		}
 	}
 
-	toBeUpdated, err := existingResourceConflict(toBeCreated)
+	toBeUpdated, err := existingResourceConflict(ctx, toBeCreated, opts.Concurrency)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, nil, ctxErr
+	}
 	if err != nil {
 		return nil, nil, fmt.Errorf("rendered manifests contain a resource that already exists. Unable to continue with update: %w", err)
 	}
@@ -72,10 +137,17 @@ func Generate(actionConfig *action.Configuration, originalManifest, targetManife
 		return nil
 	})
 
-	err = target.Visit(func(info *resource.Info, err error) error {
-		if err != nil {
-			return err
-		}
+	// objects of the target manifest, by index to keep the order of the manifests whatever the concurrency
+	type generated struct {
+		current, target []byte
+		name            string
+		owners          []FieldOwner
+		conflicts       []FieldOwner
+		original        []byte
+		err             error
+	}
+	results := make([]generated, len(target))
+	generate := func(i int, info *resource.Info) error {
 		kind := info.Mapping.GroupVersionKind.Kind
 
 		// Fetch the current object for the three-way merge
@@ -83,16 +155,26 @@ func Generate(actionConfig *action.Configuration, originalManifest, targetManife
 		currentObj, err := helper.Get(info.Namespace, info.Name)
 		if err != nil {
 			if !apierrors.IsNotFound(err) {
-				return fmt.Errorf("could not get information about the resource: %w", err)
+				return fmt.Errorf("could not get information about %q with kind %s: %w", info.Name, kind, err)
 			}
 			// to be created
-			out, _ := yaml.Marshal(info.Object)
-			installManifest = append(installManifest, yamlSeparator...)
-			installManifest = append(installManifest, out...)
+			results[i].target, _ = yaml.Marshal(info.Object)
 			return nil
 		}
 		// to be updated
 		out, _ := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(currentObj)
+		var (
+			owners  []FieldOwner
+			liveObj map[string]interface{}
+		)
+		if opts.FieldOwners != nil || opts.ApplyConflicts != nil {
+			if err := jsoniter.Unmarshal(out, &liveObj); err != nil {
+				return fmt.Errorf("read managed fields of %q with kind %s: %w", info.Name, kind, err)
+			}
+		}
+		if opts.FieldOwners != nil {
+			owners = fieldOwners(liveObj, opts.fieldManager())
+		}
 		pruneObj, err := deleteStatusAndTidyMetadata(out)
 		if err != nil {
 			return fmt.Errorf("prune current obj %q with kind %s: %w", info.Name, kind, err)
@@ -101,41 +183,126 @@ func Generate(actionConfig *action.Configuration, originalManifest, targetManife
 		if err != nil {
 			return fmt.Errorf("prune current out %q with kind %s: %w", info.Name, kind, err)
 		}
-		releaseManifest = append(releaseManifest, yamlSeparator...)
-		releaseManifest = append(releaseManifest, pruneOut...)
+		results[i].current = pruneOut
+		results[i].owners = owners
+		if len(owners) > 0 || opts.Originals != nil || opts.ApplyConflicts != nil {
+			if results[i].name, err = objectName(pruneOut, opts.DefaultNamespace); err != nil {
+				return err
+			}
+		}
 
 		originalInfo := original.Get(info)
-		if originalInfo == nil {
-			return fmt.Errorf("could not find %q", info.Name)
+		if opts.Originals != nil && originalInfo != nil {
+			out, _ := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(originalInfo.Object)
+			originalObj, err := deleteStatusAndTidyMetadata(out)
+			if err != nil {
+				return fmt.Errorf("prune original obj %q with kind %s: %w", info.Name, kind, err)
+			}
+			if results[i].original, err = yaml.Marshal(originalObj); err != nil {
+				return fmt.Errorf("prune original out %q with kind %s: %w", info.Name, kind, err)
+			}
 		}
 
-		patch, patchType, err := createPatch(originalInfo.Object, currentObj, info)
-		if err != nil {
-			return err
-		}
+		var targetObj runtime.Object
+		if opts.ServerSideApply {
+			targetObj, err = applyServerSide(info, opts.fieldManager(), opts.ForceConflicts)
+			if apierrors.IsConflict(err) && opts.ApplyConflicts != nil {
+				results[i].conflicts = applyConflicts(err, liveObj)
+				targetObj, err = applyServerSide(info, opts.fieldManager(), true)
+			}
+			if apierrors.IsConflict(err) {
+				return fmt.Errorf("cannot apply %q with kind %s server-side without --force-conflicts: %w", info.Name, kind, err)
+			}
+			if err != nil {
+				return fmt.Errorf("cannot apply %q with kind %s server-side: %w", info.Name, kind, err)
+			}
+		} else {
+			if originalInfo == nil {
+				return fmt.Errorf("could not find %q", info.Name)
+			}
 
-		helper.ServerDryRun = true
-		targetObj, err := helper.Patch(info.Namespace, info.Name, patchType, patch, nil)
-		if err != nil {
-			return fmt.Errorf("cannot patch %q with kind %s: %w", info.Name, kind, err)
+			patch, patchType, err := createPatch(originalInfo.Object, currentObj, info)
+			if err != nil {
+				return err
+			}
+
+			helper.ServerDryRun = true
+			targetObj, err = helper.Patch(info.Namespace, info.Name, patchType, patch, nil)
+			if err != nil {
+				return fmt.Errorf("cannot patch %q with kind %s: %w", info.Name, kind, err)
+			}
 		}
 		out, _ = jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(targetObj)
 		pruneObj, err = deleteStatusAndTidyMetadata(out)
 		if err != nil {
 			return fmt.Errorf("prune current obj %q with kind %s: %w", info.Name, kind, err)
 		}
-		pruneOut, err = yaml.Marshal(pruneObj)
+		results[i].target, err = yaml.Marshal(pruneObj)
 		if err != nil {
 			return fmt.Errorf("prune current out %q with kind %s: %w", info.Name, kind, err)
 		}
-		installManifest = append(installManifest, yamlSeparator...)
-		installManifest = append(installManifest, pruneOut...)
+		return nil
+	}
+	err = VisitConcurrently(target, opts.Concurrency, func(i int, info *resource.Info) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := generate(i, info)
+		if err == nil || opts.ResourceErrors == nil {
+			return err
+		}
+		// leave the object out of both manifests and go on with the others
+		content, _ := yaml.Marshal(info.Object)
+		name, nameErr := objectName(content, opts.DefaultNamespace)
+		if nameErr != nil {
+			return err
+		}
+		results[i] = generated{name: name, err: err}
 		return nil
 	})
+	// the objects whose fetch or patch failed because ctx is done are no resource errors
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, nil, ctxErr
+	}
+
+	for _, r := range results {
+		if r.err != nil {
+			opts.ResourceErrors[r.name] = r.err
+			continue
+		}
+		if r.current != nil {
+			releaseManifest = append(releaseManifest, yamlSeparator...)
+			releaseManifest = append(releaseManifest, r.current...)
+		}
+		if r.target != nil {
+			installManifest = append(installManifest, yamlSeparator...)
+			installManifest = append(installManifest, r.target...)
+		}
+		if r.owners != nil {
+			opts.FieldOwners[r.name] = r.owners
+		}
+		if r.conflicts != nil {
+			opts.ApplyConflicts[r.name] = r.conflicts
+		}
+		if r.original != nil {
+			opts.Originals[r.name] = string(r.original)
+		}
+	}
 
 	return releaseManifest, installManifest, err
 }
 
+// applyServerSide returns the object a server-side apply of the target object would result in,
+// forcing conflicts with other field managers if force is set, like helm upgrade --force-conflicts.
+func applyServerSide(target *resource.Info, fieldManager string, force bool) (runtime.Object, error) {
+	data, err := runtime.Encode(unstructured.UnstructuredJSONScheme, target.Object)
+	if err != nil {
+		return nil, fmt.Errorf("serializing target configuration: %w", err)
+	}
+	helper := resource.NewHelper(target.Client, target.Mapping).DryRun(true).WithFieldManager(fieldManager)
+	return helper.Patch(target.Namespace, target.Name, types.ApplyPatchType, data, &metav1.PatchOptions{Force: &force})
+}
+
 func createPatch(originalObj, currentObj runtime.Object, target *resource.Info) ([]byte, types.PatchType, error) {
 	oldData, err := json.Marshal(originalObj)
 	if err != nil {
@@ -189,26 +356,52 @@ func objectKey(r *resource.Info) string {
 	return fmt.Sprintf("%s/%s/%s/%s", gvk.GroupVersion().String(), gvk.Kind, r.Namespace, r.Name)
 }
 
-func existingResourceConflict(resources kube.ResourceList) (kube.ResourceList, error) {
-	var requireUpdate kube.ResourceList
-
-	err := resources.Visit(func(info *resource.Info, err error) error {
-		if err != nil {
+func existingResourceConflict(ctx context.Context, resources kube.ResourceList, concurrency int) (kube.ResourceList, error) {
+	exists := make([]bool, len(resources))
+	err := VisitConcurrently(resources, concurrency, func(i int, info *resource.Info) error {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-
 		helper := resource.NewHelper(info.Client, info.Mapping)
-		_, err = helper.Get(info.Namespace, info.Name)
+		_, err := helper.Get(info.Namespace, info.Name)
 		if err != nil {
 			if apierrors.IsNotFound(err) {
 				return nil
 			}
-			return fmt.Errorf("could not get information about the resource: %w", err)
+			return fmt.Errorf("could not get information about %q with kind %s: %w", info.Name, info.Mapping.GroupVersionKind.Kind, err)
 		}
-
-		requireUpdate.Append(info)
+		exists[i] = true
 		return nil
 	})
 
+	var requireUpdate kube.ResourceList
+	for i, info := range resources {
+		if exists[i] {
+			requireUpdate.Append(info)
+		}
+	}
 	return requireUpdate, err
 }
+
+// VisitConcurrently calls fn for every resource with its index, running at most concurrency calls at the same time,
+// and returns the errors of all resources joined in the order of the resources.
+// A concurrency below 1 visits the resources one at a time.
+func VisitConcurrently(resources kube.ResourceList, concurrency int, fn func(i int, info *resource.Info) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	errs := make([]error, len(resources))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, info := range resources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			errs[i] = fn(i, info)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,117 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v4/pkg/kube"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest/fake"
+)
+
+func TestApplyServerSide(t *testing.T) {
+	var request *http.Request
+	var body []byte
+	client := &fake.RESTClient{
+		GroupVersion:         schema.GroupVersion{Version: "v1"},
+		NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			request = req
+			var err error
+			if body, err = io.ReadAll(req.Body); err != nil {
+				return nil, err
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(bytes.NewBufferString(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"ns"},"data":{"key":"applied","other":"kept"}}`)),
+			}, nil
+		}),
+	}
+	target := &resource.Info{
+		Client: client,
+		Mapping: &meta.RESTMapping{
+			Resource:         schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+			GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			Scope:            meta.RESTScopeNamespace,
+		},
+		Namespace: "ns",
+		Name:      "cm",
+		Object: &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "cm", "namespace": "ns"},
+			"data":       map[string]interface{}{"key": "applied"},
+		}},
+	}
+
+	obj, err := applyServerSide(target, GenerateOptions{}.fieldManager(), true)
+	require.NoError(t, err)
+
+	require.Equal(t, http.MethodPatch, request.Method)
+	require.Equal(t, "/namespaces/ns/configmaps/cm", request.URL.Path)
+	require.Equal(t, string(types.ApplyPatchType), request.Header.Get("Content-Type"))
+	require.Equal(t, "All", request.URL.Query().Get("dryRun"))
+	require.Equal(t, "true", request.URL.Query().Get("force"))
+	require.Equal(t, "helm", request.URL.Query().Get("fieldManager"))
+	require.JSONEq(t, `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"ns"},"data":{"key":"applied"}}`, string(body))
+
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"key": "applied", "other": "kept"}, u["data"])
+
+	_, err = applyServerSide(target, GenerateOptions{}.fieldManager(), false)
+	require.NoError(t, err)
+	require.Equal(t, "false", request.URL.Query().Get("force"))
+}
+
+func TestGenerateOptionsFieldManager(t *testing.T) {
+	require.Equal(t, "helm", GenerateOptions{}.fieldManager())
+	require.Equal(t, "my-manager", GenerateOptions{FieldManager: "my-manager"}.fieldManager())
+}
+
+func TestVisitConcurrently(t *testing.T) {
+	var resources kube.ResourceList
+	for i := 0; i < 20; i++ {
+		resources = append(resources, &resource.Info{Name: fmt.Sprintf("obj-%d", i)})
+	}
+
+	var running, maxRunning int32
+	visited := make([]string, len(resources))
+	err := VisitConcurrently(resources, 4, func(i int, info *resource.Info) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		visited[i] = info.Name
+		if i%7 == 3 {
+			return fmt.Errorf("cannot get %s", info.Name)
+		}
+		return nil
+	})
+
+	require.EqualError(t, err, "cannot get obj-3\ncannot get obj-10\ncannot get obj-17")
+	require.LessOrEqual(t, maxRunning, int32(4))
+	for i, name := range visited {
+		require.Equal(t, fmt.Sprintf("obj-%d", i), name)
+	}
+
+	require.NoError(t, VisitConcurrently(nil, 0, func(int, *resource.Info) error { return nil }))
+}
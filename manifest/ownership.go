@@ -0,0 +1,276 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FieldOwner is a field of a live object owned by a field manager, according to the managedFields of the object.
+type FieldOwner struct {
+	Manager string
+	// Operation is Apply for managers applying server-side, Update for the others like controllers and kubectl edit.
+	Operation string
+	// Path is the path of the field, list items are given by their index in the live object.
+	Path []string
+}
+
+// fieldOwners returns the fields of the object owned by field managers other than the excluded one,
+// sorted by path and manager.
+func fieldOwners(obj map[string]interface{}, excludedManager string) []FieldOwner {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	entries, _ := metadata["managedFields"].([]interface{})
+
+	var owners []FieldOwner
+	for _, e := range entries {
+		entry, _ := e.(map[string]interface{})
+		manager, _ := entry["manager"].(string)
+		operation, _ := entry["operation"].(string)
+		subresource, _ := entry["subresource"].(string)
+		fields, _ := entry["fieldsV1"].(map[string]interface{})
+		if manager == excludedManager || subresource != "" || fields == nil {
+			continue
+		}
+		for _, path := range ownedPaths(fields, obj, nil) {
+			owners = append(owners, FieldOwner{Manager: manager, Operation: operation, Path: path})
+		}
+	}
+
+	sort.SliceStable(owners, func(i, j int) bool {
+		pi, pj := strings.Join(owners[i].Path, "\x00"), strings.Join(owners[j].Path, "\x00")
+		if pi != pj {
+			return pi < pj
+		}
+		return owners[i].Manager < owners[j].Manager
+	})
+	return owners
+}
+
+// ownedPaths returns the paths of the fields set in the given FieldsV1 set, resolved against the object.
+// Fields of list items are resolved by the keys or values of the items in the object.
+func ownedPaths(fields map[string]interface{}, node interface{}, prefix []string) [][]string {
+	var paths [][]string
+	for key, child := range fields {
+		if key == "." {
+			continue
+		}
+		token, next, ok := resolveField(key, node)
+		if !ok {
+			continue
+		}
+		path := append(append([]string{}, prefix...), token)
+		children, _ := child.(map[string]interface{})
+		if isLeaf(children) {
+			paths = append(paths, path)
+			continue
+		}
+		paths = append(paths, ownedPaths(children, next, path)...)
+	}
+	return paths
+}
+
+func isLeaf(children map[string]interface{}) bool {
+	for key := range children {
+		if key != "." {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveField returns the path token and the node of a field of a FieldsV1 set:
+// f:<name> for fields, k:<keys> for list items by key, v:<value> for list items by value and i:<index>.
+func resolveField(key string, node interface{}) (string, interface{}, bool) {
+	kind, value, found := strings.Cut(key, ":")
+	if !found {
+		return "", nil, false
+	}
+	switch kind {
+	case "f":
+		m, _ := node.(map[string]interface{})
+		return value, m[value], true
+	case "i":
+		list, _ := node.([]interface{})
+		i, err := strconv.Atoi(value)
+		if err != nil || i >= len(list) {
+			return "", nil, false
+		}
+		return value, list[i], true
+	case "k", "v":
+		var expected interface{}
+		if err := json.Unmarshal([]byte(value), &expected); err != nil {
+			return "", nil, false
+		}
+		list, _ := node.([]interface{})
+		for i, item := range list {
+			if (kind == "v" && reflect.DeepEqual(item, expected)) || (kind == "k" && hasKeys(item, expected)) {
+				return strconv.Itoa(i), item, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+func hasKeys(item, keys interface{}) bool {
+	m, ok := item.(map[string]interface{})
+	k, _ := keys.(map[string]interface{})
+	if !ok || len(k) == 0 {
+		return false
+	}
+	for name, value := range k {
+		if !reflect.DeepEqual(m[name], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyConflictManagerRE matches the field manager in the causes of a server-side apply conflict,
+// e.g. conflict with "kubectl-edit" using apps/v1.
+var applyConflictManagerRE = regexp.MustCompile(`^conflict with "([^"]*)"`)
+
+// applyConflicts returns the fields the failed server-side apply of the object conflicts on, with the field
+// managers owning them, by the causes of the conflict error. The fields are resolved against the object.
+func applyConflicts(err error, obj map[string]interface{}) []FieldOwner {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) || status.Status().Details == nil {
+		return nil
+	}
+	var conflicts []FieldOwner
+	for _, cause := range status.Status().Details.Causes {
+		if cause.Type != metav1.CauseTypeFieldManagerConflict {
+			continue
+		}
+		manager := applyConflictManagerRE.FindStringSubmatch(cause.Message)
+		if manager == nil {
+			continue
+		}
+		path, ok := resolvePath(cause.Field, obj)
+		if !ok {
+			continue
+		}
+		conflicts = append(conflicts, FieldOwner{Manager: manager[1], Path: path})
+	}
+	return conflicts
+}
+
+// resolvePath returns the path of a field given like the fields of server-side apply conflicts,
+// e.g. .spec.containers[name="app"].image, resolved against the object like the fields of ownedPaths.
+// Field names may contain dots, like annotation keys, so the shortest one the object has is taken.
+func resolvePath(field string, node interface{}) ([]string, bool) {
+	var path []string
+	for field != "" {
+		var key string
+		switch field[0] {
+		case '.':
+			rest := field[1:]
+			end := fieldNameEnd(rest, node)
+			key, field = "f:"+rest[:end], rest[end:]
+		case '[':
+			end := closingBracket(field)
+			if end < 0 {
+				return nil, false
+			}
+			key, field = listItemField(field[1:end]), field[end+1:]
+		default:
+			return nil, false
+		}
+		token, next, ok := resolveField(key, node)
+		if !ok {
+			return nil, false
+		}
+		path = append(path, token)
+		node = next
+	}
+	return path, true
+}
+
+// fieldNameEnd returns the end of the field name path starts with: the shortest name up to a dot
+// or a bracket that the node has, or else up to the first one.
+func fieldNameEnd(path string, node interface{}) int {
+	m, _ := node.(map[string]interface{})
+	first := -1
+	for end := 0; end < len(path); end++ {
+		if path[end] != '.' && path[end] != '[' {
+			continue
+		}
+		if _, ok := m[path[:end]]; ok {
+			return end
+		}
+		if first < 0 {
+			first = end
+		}
+	}
+	if _, ok := m[path]; ok || first < 0 {
+		return len(path)
+	}
+	return first
+}
+
+// listItemField returns the FieldsV1 field of a list item of a path: [3] by index, [=value] by value
+// and [name="app",port=80] by keys, whose values are JSON.
+func listItemField(item string) string {
+	if value, ok := strings.CutPrefix(item, "="); ok {
+		return "v:" + value
+	}
+	if _, err := strconv.Atoi(item); err == nil {
+		return "i:" + item
+	}
+	var keys []string
+	for _, pair := range splitOutsideQuotes(item, ',') {
+		name, value, _ := strings.Cut(pair, "=")
+		keys = append(keys, strconv.Quote(name)+":"+value)
+	}
+	return "k:{" + strings.Join(keys, ",") + "}"
+}
+
+// closingBracket returns the index of the bracket closing the one s starts with, skipping quoted strings.
+func closingBracket(s string) int {
+	depth := 0
+	for i, inQuotes := 0, false; i < len(s); i++ {
+		switch c := s[i]; {
+		case inQuotes && c == '\\':
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitOutsideQuotes splits s at the separators that are not within quoted strings, brackets or braces.
+func splitOutsideQuotes(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, inQuotes := 0, false; i < len(s); i++ {
+		switch c := s[i]; {
+		case inQuotes && c == '\\':
+			i++
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
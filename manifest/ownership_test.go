@@ -0,0 +1,133 @@
+package manifest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestFieldOwners(t *testing.T) {
+	var obj map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    owner: ops
+  managedFields:
+  - manager: helm
+    operation: Update
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:spec:
+        f:template:
+          f:spec:
+            f:containers:
+              k:{"name":"app"}:
+                .: {}
+                f:image: {}
+  - manager: kube-controller-manager
+    operation: Update
+    subresource: status
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:status:
+        f:replicas: {}
+  - manager: hpa-controller
+    operation: Update
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:spec:
+        f:replicas: {}
+  - manager: kubectl-edit
+    operation: Update
+    fieldsType: FieldsV1
+    fieldsV1:
+      f:metadata:
+        f:annotations:
+          .: {}
+          f:owner: {}
+      f:spec:
+        f:template:
+          f:spec:
+            f:containers:
+              k:{"name":"sidecar"}:
+                .: {}
+                f:args:
+                  v:"--verbose": {}
+              k:{"name":"missing"}:
+                f:image: {}
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0
+      - name: sidecar
+        args: ["--port=80", "--verbose"]
+status:
+  replicas: 3
+`), &obj))
+
+	require.Equal(t, []FieldOwner{
+		{Manager: "kubectl-edit", Operation: "Update", Path: []string{"metadata", "annotations", "owner"}},
+		{Manager: "hpa-controller", Operation: "Update", Path: []string{"spec", "replicas"}},
+		{Manager: "kubectl-edit", Operation: "Update", Path: []string{"spec", "template", "spec", "containers", "1", "args", "1"}},
+	}, fieldOwners(obj, "helm"))
+}
+
+func TestFieldOwnersWithoutManagedFields(t *testing.T) {
+	require.Empty(t, fieldOwners(map[string]interface{}{"metadata": map[string]interface{}{"name": "app"}}, "helm"))
+	require.Empty(t, fieldOwners(map[string]interface{}{}, "helm"))
+}
+
+func TestObjectName(t *testing.T) {
+	name, err := objectName([]byte("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: prod\n"), "default")
+	require.NoError(t, err)
+	require.Equal(t, "default, prod, Namespace (v1)", name)
+
+	name, err = objectName([]byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n  namespace: prod\n"), "default")
+	require.NoError(t, err)
+	require.Equal(t, "prod, app, Deployment (apps)", name)
+}
+
+func TestApplyConflicts(t *testing.T) {
+	obj := map[string]interface{}{}
+	require.NoError(t, yaml.Unmarshal([]byte(`{
+		"metadata": {"annotations": {"app.kubernetes.io/owner": "ops"}},
+		"spec": {
+			"replicas": 3,
+			"template": {"spec": {"containers": [
+				{"name": "sidecar", "image": "proxy:1.0"},
+				{"name": "app", "image": "app:1.0", "ports": [{"containerPort": 80, "protocol": "TCP"}]}
+			]}},
+			"finalizers": ["a", "b"]
+		}
+	}`), &obj))
+
+	err := apierrors.NewApplyConflict([]metav1.StatusCause{
+		{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "kube-controller-manager" using apps/v1`, Field: ".spec.replicas"},
+		{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "argocd-controller"`, Field: `.spec.template.spec.containers[name="app"].image`},
+		{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "argocd-controller"`, Field: `.spec.template.spec.containers[name="app"].ports[containerPort=80,protocol="TCP"]`},
+		{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "kubectl-annotate" using v1`, Field: ".metadata.annotations.app.kubernetes.io/owner"},
+		{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "ops"`, Field: `.spec.finalizers[="b"]`},
+		{Type: metav1.CauseTypeFieldManagerConflict, Message: `conflict with "ops"`, Field: ".spec.missing[name=\"x\"]"},
+		{Type: metav1.CauseTypeFieldValueInvalid, Message: "invalid", Field: ".spec.replicas"},
+	}, "Apply failed with 6 conflicts")
+
+	require.Equal(t, []FieldOwner{
+		{Manager: "kube-controller-manager", Path: []string{"spec", "replicas"}},
+		{Manager: "argocd-controller", Path: []string{"spec", "template", "spec", "containers", "1", "image"}},
+		{Manager: "argocd-controller", Path: []string{"spec", "template", "spec", "containers", "1", "ports", "0"}},
+		{Manager: "kubectl-annotate", Path: []string{"metadata", "annotations", "app.kubernetes.io/owner"}},
+		{Manager: "ops", Path: []string{"spec", "finalizers", "1"}},
+	}, applyConflicts(err, obj))
+
+	require.Nil(t, applyConflicts(errors.New("connection refused"), obj))
+}
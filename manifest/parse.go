@@ -26,6 +26,21 @@ type MappingResult struct {
 	Kind           string
 	Content        string
 	ResourcePolicy string
+	// Source is the template the object was rendered from, from the "# Source:" comment helm starts documents with.
+	// Empty if the manifest does not tell.
+	Source string
+	// FieldOwners are the fields of the live object owned by other field managers than Helm.
+	// Only set for the live objects of a three-way merge, see GenerateOptions.FieldOwners.
+	FieldOwners []FieldOwner
+	// ApplyConflicts are the fields of the live object the server-side apply of the new object conflicts on,
+	// with the field managers owning them. See GenerateOptions.ApplyConflicts.
+	ApplyConflicts []FieldOwner
+	// Original is the content of the object in the deployed release manifest.
+	// Only set for the live objects of a three-way merge, see GenerateOptions.Originals.
+	Original string
+	// Err is set when the resource cannot be diffed, like a document of the manifest that is no valid YAML
+	// or an object the cluster rejects the dry-run patch of.
+	Err error
 }
 
 type metadata struct {
@@ -69,40 +84,110 @@ func scanYamlSpecs(data []byte, atEOF bool) (advance int, token []byte, err erro
 	return 0, nil, nil
 }
 
-// Parse parses manifest bytes into MappingResult
+// ParseOptions control how ParseWithOptions parses manifests.
+type ParseOptions struct {
+	// DefaultNamespace is the namespace of the objects that specify none.
+	DefaultNamespace string
+	// NormalizeManifests normalizes the objects to exclude style differences from the diff.
+	NormalizeManifests bool
+	// ExcludedHooks are the helm hooks whose objects are left out, like Helm3TestHook.
+	ExcludedHooks []string
+}
+
+// Parse parses manifest bytes into MappingResult like ParseWithOptions.
+// It exits the process when the manifest cannot be read, e.g. because a document is larger than 10MiB,
+// so ParseWithOptions is to be preferred.
 func Parse(manifest []byte, defaultNamespace string, normalizeManifests bool, excludedHooks ...string) map[string]*MappingResult {
-	scanner := bufio.NewScanner(io.MultiReader(strings.NewReader("\n"), bytes.NewReader(manifest)))
+	result, err := ParseWithOptions(manifest, ParseOptions{DefaultNamespace: defaultNamespace, NormalizeManifests: normalizeManifests, ExcludedHooks: excludedHooks})
+	if err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+	return result
+}
+
+// ParseWithOptions parses manifest bytes into MappingResults by name. Documents that cannot be parsed are
+// returned as results carrying the error in Err, so that the other documents can be diffed nonetheless.
+// It returns an error if the manifest cannot be read.
+func ParseWithOptions(manifest []byte, options ParseOptions) (map[string]*MappingResult, error) {
+	result := make(map[string]*MappingResult)
+	if err := scan(bytes.NewReader(manifest), options, func(p *MappingResult) {
+		if _, ok := result[p.Name]; ok {
+			log.Printf("Error: Found duplicate key %#v in manifest", p.Name)
+		} else {
+			result[p.Name] = p
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// scan parses the documents of the manifest read from r one at a time and passes their results to add,
+// including the ones of documents that cannot be parsed.
+func scan(r io.Reader, options ParseOptions, add func(*MappingResult)) error {
+	defaultNamespace, normalizeManifests, excludedHooks := options.DefaultNamespace, options.NormalizeManifests, options.ExcludedHooks
+	scanner := bufio.NewScanner(io.MultiReader(strings.NewReader("\n"), r))
 	scanner.Split(scanYamlSpecs)
 	// Allow for tokens (specs) up to 10MiB in size
 	scanner.Buffer(make([]byte, bufio.MaxScanTokenSize), 10485760)
 
-	result := make(map[string]*MappingResult)
-
+	var documents int
+	// the number of documents read by source template
+	sourceDocuments := map[string]int{}
 	for scanner.Scan() {
 		content := bytes.TrimSpace(scanner.Bytes())
 		if len(content) == 0 {
 			continue
 		}
+		documents++
+		source := documentSource(content)
+		if source != "" {
+			sourceDocuments[source]++
+		}
 
 		parsed, err := parseContent(content, defaultNamespace, normalizeManifests, excludedHooks...)
 		if err != nil {
-			log.Fatalf("%v", err)
+			// report the document as a resource that cannot be diffed and go on with the others
+			p := erroneousDocument(content, documentName(documents, source, sourceDocuments[source]), err)
+			p.Source = source
+			add(p)
+			continue
 		}
 
 		for _, p := range parsed {
-			name := p.Name
-
-			if _, ok := result[name]; ok {
-				log.Printf("Error: Found duplicate key %#v in manifest", name)
-			} else {
-				result[name] = p
-			}
+			p.Source = source
+			add(p)
 		}
 	}
 	if err := scanner.Err(); err != nil {
-		log.Fatalf("Error reading input: %s", err)
+		return fmt.Errorf("error reading input: %w", err)
 	}
-	return result
+	return nil
+}
+
+// erroneousDocument returns the result of a document of a manifest that cannot be parsed.
+func erroneousDocument(content []byte, name string, err error) *MappingResult {
+	return &MappingResult{Name: name, Content: string(content), Err: err}
+}
+
+// documentSource returns the source template of a document, from the "# Source:" comment helm starts it with.
+func documentSource(content []byte) string {
+	firstLine, _, _ := bytes.Cut(content, []byte("\n"))
+	source, ok := bytes.CutPrefix(firstLine, []byte("# Source: "))
+	if !ok {
+		return ""
+	}
+	return string(bytes.TrimSpace(source))
+}
+
+// documentName names a document that cannot be parsed after its source template and its position among the documents
+// of that template, so that the name does not change when other templates render more or fewer documents.
+// Documents of unknown source are named after their position in the manifest.
+func documentName(index int, source string, sourceIndex int) string {
+	if source == "" {
+		return fmt.Sprintf("document %d", index)
+	}
+	return fmt.Sprintf("%s (document %d)", source, sourceIndex)
 }
 
 func ParseObject(object runtime.Object, defaultNamespace string, excludedHooks ...string) (*MappingResult, string, error) {
@@ -147,10 +232,22 @@ func ParseObject(object runtime.Object, defaultNamespace string, excludedHooks .
 	return result[0], oldRelease, nil
 }
 
+// objectName returns the name Parse gives the object.
+func objectName(content []byte, defaultNamespace string) (string, error) {
+	var parsedMetadata metadata
+	if err := yaml.Unmarshal(content, &parsedMetadata); err != nil {
+		return "", fmt.Errorf("YAML unmarshal error: %w", err)
+	}
+	if parsedMetadata.Metadata.Namespace == "" {
+		parsedMetadata.Metadata.Namespace = defaultNamespace
+	}
+	return parsedMetadata.String(), nil
+}
+
 func parseContent(content []byte, defaultNamespace string, normalizeManifests bool, excludedHooks ...string) ([]*MappingResult, error) {
 	var parsedMetadata metadata
 	if err := yaml.Unmarshal(content, &parsedMetadata); err != nil {
-		log.Fatalf("YAML unmarshal error: %s\nCan't unmarshal %s", err, content)
+		return nil, fmt.Errorf("YAML unmarshal error: %w", err)
 	}
 
 	// Skip content without any metadata. It is probably a template that
@@ -167,7 +264,7 @@ func parseContent(content []byte, defaultNamespace string, normalizeManifests bo
 		var list ListV1
 
 		if err := yaml.Unmarshal(content, &list); err != nil {
-			log.Fatalf("YAML unmarshal error: %s\nCan't unmarshal %s", err, content)
+			return nil, fmt.Errorf("YAML unmarshal error: %w", err)
 		}
 
 		var result []*MappingResult
@@ -175,7 +272,7 @@ func parseContent(content []byte, defaultNamespace string, normalizeManifests bo
 		for _, item := range list.Items {
 			subcontent, err := yaml.Marshal(item)
 			if err != nil {
-				log.Printf("YAML marshal error: %s\nCan't marshal %v", err, item)
+				return nil, fmt.Errorf("YAML marshal error: %w", err)
 			}
 
 			subs, err := parseContent(subcontent, defaultNamespace, normalizeManifests, excludedHooks...)
@@ -193,7 +290,7 @@ func parseContent(content []byte, defaultNamespace string, normalizeManifests bo
 		var normalizeErr error
 		content, normalizeErr = normalizeContent(content)
 		if normalizeErr != nil {
-			log.Fatalf("Error normalizing manifests: %v", normalizeErr)
+			return nil, fmt.Errorf("Error normalizing manifests: %w", normalizeErr)
 		}
 	}
 
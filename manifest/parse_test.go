@@ -3,6 +3,7 @@ package manifest_test
 import (
 	"os"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -179,3 +180,58 @@ func TestParseObject(t *testing.T) {
 		})
 	}
 }
+
+func TestParseInvalidDocument(t *testing.T) {
+	spec := []byte(`---
+# Source: app/templates/cm.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cm
+---
+# Source: app/templates/broken.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: fine
+---
+# Source: app/templates/broken.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: broken
+ data: {
+---
+apiVersion: v1
+kind: [
+`)
+	result := Parse(spec, "default", false)
+	// keyed by the position among the documents of the same template, not in the manifest
+	require.Equal(t,
+		[]string{"app/templates/broken.yaml (document 2)", "default, cm, ConfigMap (v1)", "default, fine, ConfigMap (v1)", "document 4"},
+		foundObjects(result),
+	)
+	require.NoError(t, result["default, cm, ConfigMap (v1)"].Err)
+	require.Equal(t, "app/templates/broken.yaml", result["default, fine, ConfigMap (v1)"].Source)
+	require.Equal(t, "app/templates/broken.yaml", result["app/templates/broken.yaml (document 2)"].Source)
+	require.ErrorContains(t, result["app/templates/broken.yaml (document 2)"].Err, "YAML unmarshal error")
+	require.Contains(t, result["app/templates/broken.yaml (document 2)"].Content, "name: broken")
+	require.Error(t, result["document 4"].Err)
+}
+
+func TestParseWithOptions(t *testing.T) {
+	spec, err := os.ReadFile("testdata/pod_hook.yaml")
+	require.NoError(t, err)
+
+	result, err := ParseWithOptions(spec, ParseOptions{DefaultNamespace: "default"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"default, nginx, Pod (v1)"}, foundObjects(result))
+
+	result, err = ParseWithOptions(spec, ParseOptions{DefaultNamespace: "default", ExcludedHooks: []string{"test"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{}, foundObjects(result))
+
+	// documents above the 10MiB limit of the scanner cannot be read
+	_, err = ParseWithOptions([]byte("data: "+strings.Repeat("x", 11<<20)), ParseOptions{})
+	require.ErrorContains(t, err, "error reading input")
+}
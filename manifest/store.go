@@ -0,0 +1,155 @@
+package manifest
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+)
+
+// Store keeps the documents of a manifest in a temporary file and only their names, kinds and content hashes
+// in memory, so that manifests too large to be held in memory twice can be diffed one resource at a time.
+// A Store must be closed to remove its file.
+type Store struct {
+	file    *os.File
+	results map[string]storedResult
+}
+
+// storedResult is what a Store keeps in memory of a result.
+type storedResult struct {
+	kind           string
+	resourcePolicy string
+	source         string
+	hash           [sha256.Size]byte
+	offset         int64
+	length         int
+	err            error
+}
+
+// NewStore parses the manifest read from r into a Store whose file is created in dir, or in the default directory
+// for temporary files if dir is empty. Like ParseWithOptions, documents that cannot be parsed are stored as results
+// carrying the error in Err. It returns an error if the manifest cannot be read or stored.
+func NewStore(r io.Reader, dir string, options ParseOptions) (*Store, error) {
+	file, err := os.CreateTemp(dir, "helm-diff-manifest")
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{file: file, results: map[string]storedResult{}}
+
+	w := bufio.NewWriter(file)
+	var offset int64
+	var writeErr error
+	err = scan(r, options, func(p *MappingResult) {
+		if writeErr != nil {
+			return
+		}
+		if _, ok := s.results[p.Name]; ok {
+			log.Printf("Error: Found duplicate key %#v in manifest", p.Name)
+			return
+		}
+		if _, writeErr = w.WriteString(p.Content); writeErr != nil {
+			return
+		}
+		s.results[p.Name] = storedResult{
+			kind:           p.Kind,
+			resourcePolicy: p.ResourcePolicy,
+			source:         p.Source,
+			hash:           sha256.Sum256([]byte(p.Content)),
+			offset:         offset,
+			length:         len(p.Content),
+			err:            p.Err,
+		}
+		offset += int64(len(p.Content))
+	})
+	if err == nil {
+		err = writeErr
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Keys returns the names of the stored results in sorted order.
+func (s *Store) Keys() []string {
+	keys := make([]string, 0, len(s.results))
+	for key := range s.results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Has tells whether the store has a result of that name.
+func (s *Store) Has(key string) bool {
+	_, ok := s.results[key]
+	return ok
+}
+
+// Hash returns the SHA-256 hash of the content of the result of that name.
+func (s *Store) Hash(key string) ([sha256.Size]byte, bool) {
+	result, ok := s.results[key]
+	return result.hash, ok
+}
+
+// ResourcePolicy returns the helm.sh/resource-policy annotation of the result of that name.
+func (s *Store) ResourcePolicy(key string) string {
+	return s.results[key].resourcePolicy
+}
+
+// Source returns the template the result of that name was rendered from, see MappingResult.Source.
+func (s *Store) Source(key string) string {
+	return s.results[key].source
+}
+
+// Err returns the error of the result of that name, if it cannot be diffed.
+func (s *Store) Err(key string) error {
+	return s.results[key].err
+}
+
+// Load reads the result of that name back from the file of the store.
+func (s *Store) Load(key string) (*MappingResult, error) {
+	result, ok := s.results[key]
+	if !ok {
+		return nil, fmt.Errorf("no resource %q in manifest", key)
+	}
+	content := make([]byte, result.length)
+	if _, err := s.file.ReadAt(content, result.offset); err != nil {
+		return nil, fmt.Errorf("reading %q from the stored manifest: %w", key, err)
+	}
+	return &MappingResult{
+		Name:           key,
+		Kind:           result.kind,
+		Content:        string(content),
+		ResourcePolicy: result.resourcePolicy,
+		Source:         result.source,
+		Err:            result.err,
+	}, nil
+}
+
+// Failed returns the results that cannot be diffed, with their names, kinds and errors but without content.
+func (s *Store) Failed() map[string]*MappingResult {
+	failed := map[string]*MappingResult{}
+	for key, result := range s.results {
+		if result.err != nil {
+			failed[key] = &MappingResult{Name: key, Kind: result.kind, Source: result.source, Err: result.err}
+		}
+	}
+	return failed
+}
+
+// Close closes and removes the file of the store.
+func (s *Store) Close() error {
+	err := s.file.Close()
+	if removeErr := os.Remove(s.file.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package manifest
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(strings.NewReader(`
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+  annotations:
+    helm.sh/resource-policy: keep
+data:
+  key: value
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: a
+---
+kind: [broken
+`), dir, ParseOptions{DefaultNamespace: "default"})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"default, a, Secret (v1)", "default, b, ConfigMap (v1)", "document 3"}, store.Keys())
+	require.True(t, store.Has("default, a, Secret (v1)"))
+	require.False(t, store.Has("default, c, Secret (v1)"))
+	require.Equal(t, "keep", store.ResourcePolicy("default, b, ConfigMap (v1)"))
+
+	result, err := store.Load("default, b, ConfigMap (v1)")
+	require.NoError(t, err)
+	require.Equal(t, "ConfigMap", result.Kind)
+	require.Equal(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n  annotations:\n    helm.sh/resource-policy: keep\ndata:\n  key: value", result.Content)
+
+	hashA, _ := store.Hash("default, a, Secret (v1)")
+	hashB, _ := store.Hash("default, b, ConfigMap (v1)")
+	require.NotEqual(t, hashA, hashB)
+
+	require.Error(t, store.Err("document 3"))
+	require.Len(t, store.Failed(), 1)
+	_, err = store.Load("default, c, Secret (v1)")
+	require.Error(t, err)
+
+	require.NoError(t, store.Close())
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}